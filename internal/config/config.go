@@ -0,0 +1,365 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/silbinarywolf/directx-bind-gen/internal/parser"
+	"github.com/silbinarywolf/directx-bind-gen/internal/types"
+)
+
+// Config describes how to generate bindings for a set of headers.
+// It's loaded from a JSON file so that new headers can be supported
+// without changes to the parser, transformer or printer.
+type Config struct {
+	// Package is the package name of the generated Go bindings
+	Package string
+	// DLL is the library that functions are loaded from, ie. "d3d11.dll"
+	DLL string
+
+	// Packages splits the bindings into more than one Go package,
+	// headers that aren't in any of the packages are generated in Package.
+	Packages []Package
+	// ImportPath is the import path of the folder that bindings are
+	// generated in, it's required by Packages so they can import each other
+	ImportPath string
+
+	// LayoutTests generates a test in each package that asserts
+	// structs have the same size, alignment and field offsets as in C
+	LayoutTests bool
+	// ReleaseScope generates a Scope type in each package that
+	// releases the COM objects added to it together
+	ReleaseScope bool
+
+	// IncludeDir is the folder that Headers are resolved against
+	IncludeDir string
+	// Headers is the list of header files to parse, the headers
+	// they #include are also parsed
+	Headers []string
+	// IncludePaths are additional folders searched for #include files
+	IncludePaths []string
+	// SkipIncludes are the names of headers that aren't parsed
+	// when included, ie. "d3d10shader.h"
+	SkipIncludes []string
+
+	// Defines and Undefines are the macros used to evaluate #if and #ifdef
+	// directives. Macros that are in neither are unknown, so every branch
+	// that depends on them is parsed.
+	Defines   map[string]string
+	Undefines []string
+
+	// TypeAliases, Structs and Macros are declarations that the headers
+	// use but don't declare themselves, ie. HWND or GUID.
+	TypeAliases []types.TypeAlias
+	Structs     []Struct
+	Macros      []types.Macro
+
+	// ErrorMessages are the messages of error and status codes by their
+	// C identifier, ie. "DXGI_ERROR_DEVICE_REMOVED", ErrorValue.Error
+	// returns the name of the code followed by its message
+	ErrorMessages map[string]string
+
+	// Ignore is a list of C identifiers that should not be generated
+	Ignore []string
+
+	// Parameters overrides how the transformer treats parameters
+	Parameters []Parameter
+	// Enums overrides how the transformer treats enums
+	Enums []Enum
+	// Interfaces overrides how the transformer treats COM interfaces
+	Interfaces []Interface
+
+	Naming Naming
+}
+
+// Package is a Go package that the declarations of headers are generated in,
+// it's generated in the sub-folder of the output folder with the same name.
+type Package struct {
+	// Package is the package name, ie. "dxgi"
+	Package string
+	// DLL is the library that functions are loaded from, if empty,
+	// the DLL of the config is used
+	DLL string
+	// Headers are the names of the headers in the package, ie. "DXGI.h"
+	Headers []string
+}
+
+// Struct is a struct declaration with its fields
+type Struct struct {
+	Ident  string
+	Fields []Field
+}
+
+// Field is a struct field
+type Field struct {
+	Name string
+	// Type is the Go type of the field, ie. "uint32" or "[8]byte"
+	Type string
+}
+
+// Parameter overrides how the transformer treats matching parameters.
+// Overrides are applied in order, so later overrides take precedence.
+type Parameter struct {
+	// Function is the function or method name the parameter belongs to,
+	// if empty, it matches parameters of all functions.
+	Function string
+	// Name is the name of the parameter, ie. "ppRenderTargetViews"
+	Name string
+	// Type is the C type of the parameter with a "*" per pointer
+	// depth, ie. "ID3D11Resource*"
+	Type string
+
+	// Array is whether the parameter is passed as a slice. If true, its
+	// length is the parameter of its SAL count, ie. "NumViews" for
+	// "__in_ecount(NumViews * 2)", or the parameter with ArrayLen set
+	// to true if it has no SAL count.
+	Array *bool
+	// ArrayLen is whether the parameter can be the length of
+	// slice parameters
+	ArrayLen *bool
+	// Deref is whether the parameter is passed as a pointer to
+	// an interface, ie. interface{}
+	Deref *bool
+	// Optional is whether the parameter can be nil, optional out
+	// parameters are passed in rather than returned
+	Optional *bool
+}
+
+// Enum overrides how the transformer treats the enum
+type Enum struct {
+	// Ident is the C identifier of the enum, ie. "D3D11_BIND_FLAG"
+	Ident string
+	// Flags is whether the values of the enum are bit flags
+	Flags *bool
+}
+
+// Interface overrides how the transformer treats the COM interface
+type Interface struct {
+	// Ident is the C identifier of the interface, ie. "ID3D11Device"
+	Ident string
+	// Queries are the C identifiers of the interfaces that it can be
+	// queried for besides the ones that inherit from it, ie. "IDXGIDevice"
+	Queries []string
+}
+
+// Naming are the rules used to turn C identifiers into Go identifiers
+type Naming struct {
+	// Strip is a list of substrings that are removed from identifiers,
+	// in order, ie. "D3D11_" turns "D3D11_BOX" into "BOX".
+	Strip []string
+}
+
+// Load reads the config file
+func Load(filename string) (*Config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, errors.New(filename + ": " + err.Error())
+	}
+	for _, record := range config.Structs {
+		for _, field := range record.Fields {
+			if _, err := parseType(field.Type); err != nil {
+				return nil, errors.New(filename + ": invalid type for " + record.Ident + "." + field.Name + ": " + err.Error())
+			}
+		}
+	}
+	return config, nil
+}
+
+// configFilename is the filename of the file returned by File()
+const configFilename = "directx-bind-gen"
+
+// File returns the declarations from the config as a file so that
+// they can be transformed and printed like parsed headers.
+func (config *Config) File() types.File {
+	file := types.File{}
+	file.Filename = configFilename
+	for _, record := range config.TypeAliases {
+		record.CIdent = record.Ident
+		file.TypeAliases = append(file.TypeAliases, record)
+	}
+	for _, record := range config.Structs {
+		data := types.Struct{
+			Ident:  record.Ident,
+			Source: types.Source{CIdent: record.Ident},
+		}
+		for _, field := range record.Fields {
+			// NOTE: Types are validated in Load()
+			typeInfo, _ := parseType(field.Type)
+			data.Fields = append(data.Fields, types.StructField{
+				Name:     field.Name,
+				TypeInfo: typeInfo,
+			})
+		}
+		file.Structs = append(file.Structs, data)
+	}
+	for _, record := range config.Macros {
+		record.CIdent = record.Ident
+		file.Macros = append(file.Macros, record)
+	}
+	return file
+}
+
+// ParserConfig returns the config used to parse headers
+func (config *Config) ParserConfig() parser.Config {
+	return parser.Config{
+		Defines:      config.Defines,
+		Undefines:    config.Undefines,
+		IncludePaths: append([]string{config.IncludeDir}, config.IncludePaths...),
+		SkipIncludes: config.SkipIncludes,
+	}
+}
+
+// FilePackage returns the name of the package that the declarations of the
+// file are generated in. Declarations from the config are generated in the
+// first package of Packages so that every package can import them.
+func (config *Config) FilePackage(filename string) string {
+	if filename == configFilename {
+		if len(config.Packages) > 0 {
+			return config.Packages[0].Package
+		}
+		return config.Package
+	}
+	name := filepath.Base(filename)
+	for _, pkg := range config.Packages {
+		for _, header := range pkg.Headers {
+			if strings.EqualFold(name, header) {
+				return pkg.Package
+			}
+		}
+	}
+	return config.Package
+}
+
+// PackageDLL returns the library that functions in the package are loaded from
+func (config *Config) PackageDLL(pkg string) string {
+	for _, record := range config.Packages {
+		if record.Package == pkg && record.DLL != "" {
+			return record.DLL
+		}
+	}
+	return config.DLL
+}
+
+// IsIgnored returns true if the identifier should not be generated
+func (config *Config) IsIgnored(ident string) bool {
+	for _, ignore := range config.Ignore {
+		if ident == ignore {
+			return true
+		}
+	}
+	return false
+}
+
+// Enum returns the overrides for the enum with the C identifier
+func (config *Config) Enum(ident string) Enum {
+	r := Enum{
+		Ident: ident,
+	}
+	for _, override := range config.Enums {
+		if override.Ident != ident {
+			continue
+		}
+		if override.Flags != nil {
+			r.Flags = override.Flags
+		}
+	}
+	return r
+}
+
+// Interface returns the combined overrides for the COM interface
+// with the C identifier
+func (config *Config) Interface(ident string) Interface {
+	r := Interface{
+		Ident: ident,
+	}
+	for _, override := range config.Interfaces {
+		if override.Ident != ident {
+			continue
+		}
+		r.Queries = append(r.Queries, override.Queries...)
+	}
+	return r
+}
+
+// Parameter returns the combined overrides for the parameter of
+// the given function or method
+func (config *Config) Parameter(function string, param types.StructField) Parameter {
+	r := Parameter{
+		Function: function,
+		Name:     param.Name,
+	}
+	for _, override := range config.Parameters {
+		if override.Function != "" && override.Function != function {
+			continue
+		}
+		if override.Name != "" && override.Name != param.Name {
+			continue
+		}
+		if override.Type != "" && !matchesType(override.Type, param.TypeInfo) {
+			continue
+		}
+		if override.Array != nil {
+			r.Array = override.Array
+		}
+		if override.ArrayLen != nil {
+			r.ArrayLen = override.ArrayLen
+		}
+		if override.Deref != nil {
+			r.Deref = override.Deref
+		}
+		if override.Optional != nil {
+			r.Optional = override.Optional
+		}
+	}
+	return r
+}
+
+// matchesType returns true if the type ie. "ID3D11Resource*" matches
+// the parsed type information
+func matchesType(typ string, typeInfo types.TypeInfo) bool {
+	ident := strings.TrimRight(typ, "* ")
+	depth := strings.Count(typ[len(ident):], "*")
+	if ident != typeInfo.Ident {
+		return false
+	}
+	typeDepth := 0
+	if pointer, ok := typeInfo.Type.(*types.Pointer); ok {
+		typeDepth = pointer.Depth
+	}
+	return depth == typeDepth
+}
+
+// parseType turns Go types such as "uint32" or "[8]byte"
+// into type information
+func parseType(typ string) (types.TypeInfo, error) {
+	if typ == "" {
+		return types.TypeInfo{}, errors.New("missing type")
+	}
+	var dimens []int
+	for strings.HasPrefix(typ, "[") {
+		end := strings.Index(typ, "]")
+		if end == -1 {
+			return types.TypeInfo{}, errors.New("missing ] in array type: " + typ)
+		}
+		d, err := strconv.Atoi(typ[1:end])
+		if err != nil {
+			return types.TypeInfo{}, errors.New("cannot parse array len value: " + typ[1:end])
+		}
+		dimens = append(dimens, d)
+		typ = typ[end+1:]
+	}
+	if len(dimens) > 0 {
+		return types.NewArray(typ, types.Array{
+			Dimens: dimens,
+		}), nil
+	}
+	return types.NewBasicType(typ, types.BasicType{}), nil
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/silbinarywolf/directx-bind-gen/internal/types"
+)
+
+func TestParameterOverrides(t *testing.T) {
+	yes, no := true, false
+	config := &Config{
+		Parameters: []Parameter{
+			{Name: "ppRenderTargetViews", Array: &no},
+			{Type: "ID3D11Resource*", Deref: &yes},
+			{Function: "CopyResource", Name: "pDstResource", Deref: &no},
+		},
+	}
+	resource := types.StructField{
+		Name: "pDstResource",
+		TypeInfo: types.NewPointer("ID3D11Resource", types.Pointer{
+			Depth: 1,
+		}),
+	}
+	if override := config.Parameter("CopySubresourceRegion", resource); override.Deref == nil || !*override.Deref {
+		t.Errorf("expected ID3D11Resource* to be deref")
+	}
+	if override := config.Parameter("CopyResource", resource); override.Deref == nil || *override.Deref {
+		t.Errorf("expected later function override to take precedence")
+	}
+	resource.TypeInfo.Type.(*types.Pointer).Depth = 2
+	if override := config.Parameter("GetResource", resource); override.Deref != nil {
+		t.Errorf("expected ID3D11Resource** to not match ID3D11Resource*")
+	}
+}
+
+func TestInterfaceOverrides(t *testing.T) {
+	config := &Config{
+		Interfaces: []Interface{
+			{Ident: "ID3D11Device", Queries: []string{"IDXGIDevice"}},
+			{Ident: "ID3D11Texture2D", Queries: []string{"IDXGISurface"}},
+			{Ident: "ID3D11Device", Queries: []string{"IDXGIDevice1"}},
+		},
+	}
+	if queries := config.Interface("ID3D11Device").Queries; len(queries) != 2 || queries[0] != "IDXGIDevice" || queries[1] != "IDXGIDevice1" {
+		t.Errorf("expected queries of every ID3D11Device override, got %v", queries)
+	}
+	if queries := config.Interface("ID3D11Buffer").Queries; len(queries) != 0 {
+		t.Errorf("expected no queries for ID3D11Buffer, got %v", queries)
+	}
+}
+
+func TestParseType(t *testing.T) {
+	typeInfo, err := parseType("[8]byte")
+	if err != nil {
+		t.Fatal(err)
+	}
+	array, ok := typeInfo.Type.(*types.Array)
+	if !ok || typeInfo.Ident != "byte" || len(array.Dimens) != 1 || array.Dimens[0] != 8 {
+		t.Errorf("unexpected type info for [8]byte: %+v", typeInfo)
+	}
+	if _, err := parseType("[8byte"); err == nil {
+		t.Errorf("expected error for malformed array type")
+	}
+}
+
+func TestFilePackage(t *testing.T) {
+	config := &Config{
+		Package: "d3d11",
+		DLL:     "d3d11.dll",
+		Packages: []Package{
+			{Package: "dxgi", DLL: "dxgi.dll", Headers: []string{"DXGI.h", "DXGIType.h"}},
+			{Package: "d3dcommon", Headers: []string{"D3Dcommon.h"}},
+		},
+	}
+	tests := []struct {
+		filename string
+		pkg      string
+	}{
+		{"include/dxgitype.h", "dxgi"},
+		{"include/D3Dcommon.h", "d3dcommon"},
+		{"include/D3D11.h", "d3d11"},
+		{config.File().Filename, "dxgi"},
+	}
+	for _, test := range tests {
+		if pkg := config.FilePackage(test.filename); pkg != test.pkg {
+			t.Errorf("expected %s to be in package %s, not %s", test.filename, test.pkg, pkg)
+		}
+	}
+	if dll := config.PackageDLL("d3dcommon"); dll != "d3d11.dll" {
+		t.Errorf("expected package without a DLL to use the config DLL, not %s", dll)
+	}
+}
@@ -0,0 +1,299 @@
+package layout
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/silbinarywolf/directx-bind-gen/internal/types"
+	"github.com/silbinarywolf/directx-bind-gen/internal/typetrans"
+)
+
+// Target is an architecture that struct layouts are computed for
+type Target struct {
+	Name string
+	// PointerSize is the size of pointers in bytes
+	PointerSize int
+}
+
+var (
+	X86 = Target{Name: "x86", PointerSize: 4}
+	X64 = Target{Name: "x64", PointerSize: 8}
+)
+
+// maxAlign is the default packing of MSVC (/Zp8), fields aren't
+// aligned to more than 8 bytes
+const maxAlign = 8
+
+// typeLayout is the size and alignment of a type in bytes
+type typeLayout struct {
+	size  int
+	align int
+}
+
+// basicTypes are the sizes of C types that aren't in typetrans, and Go
+// types, as the structs in the config have Go field types
+var basicTypes = map[string]int{
+	"char":               1,
+	"signed char":        1,
+	"unsigned char":      1,
+	"short":              2,
+	"unsigned short":     2,
+	"int":                4,
+	"unsigned int":       4,
+	"long":               4,
+	"unsigned long":      4,
+	"float":              4,
+	"double":             8,
+	"__int64":            8,
+	"unsigned __int64":   8,
+	"long long":          8,
+	"unsigned long long": 8,
+	"int8":               1,
+	"uint8":              1,
+	"byte":               1,
+	"int16":              2,
+	"uint16":             2,
+	"int32":              4,
+	"uint32":             4,
+	"float32":            4,
+	"int64":              8,
+	"uint64":             8,
+	"float64":            8,
+}
+
+type layouter struct {
+	target  Target
+	structs map[string]*types.Struct
+	aliases map[string]string
+	enums   map[string]bool
+	// layouts are the layouts of the structs that have been computed,
+	// the layout is nil while it's being computed
+	layouts map[string]*types.StructLayout
+}
+
+// Compute sets the Layout of every struct in the project to the layout
+// MSVC uses for x86 and x64. It must be called before the project is
+// transformed as it resolves field types by their C identifiers.
+//
+// An error is returned for each struct whose layout can't be computed,
+// those structs have no Layout.
+func Compute(project *types.Project) []error {
+	x86 := newLayouter(project, X86)
+	x64 := newLayouter(project, X64)
+	var errs []error
+	for i := 0; i < len(project.Files); i++ {
+		file := &project.Files[i]
+		for i := 0; i < len(file.Structs); i++ {
+			record := &file.Structs[i]
+			if err := setLayout(record, x86, x64); err != nil {
+				errs = append(errs, errors.New(file.Filename+": "+err.Error()))
+				continue
+			}
+			if record.VtblStruct != nil {
+				if err := setLayout(record.VtblStruct, x86, x64); err != nil {
+					errs = append(errs, errors.New(file.Filename+": "+err.Error()))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+func setLayout(record *types.Struct, x86, x64 *layouter) error {
+	record.Layout = nil
+	x86Layout, err := x86.structLayout(record)
+	if err != nil {
+		return err
+	}
+	x64Layout, err := x64.structLayout(record)
+	if err != nil {
+		return err
+	}
+	record.Layout = &types.Layout{
+		X86: *x86Layout,
+		X64: *x64Layout,
+	}
+	return nil
+}
+
+func newLayouter(project *types.Project, target Target) *layouter {
+	l := &layouter{
+		target:  target,
+		structs: make(map[string]*types.Struct),
+		aliases: make(map[string]string),
+		enums:   make(map[string]bool),
+		layouts: make(map[string]*types.StructLayout),
+	}
+	for i := 0; i < len(project.Files); i++ {
+		file := &project.Files[i]
+		for i := 0; i < len(file.Structs); i++ {
+			record := &file.Structs[i]
+			l.structs[record.Ident] = record
+			if record.VtblStruct != nil {
+				l.structs[record.VtblStruct.Ident] = record.VtblStruct
+			}
+		}
+		for _, record := range file.TypeAliases {
+			l.aliases[record.Ident] = record.Alias
+		}
+		for _, record := range file.Enums {
+			l.enums[record.Ident] = true
+		}
+	}
+	return l
+}
+
+// structLayout returns the layout of the struct, fields are aligned
+// to their alignment and the size is padded to the largest alignment
+func (l *layouter) structLayout(record *types.Struct) (*types.StructLayout, error) {
+	if layout, ok := l.layouts[record.Ident]; ok {
+		if layout == nil {
+			return nil, errors.New(record.Ident + " contains itself")
+		}
+		return layout, nil
+	}
+	l.layouts[record.Ident] = nil
+	layout := &types.StructLayout{
+		Align: 1,
+	}
+	offset := 0
+	for _, field := range record.Fields {
+		fieldLayout, err := l.fieldLayout(field.TypeInfo)
+		if err != nil {
+			delete(l.layouts, record.Ident)
+			return nil, errors.New(record.Ident + "." + field.Name + ": " + err.Error())
+		}
+		align := packedAlign(fieldLayout.align)
+		offset = alignUp(offset, align)
+		layout.Offsets = append(layout.Offsets, offset)
+		offset += fieldLayout.size
+		if align > layout.Align {
+			layout.Align = align
+		}
+	}
+	layout.Size = alignUp(offset, layout.Align)
+	l.layouts[record.Ident] = layout
+	return layout, nil
+}
+
+func (l *layouter) fieldLayout(typeInfo types.TypeInfo) (typeLayout, error) {
+	switch typ := typeInfo.Type.(type) {
+	case *types.Pointer, *types.FunctionPointer:
+		return typeLayout{l.target.PointerSize, l.target.PointerSize}, nil
+	case *types.Array:
+		elem, err := l.typeLayout(typeInfo.Ident)
+		if err != nil {
+			return typeLayout{}, err
+		}
+		for _, dimen := range typ.Dimens {
+			elem.size *= dimen
+		}
+		return elem, nil
+	case *types.Union:
+		union := typeLayout{0, 1}
+		for _, field := range typ.Fields {
+			fieldLayout, err := l.fieldLayout(field.TypeInfo)
+			if err != nil {
+				return typeLayout{}, err
+			}
+			if fieldLayout.size > union.size {
+				union.size = fieldLayout.size
+			}
+			if align := packedAlign(fieldLayout.align); align > union.align {
+				union.align = align
+			}
+		}
+		union.size = alignUp(union.size, union.align)
+		if typ.Layout == nil {
+			typ.Layout = &types.Layout{}
+		}
+		unionLayout := types.StructLayout{
+			Size:    union.size,
+			Align:   union.align,
+			Offsets: make([]int, len(typ.Fields)),
+		}
+		if l.target == X64 {
+			typ.Layout.X64 = unionLayout
+		} else {
+			typ.Layout.X86 = unionLayout
+		}
+		return union, nil
+	}
+	return l.typeLayout(typeInfo.Ident)
+}
+
+// typeLayout returns the layout of the named type
+func (l *layouter) typeLayout(ident string) (typeLayout, error) {
+	ident = strings.TrimPrefix(ident, "const ")
+	ident = strings.TrimPrefix(ident, "struct ")
+	ident = strings.TrimPrefix(ident, "enum ")
+	if strings.HasPrefix(ident, "*") {
+		// ie. "typedef WAVEFORMATEX *PWAVEFORMATEX;"
+		return typeLayout{l.target.PointerSize, l.target.PointerSize}, nil
+	}
+	if record, ok := l.structs[ident]; ok {
+		layout, err := l.structLayout(record)
+		if err != nil {
+			return typeLayout{}, err
+		}
+		return typeLayout{layout.Size, layout.Align}, nil
+	}
+	if l.enums[ident] {
+		return l.typetransLayout(typetrans.EnumTypeTranslation())
+	}
+	if ident == "uintptr" {
+		return typeLayout{l.target.PointerSize, l.target.PointerSize}, nil
+	}
+	if size, ok := basicTypes[ident]; ok {
+		return typeLayout{size, size}, nil
+	}
+	if typeTrans, ok := typetrans.BuiltInTypeTranslation(ident); ok {
+		if typeTrans.Size != "" {
+			return l.typetransLayout(typeTrans)
+		}
+		if typeTrans.GoType != ident {
+			// ie. RECT is translated to the Rect struct from the config
+			return l.typeLayout(typeTrans.GoType)
+		}
+	}
+	if alias, ok := l.aliases[ident]; ok && alias != ident {
+		return l.typeLayout(alias)
+	}
+	return typeLayout{}, errors.New("unknown size of type " + ident)
+}
+
+func (l *layouter) typetransLayout(typeTrans typetrans.TypeTranslationInfo) (typeLayout, error) {
+	size, err := l.parseSize(typeTrans.Size)
+	if err != nil {
+		return typeLayout{}, err
+	}
+	align := size
+	if typeTrans.Align != "" {
+		if align, err = l.parseSize(typeTrans.Align); err != nil {
+			return typeLayout{}, err
+		}
+	}
+	return typeLayout{size, align}, nil
+}
+
+// parseSize parses a size from typetrans, "ptr" is the pointer size
+func (l *layouter) parseSize(size string) (int, error) {
+	if size == "ptr" {
+		return l.target.PointerSize, nil
+	}
+	return strconv.Atoi(size)
+}
+
+// packedAlign returns the alignment of a field with the alignment,
+// fields aren't aligned to more than maxAlign
+func packedAlign(align int) int {
+	if align > maxAlign {
+		return maxAlign
+	}
+	return align
+}
+
+func alignUp(offset int, align int) int {
+	return (offset + align - 1) / align * align
+}
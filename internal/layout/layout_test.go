@@ -0,0 +1,132 @@
+package layout
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/silbinarywolf/directx-bind-gen/internal/types"
+)
+
+func TestCompute(t *testing.T) {
+	project := types.Project{
+		Files: []types.File{
+			{
+				Filename: "test.h",
+				Enums: []types.Enum{
+					{Ident: "TEST_ENUM"},
+				},
+				TypeAliases: []types.TypeAlias{
+					{Ident: "PTEST_STATISTICS", Alias: "*TEST_STATISTICS"},
+				},
+				Structs: []types.Struct{
+					{
+						Ident: "TEST_STATISTICS",
+						Fields: []types.StructField{
+							{Name: "Count", TypeInfo: types.NewBasicType("UINT", types.BasicType{})},
+							{Name: "Time", TypeInfo: types.NewBasicType("LARGE_INTEGER", types.BasicType{})},
+							{Name: "Kind", TypeInfo: types.NewBasicType("TEST_ENUM", types.BasicType{})},
+						},
+					},
+					{
+						Ident: "TEST_DESC",
+						Fields: []types.StructField{
+							{Name: "Name", TypeInfo: types.NewArray("WCHAR", types.Array{Dimens: []int{3}})},
+							{Name: "pData", TypeInfo: types.NewPointer("void", types.Pointer{Depth: 1})},
+							{Name: "Stats", TypeInfo: types.NewBasicType("TEST_STATISTICS", types.BasicType{})},
+							{Name: "Value", TypeInfo: types.NewUnion(types.Union{
+								Fields: []types.StructField{
+									{Name: "Byte", TypeInfo: types.NewBasicType("BYTE", types.BasicType{})},
+									{Name: "Guid", TypeInfo: types.NewBasicType("GUID", types.BasicType{})},
+								},
+							})},
+						},
+					},
+					{
+						Ident: "TEST_HEADER",
+						Fields: []types.StructField{
+							{Name: "Size", TypeInfo: types.NewBasicType("UINT", types.BasicType{})},
+							{Name: "pStats", TypeInfo: types.NewBasicType("PTEST_STATISTICS", types.BasicType{})},
+						},
+					},
+				},
+			},
+		},
+	}
+	if errs := Compute(&project); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	tests := []struct {
+		record *types.Struct
+		layout types.Layout
+	}{
+		{
+			record: &project.Files[0].Structs[0],
+			layout: types.Layout{
+				X86: types.StructLayout{Size: 24, Align: 8, Offsets: []int{0, 8, 16}},
+				X64: types.StructLayout{Size: 24, Align: 8, Offsets: []int{0, 8, 16}},
+			},
+		},
+		{
+			record: &project.Files[0].Structs[1],
+			layout: types.Layout{
+				X86: types.StructLayout{Size: 56, Align: 8, Offsets: []int{0, 8, 16, 40}},
+				X64: types.StructLayout{Size: 56, Align: 8, Offsets: []int{0, 8, 16, 40}},
+			},
+		},
+		{
+			// Typedefs of pointers are the size of a pointer
+			record: &project.Files[0].Structs[2],
+			layout: types.Layout{
+				X86: types.StructLayout{Size: 8, Align: 4, Offsets: []int{0, 4}},
+				X64: types.StructLayout{Size: 16, Align: 8, Offsets: []int{0, 8}},
+			},
+		},
+	}
+	for _, test := range tests {
+		if test.record.Layout == nil || !reflect.DeepEqual(*test.record.Layout, test.layout) {
+			t.Errorf("unexpected layout for %s: %+v", test.record.Ident, test.record.Layout)
+		}
+	}
+}
+
+func TestComputeUnknownType(t *testing.T) {
+	project := types.Project{
+		Files: []types.File{
+			{
+				Filename: "test.h",
+				Structs: []types.Struct{
+					{
+						Ident: "TEST_DESC",
+						Fields: []types.StructField{
+							{Name: "Unknown", TypeInfo: types.NewBasicType("UNKNOWN", types.BasicType{})},
+						},
+					},
+				},
+			},
+		},
+	}
+	if errs := Compute(&project); len(errs) != 1 {
+		t.Fatalf("expected an error for a field of an unknown type, not %v", errs)
+	}
+	if project.Files[0].Structs[0].Layout != nil {
+		t.Errorf("expected no layout for a struct with a field of an unknown type")
+	}
+}
+
+func TestPackedAlign(t *testing.T) {
+	tests := []struct {
+		align    int
+		expected int
+	}{
+		{1, 1},
+		{4, 4},
+		{8, 8},
+		// Fields aren't aligned to more than the default packing
+		{16, 8},
+	}
+	for _, test := range tests {
+		if align := packedAlign(test.align); align != test.expected {
+			t.Errorf("packedAlign(%d): expected %d, got %d", test.align, test.expected, align)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package parser
+
+import (
+	"strings"
+	"text/scanner"
+
+	"github.com/silbinarywolf/directx-bind-gen/internal/types"
+)
+
+// isAnnotation returns true if the token is a SAL annotation,
+// ie. "__in_ecount_opt" or "__RPC__deref_out"
+func isAnnotation(tok string) bool {
+	return strings.HasPrefix(tok, "__")
+}
+
+// parseAnnotation parses the SAL annotation at the current token and
+// its arguments, ie. "__in_bcount_opt( DataSize )", and adds it to a.
+// The token after the annotation is the current token when it returns.
+func (p *parser) parseAnnotation(a *types.Annotation) {
+	name := p.TokenText()
+	raw := name
+	var args []string
+	p.Scan()
+	if p.TokenText() == "(" {
+		var arg []string
+		for depth := 0; ; {
+			if tok := p.Scan(); tok == scanner.EOF {
+				p.errorf("unexpected end of file in annotation: %s", name)
+			}
+			tok := p.TokenText()
+			switch tok {
+			case "(":
+				depth++
+			case ")":
+				depth--
+			}
+			if depth < 0 || (tok == "," && depth == 0) {
+				args = append(args, strings.Join(arg, ""))
+				arg = nil
+				if depth < 0 {
+					break
+				}
+				continue
+			}
+			arg = append(arg, tok)
+		}
+		raw += "(" + strings.Join(args, ",") + ")"
+		p.Scan()
+	}
+	a.SAL = append(a.SAL, raw)
+	addAnnotation(a, name, args)
+}
+
+// addAnnotation adds the meaning of the SAL annotation to a. The
+// annotation is made of parts, ie. "__deref_out_ecount_opt" is
+// "deref", "out", "ecount" and "opt". Parts that don't change how
+// the parameter is passed, ie. "full" or "nz", are ignored.
+func addAnnotation(a *types.Annotation, name string, args []string) {
+	// MIDL annotations, ie. "__RPC__deref_out"
+	name = strings.TrimPrefix(name, "__RPC")
+	arg := func(i int) string {
+		if i < len(args) {
+			return args[i]
+		}
+		return ""
+	}
+	for _, part := range strings.Split(strings.TrimPrefix(name, "__"), "_") {
+		switch part {
+		case "in":
+			a.Direction = types.DirectionIn
+		case "out":
+			a.Direction = types.DirectionOut
+		case "inout":
+			a.Direction = types.DirectionInOut
+		case "opt":
+			a.Optional = true
+		case "reserved":
+			a.Reserved = true
+		case "deref":
+			a.Deref++
+		case "z":
+			a.NullTerminated = true
+		case "ecount":
+			a.CountKind = types.CountElements
+			a.Count = arg(0)
+		case "bcount":
+			a.CountKind = types.CountBytes
+			a.Count = arg(0)
+		case "xcount":
+			a.CountKind = types.CountUnknown
+			a.Count = arg(0)
+		case "part":
+			// ie. __out_ecount_part_opt(NumElements, *pNumElements)
+			a.Length = arg(1)
+		case "range":
+			a.RangeMin = arg(0)
+			a.RangeMax = arg(1)
+		}
+	}
+}
+
+// resolveCountParams sets the parameter that the count of each buffer
+// uses, ie. "NumViews" for __in_ecount(NumViews)
+func resolveCountParams(fields []types.StructField) {
+	names := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		names[field.Name] = true
+	}
+	for i := 0; i < len(fields); i++ {
+		a := &fields[i].Annotation
+		if a.Count == "" {
+			continue
+		}
+		for _, tok := range tokenize(a.Count) {
+			if names[tok] {
+				a.CountParam = tok
+				break
+			}
+		}
+	}
+}
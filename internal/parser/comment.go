@@ -0,0 +1,148 @@
+package parser
+
+import (
+	"strings"
+	"text/scanner"
+	"unicode"
+)
+
+// comment is a comment in the header, comments are kept by Scan until
+// they're attached to a declaration as documentation
+type comment struct {
+	pos  scanner.Position
+	text string
+}
+
+// endLine returns the line that the comment ends on
+func (c comment) endLine() int {
+	return c.pos.Line + strings.Count(c.text, "\n")
+}
+
+// Scan returns the next token that isn't a comment. Comments are kept
+// so that takeDoc and takeTrailingDoc can attach them to declarations.
+func (p *parser) Scan() rune {
+	for {
+		tok := p.Scanner.Scan()
+		if tok != scanner.Comment {
+			return tok
+		}
+		p.comments = append(p.comments, comment{
+			pos:  p.Position,
+			text: p.TokenText(),
+		})
+	}
+}
+
+// takeDoc returns the comments directly above or before the current
+// token, ie. "// Returned by IXAudio2::GetDeviceDetails" on the line
+// above a struct. Other comments that were scanned are discarded.
+func (p *parser) takeDoc() string {
+	line := p.Position.Line
+	start := len(p.comments)
+	for start > 0 && p.comments[start-1].endLine() >= line-1 {
+		start--
+		line = p.comments[start].pos.Line
+	}
+	doc := commentText(p.comments[start:])
+	p.comments = p.comments[:0]
+	return doc
+}
+
+// takeTrailingDoc returns the comments that start on the line that a
+// declaration or field ended on, ie. "UINT Flags; // D3D11_BIND_FLAG".
+// Comments on the lines below that start in the same column continue
+// it. If the current token is on the same line, the comments are before
+// it and are left for takeDoc.
+func (p *parser) takeTrailingDoc(line int) string {
+	if p.Position.Line == line {
+		return ""
+	}
+	var trailing []comment
+	rest := p.comments[:0]
+	for _, c := range p.comments {
+		switch {
+		case c.pos.Line == line,
+			len(trailing) > 0 &&
+				c.pos.Line == trailing[len(trailing)-1].endLine()+1 &&
+				c.pos.Column == trailing[0].pos.Column:
+			// ie.
+			// BYTE Mask; // Mask to indicate which components of the register
+			//            // are used (combination of D3D10_COMPONENT_MASK values)
+			trailing = append(trailing, c)
+		default:
+			rest = append(rest, c)
+		}
+	}
+	p.comments = rest
+	return commentText(trailing)
+}
+
+// declared sets the documentation of the declaration that was just
+// parsed, a comment after it on the same line is added by
+// attachTrailingDoc when the next declaration is parsed
+func (p *parser) declared(doc *string) {
+	*doc = p.doc
+	p.lastDoc = doc
+	p.lastDocLine = p.Position.Line
+}
+
+// attachTrailingDoc adds the comments after the last declaration
+// on the line that it ended on to its documentation
+func (p *parser) attachTrailingDoc() {
+	if p.lastDoc == nil {
+		return
+	}
+	if doc := p.takeTrailingDoc(p.lastDocLine); doc != "" {
+		*p.lastDoc = appendDoc(*p.lastDoc, doc)
+		p.lastDoc = nil
+	}
+}
+
+// appendDoc joins the documentation with a new line
+func appendDoc(doc string, more string) string {
+	if doc == "" {
+		return more
+	}
+	if more == "" {
+		return doc
+	}
+	return doc + "\n" + more
+}
+
+// commentText returns the text of the comments without the comment
+// markers. Lines without any letters or digits, ie. "//-------", are
+// used as separators in headers and become empty lines.
+func commentText(comments []comment) string {
+	var lines []string
+	for _, c := range comments {
+		text := c.text
+		isBlock := strings.HasPrefix(text, "/*")
+		if isBlock {
+			text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+		} else {
+			text = strings.TrimPrefix(text, "//")
+		}
+		for _, line := range strings.Split(text, "\n") {
+			line = strings.TrimSpace(line)
+			if isBlock && strings.HasPrefix(line, "*") {
+				// ie. " * Returns the device count."
+				line = strings.TrimSpace(line[1:])
+			}
+			if strings.IndexFunc(line, isLetterOrDigit) == -1 {
+				line = ""
+			}
+			if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "") {
+				continue
+			}
+			lines = append(lines, line)
+		}
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isLetterOrDigit(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
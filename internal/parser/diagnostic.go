@@ -0,0 +1,45 @@
+package parser
+
+import (
+	"text/scanner"
+)
+
+// Severity is how serious a diagnostic is
+type Severity int
+
+const (
+	// SeverityError is used when a declaration could not be parsed
+	// and was skipped.
+	SeverityError Severity = iota
+	// SeverityWarning is used when a declaration is unsupported and
+	// was ignored, but parsing otherwise succeeded.
+	SeverityWarning
+)
+
+func (severity Severity) String() string {
+	switch severity {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return "unknown"
+}
+
+// Diagnostic is a problem found while parsing a header file
+type Diagnostic struct {
+	Pos      scanner.Position
+	Severity Severity
+	// Decl is the declaration that was being parsed, ie.
+	// "#define D3D11_FLOAT32_MAX" or "typedef struct D3D11_BOX"
+	Decl string
+	Msg  string
+}
+
+func (d Diagnostic) String() string {
+	r := d.Pos.String() + ": " + d.Severity.String() + ": " + d.Msg
+	if d.Decl != "" {
+		r += " (in " + d.Decl + ")"
+	}
+	return r
+}
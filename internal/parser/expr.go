@@ -0,0 +1,704 @@
+package parser
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/silbinarywolf/directx-bind-gen/internal/types"
+)
+
+// precedence of binary operators, higher binds tighter.
+// https://en.wikipedia.org/wiki/Operators_in_C_and_C%2B%2B#Operator_precedence
+var precedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"|":  3,
+	"^":  4,
+	"&":  5,
+	"==": 6,
+	"!=": 6,
+	"<":  7,
+	"<=": 7,
+	">":  7,
+	">=": 7,
+	// NOTE(Jae): 2020-02-18
+	// Need << and >> to have a precdence lower than +, -, /, *
+	// otherwise DXGI_USAGE_SHADER_INPUT ends up not being expected 16
+	"<<": 8,
+	">>": 8,
+	"+":  9,
+	"-":  9,
+	"*":  10,
+	"/":  10,
+	"%":  10,
+}
+
+func isUnaryOperator(operator string) bool {
+	return operator == "-" ||
+		operator == "+" ||
+		operator == "!" ||
+		operator == "~"
+}
+
+func IsNumber(str string) bool {
+	c := str[0]
+	return (c >= '0' && c <= '9') ||
+		(c == '.' && len(str) > 1)
+}
+
+func IsIdent(str string) bool {
+	c := str[0]
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// constKind is the C type of a constant. long is 32-bit as on Windows.
+type constKind int
+
+const (
+	kindInt constKind = iota
+	kindUint
+	kindInt64
+	kindUint64
+	kindFloat
+	kindDouble
+	kindString
+	// kindWideString is a string of wchar_t, ie. L"d3dcompiler_43.dll"
+	kindWideString
+)
+
+// constant is the typed value of a constant expression
+type constant struct {
+	kind constKind
+	// bits are the bits of an integer, values of 32-bit kinds
+	// are sign or zero extended to 64-bit
+	bits  uint64
+	float float64
+	// str is the value of a string
+	str string
+	// text is the literal the constant is from, without its suffix,
+	// so that constants like 0x87a are printed as they're written
+	text string
+}
+
+func intConstant(kind constKind, v uint64) constant {
+	c := constant{kind: kind}
+	switch kind {
+	case kindInt:
+		c.bits = uint64(int64(int32(v)))
+	case kindUint:
+		c.bits = uint64(uint32(v))
+	default:
+		c.bits = v
+	}
+	return c
+}
+
+func boolConstant(v bool) constant {
+	if v {
+		return intConstant(kindInt, 1)
+	}
+	return intConstant(kindInt, 0)
+}
+
+// floatConstant returns the value as a float or double,
+// floats are rounded to 32-bit
+func floatConstant(kind constKind, v float64) constant {
+	if kind == kindFloat {
+		v = float64(float32(v))
+	}
+	return constant{kind: kind, float: v}
+}
+
+func (c constant) isFloat() bool {
+	return c.kind == kindFloat || c.kind == kindDouble
+}
+
+func (c constant) isString() bool {
+	return c.kind == kindString || c.kind == kindWideString
+}
+
+func (c constant) isUnsigned() bool {
+	return c.kind == kindUint || c.kind == kindUint64
+}
+
+func (c constant) isZero() bool {
+	if c.isFloat() {
+		return c.float == 0
+	}
+	return c.bits == 0
+}
+
+// toFloat returns the value as a float64
+func (c constant) toFloat() float64 {
+	switch {
+	case c.isFloat():
+		return c.float
+	case c.isUnsigned():
+		return float64(c.bits)
+	}
+	return float64(int64(c.bits))
+}
+
+// convert returns the value converted to the kind
+func (c constant) convert(kind constKind) constant {
+	if kind == kindFloat || kind == kindDouble {
+		return floatConstant(kind, c.toFloat())
+	}
+	if c.isFloat() {
+		if kind == kindUint || kind == kindUint64 {
+			return intConstant(kind, uint64(c.float))
+		}
+		return intConstant(kind, uint64(int64(c.float)))
+	}
+	return intConstant(kind, c.bits)
+}
+
+// String returns the value as a Go constant, ie. "-1", "4294967295" or "0.5"
+func (c constant) String() string {
+	switch {
+	case c.text != "":
+		return c.text
+	case c.isString():
+		return strconv.Quote(c.str)
+	case c.isFloat():
+		bitSize := 64
+		if c.kind == kindFloat {
+			bitSize = 32
+		}
+		s := strconv.FormatFloat(c.float, 'g', -1, bitSize)
+		if !strings.ContainsAny(s, ".eIN") {
+			s += ".0"
+		}
+		return s
+	case c.isUnsigned():
+		return strconv.FormatUint(c.bits, 10)
+	}
+	return strconv.FormatInt(int64(c.bits), 10)
+}
+
+// toConst returns the constant with its C type for code generation
+func (c constant) toConst() *types.Const {
+	switch c.kind {
+	case kindInt, kindInt64:
+		return &types.Const{Kind: types.ConstInt64, Int64: int64(c.bits)}
+	case kindUint, kindUint64:
+		return &types.Const{Kind: types.ConstUint64, Uint64: c.bits}
+	case kindFloat:
+		return &types.Const{Kind: types.ConstFloat32, Float64: c.float}
+	case kindDouble:
+		return &types.Const{Kind: types.ConstFloat64, Float64: c.float}
+	case kindString:
+		return &types.Const{Kind: types.ConstString, Str: c.str}
+	case kindWideString:
+		return &types.Const{Kind: types.ConstWideString, Str: c.str}
+	}
+	panic("unhandled constant kind: " + strconv.Itoa(int(c.kind)))
+}
+
+// castType is the type of a cast, ie. (UINT)-1
+type castType struct {
+	kind constKind
+	// bits truncates the value if it's 8 or 16
+	bits int
+}
+
+// castTypes are the types that constants can be cast to
+var castTypes = map[string]castType{
+	"char":               {kindInt, 8},
+	"signed char":        {kindInt, 8},
+	"unsigned char":      {kindUint, 8},
+	"BYTE":               {kindUint, 8},
+	"UINT8":              {kindUint, 8},
+	"INT8":               {kindInt, 8},
+	"short":              {kindInt, 16},
+	"unsigned short":     {kindUint, 16},
+	"SHORT":              {kindInt, 16},
+	"USHORT":             {kindUint, 16},
+	"WORD":               {kindUint, 16},
+	"INT16":              {kindInt, 16},
+	"UINT16":             {kindUint, 16},
+	"int":                {kindInt, 32},
+	"long":               {kindInt, 32},
+	"signed":             {kindInt, 32},
+	"INT":                {kindInt, 32},
+	"LONG":               {kindInt, 32},
+	"INT32":              {kindInt, 32},
+	"BOOL":               {kindInt, 32},
+	"HRESULT":            {kindInt, 32},
+	"unsigned":           {kindUint, 32},
+	"unsigned int":       {kindUint, 32},
+	"unsigned long":      {kindUint, 32},
+	"UINT":               {kindUint, 32},
+	"ULONG":              {kindUint, 32},
+	"DWORD":              {kindUint, 32},
+	"UINT32":             {kindUint, 32},
+	"__int64":            {kindInt64, 64},
+	"long long":          {kindInt64, 64},
+	"INT64":              {kindInt64, 64},
+	"LONGLONG":           {kindInt64, 64},
+	"unsigned __int64":   {kindUint64, 64},
+	"unsigned long long": {kindUint64, 64},
+	"UINT64":             {kindUint64, 64},
+	"ULONGLONG":          {kindUint64, 64},
+	"DWORD64":            {kindUint64, 64},
+	"float":              {kindFloat, 32},
+	"FLOAT":              {kindFloat, 32},
+	"double":             {kindDouble, 64},
+}
+
+// mergeOperators joins operators that the scanner splits into
+// single characters, ie. "<", "<" becomes "<<"
+func mergeOperators(tokens []string) []string {
+	r := make([]string, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if i+1 < len(tokens) {
+			switch op := t + tokens[i+1]; op {
+			case "<<", ">>", "<=", ">=", "==", "!=", "&&", "||":
+				r = append(r, op)
+				i++
+				continue
+			}
+		}
+		r = append(r, t)
+	}
+	return r
+}
+
+// evaluator evaluates a constant expression with precedence climbing
+// - https://en.wikipedia.org/wiki/Operator-precedence_parser#Precedence_climbing_method
+type evaluator struct {
+	tokens []string
+	pos    int
+	lookup func(ident string) (constant, bool)
+}
+
+// evaluateExpr evaluates the tokens of a #define, #if or enum expression
+// with the types and promotion rules of C. Identifiers are resolved using
+// the lookup function.
+func evaluateExpr(exprTokens []string, lookup func(ident string) (constant, bool)) (constant, error) {
+	e := &evaluator{
+		tokens: mergeOperators(exprTokens),
+		lookup: lookup,
+	}
+	if len(e.tokens) == 0 {
+		return constant{}, errors.New("empty expression")
+	}
+	value, err := e.expr(0)
+	if err != nil {
+		return constant{}, err
+	}
+	if e.pos < len(e.tokens) {
+		return constant{}, errors.New("unexpected token after expression: " + e.tokens[e.pos])
+	}
+	return value, nil
+}
+
+func (e *evaluator) peek() string {
+	if e.pos < len(e.tokens) {
+		return e.tokens[e.pos]
+	}
+	return ""
+}
+
+func (e *evaluator) next() string {
+	t := e.peek()
+	e.pos++
+	return t
+}
+
+// expr evaluates binary operators with at least the precedence and
+// the conditional operator if minPrecedence is 0
+func (e *evaluator) expr(minPrecedence int) (constant, error) {
+	left, err := e.unary()
+	if err != nil {
+		return constant{}, err
+	}
+	for {
+		op := e.peek()
+		prec, ok := precedence[op]
+		if !ok || prec < minPrecedence {
+			break
+		}
+		e.next()
+		right, err := e.expr(prec + 1)
+		if err != nil {
+			return constant{}, err
+		}
+		if left, err = evaluateBinary(op, left, right); err != nil {
+			return constant{}, err
+		}
+	}
+	if minPrecedence == 0 && e.peek() == "?" {
+		e.next()
+		ifTrue, err := e.expr(0)
+		if err != nil {
+			return constant{}, err
+		}
+		if t := e.next(); t != ":" {
+			return constant{}, errors.New("expected : in conditional expression, not: " + t)
+		}
+		ifFalse, err := e.expr(0)
+		if err != nil {
+			return constant{}, err
+		}
+		if ifTrue.isString() || ifFalse.isString() {
+			if ifTrue.kind != ifFalse.kind {
+				return constant{}, errors.New("mismatched types in conditional expression: " + ifTrue.String() + ", " + ifFalse.String())
+			}
+			if left.isZero() {
+				return ifFalse, nil
+			}
+			return ifTrue, nil
+		}
+		kind := arithmeticKind(ifTrue, ifFalse)
+		if left.isZero() {
+			return ifFalse.convert(kind), nil
+		}
+		return ifTrue.convert(kind), nil
+	}
+	return left, nil
+}
+
+func (e *evaluator) unary() (constant, error) {
+	t := e.next()
+	switch {
+	case t == "":
+		return constant{}, errors.New("unexpected end of expression")
+	case t == "(":
+		if cast, ok := e.castType(); ok {
+			value, err := e.unary()
+			if err != nil {
+				return constant{}, err
+			}
+			if value.isString() {
+				return constant{}, errors.New("cannot cast string: " + value.String())
+			}
+			if cast.bits == 8 || cast.bits == 16 {
+				// Truncated and then promoted to int
+				mask := uint64(1)<<uint(cast.bits) - 1
+				bits := value.convert(kindUint64).bits & mask
+				if cast.kind == kindInt && bits&(mask>>1+1) != 0 {
+					// Sign extend
+					bits |= ^mask
+				}
+				return intConstant(kindInt, bits), nil
+			}
+			return value.convert(cast.kind), nil
+		}
+		value, err := e.expr(0)
+		if err != nil {
+			return constant{}, err
+		}
+		if t := e.next(); t != ")" {
+			return constant{}, errors.New("mismatching paren open and close count")
+		}
+		return value, nil
+	case isUnaryOperator(t):
+		value, err := e.unary()
+		if err != nil {
+			return constant{}, err
+		}
+		return evaluateUnary(t, value)
+	case IsNumber(t):
+		suffix := ""
+		if next := e.peek(); next != "" && isLiteralSuffix(next) {
+			suffix = e.next()
+		}
+		return parseNumber(t, suffix)
+	case t[0] == '\'':
+		r, err := strconv.Unquote(t)
+		if err != nil || len([]rune(r)) != 1 {
+			return constant{}, errors.New("invalid character constant: " + t)
+		}
+		return intConstant(kindInt, uint64([]rune(r)[0])), nil
+	case t[0] == '"' || strings.HasPrefix(t, `L"`) ||
+		(t == "L" && strings.HasPrefix(e.peek(), `"`)):
+		return e.stringLiteral(t)
+	case IsIdent(t):
+		value, ok := e.lookup(t)
+		if !ok {
+			return constant{}, errors.New("unable to find existing identifier: " + t)
+		}
+		return value, nil
+	}
+	return constant{}, errors.New("unhandled expression token: " + t)
+}
+
+// stringLiteral returns the value of the string literal, adjacent
+// literals are joined, ie. "a" "b". It's a wide string if any of the
+// literals have the L prefix.
+func (e *evaluator) stringLiteral(t string) (constant, error) {
+	r := constant{kind: kindString}
+	for {
+		if t == "L" {
+			// The scanner splits L"..." into L and "..."
+			t = "L" + e.next()
+		}
+		if strings.HasPrefix(t, "L") {
+			r.kind = kindWideString
+			t = t[1:]
+		}
+		s, err := strconv.Unquote(t)
+		if err != nil {
+			return constant{}, errors.New("invalid string literal: " + t)
+		}
+		r.str += s
+		next := e.peek()
+		if !strings.HasPrefix(next, `"`) && !strings.HasPrefix(next, `L"`) &&
+			!(next == "L" && e.pos+1 < len(e.tokens) && strings.HasPrefix(e.tokens[e.pos+1], `"`)) {
+			return r, nil
+		}
+		t = e.next()
+	}
+}
+
+// castType returns the type of the cast if the tokens after ( are a type
+// followed by ), ie. "(unsigned long)"
+func (e *evaluator) castType() (castType, bool) {
+	end := e.pos
+	for end < len(e.tokens) && e.tokens[end] != ")" {
+		end++
+	}
+	if end == e.pos || end == len(e.tokens) {
+		return castType{}, false
+	}
+	cast, ok := castTypes[strings.Join(e.tokens[e.pos:end], " ")]
+	if ok {
+		e.pos = end + 1
+	}
+	return cast, ok
+}
+
+// isLiteralSuffix returns true if the token is the suffix of a number
+// that the scanner splits from it, ie. "UL" in 0x1F4UL or "f" in 1.0f
+func isLiteralSuffix(t string) bool {
+	switch strings.ToLower(t) {
+	case "u", "l", "ul", "lu", "ll", "ull", "llu", "i64", "ui64", "f":
+		return true
+	}
+	return false
+}
+
+// parseNumber returns the value of an integer or floating-point literal
+// with the type that C gives it
+func parseNumber(text string, suffix string) (constant, error) {
+	suffix = strings.ToLower(suffix)
+	isHex := strings.HasPrefix(text, "0x") || strings.HasPrefix(text, "0X")
+	if suffix == "f" || strings.Contains(text, ".") || (!isHex && strings.ContainsAny(text, "eE")) {
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return constant{}, errors.New("invalid floating-point constant: " + text + suffix)
+		}
+		kind := kindDouble
+		if suffix == "f" {
+			kind = kindFloat
+		}
+		r := floatConstant(kind, f)
+		r.text = text
+		return r, nil
+	}
+	v, err := strconv.ParseUint(text, 0, 64)
+	if err != nil {
+		return constant{}, errors.New("invalid integer constant: " + text + suffix)
+	}
+	// The type is the first that can represent the value. Headers are
+	// compiled with MSVC where long is 32-bit and decimal constants
+	// follow C89, so 4294967295 is an unsigned long rather than a
+	// long long as in C99.
+	isUnsigned := strings.Contains(suffix, "u")
+	is64 := strings.Contains(suffix, "ll") || strings.Contains(suffix, "64")
+	isDecimal := !isHex && (len(text) == 1 || text[0] != '0')
+	var kinds []constKind
+	switch {
+	case isUnsigned && is64:
+		kinds = []constKind{kindUint64}
+	case isUnsigned:
+		kinds = []constKind{kindUint, kindUint64}
+	case is64:
+		kinds = []constKind{kindInt64, kindUint64}
+	case isDecimal:
+		kinds = []constKind{kindInt, kindUint, kindUint64}
+	default:
+		kinds = []constKind{kindInt, kindUint, kindInt64, kindUint64}
+	}
+	r := intConstant(kindUint64, v)
+	for _, kind := range kinds {
+		if fits(v, kind) {
+			r = intConstant(kind, v)
+			break
+		}
+	}
+	r.text = text
+	return r, nil
+}
+
+func fits(v uint64, kind constKind) bool {
+	switch kind {
+	case kindInt:
+		return v <= math.MaxInt32
+	case kindUint:
+		return v <= math.MaxUint32
+	case kindInt64:
+		return v <= math.MaxInt64
+	}
+	return true
+}
+
+// arithmeticKind returns the type that both operands are converted to
+// by the usual arithmetic conversions of C
+func arithmeticKind(left, right constant) constKind {
+	if left.kind == kindDouble || right.kind == kindDouble {
+		return kindDouble
+	}
+	if left.isFloat() || right.isFloat() {
+		return kindFloat
+	}
+	if left.kind == right.kind {
+		return left.kind
+	}
+	is64 := left.kind == kindInt64 || left.kind == kindUint64 ||
+		right.kind == kindInt64 || right.kind == kindUint64
+	switch {
+	case !is64:
+		// int and unsigned int
+		return kindUint
+	case left.kind == kindUint64 || right.kind == kindUint64:
+		return kindUint64
+	}
+	// long long can represent all unsigned int values
+	return kindInt64
+}
+
+func evaluateUnary(operator string, value constant) (constant, error) {
+	if value.isString() {
+		return constant{}, errors.New("invalid operand for " + operator + ": " + value.String())
+	}
+	switch operator {
+	case "+":
+		return value, nil
+	case "!":
+		return boolConstant(value.isZero()), nil
+	case "-":
+		if value.isFloat() {
+			r := constant{kind: value.kind, float: -value.float}
+			if value.text != "" && value.text[0] != '-' {
+				r.text = "-" + value.text
+			}
+			return r, nil
+		}
+		return intConstant(value.kind, -value.bits), nil
+	case "~":
+		if value.isFloat() {
+			return constant{}, errors.New("invalid operand for ~: " + value.String())
+		}
+		return intConstant(value.kind, ^value.bits), nil
+	}
+	return constant{}, errors.New("unhandled unary operator: " + operator)
+}
+
+func evaluateBinary(operator string, left, right constant) (constant, error) {
+	if left.isString() || right.isString() {
+		return constant{}, errors.New("invalid operands for " + operator + ": " + left.String() + ", " + right.String())
+	}
+	switch operator {
+	case "&&":
+		return boolConstant(!left.isZero() && !right.isZero()), nil
+	case "||":
+		return boolConstant(!left.isZero() || !right.isZero()), nil
+	case "<<", ">>":
+		if left.isFloat() || right.isFloat() {
+			return constant{}, errors.New("invalid operands for " + operator + ": " + left.String() + ", " + right.String())
+		}
+		shift := uint(right.bits)
+		if operator == "<<" {
+			return intConstant(left.kind, left.bits<<shift), nil
+		}
+		if left.isUnsigned() {
+			return intConstant(left.kind, left.bits>>shift), nil
+		}
+		return intConstant(left.kind, uint64(int64(left.bits)>>shift)), nil
+	}
+
+	kind := arithmeticKind(left, right)
+	left, right = left.convert(kind), right.convert(kind)
+	if left.isFloat() {
+		l, r := left.float, right.float
+		switch operator {
+		case "+":
+			return floatConstant(kind, l+r), nil
+		case "-":
+			return floatConstant(kind, l-r), nil
+		case "*":
+			return floatConstant(kind, l*r), nil
+		case "/":
+			return floatConstant(kind, l/r), nil
+		case "==":
+			return boolConstant(l == r), nil
+		case "!=":
+			return boolConstant(l != r), nil
+		case "<":
+			return boolConstant(l < r), nil
+		case "<=":
+			return boolConstant(l <= r), nil
+		case ">":
+			return boolConstant(l > r), nil
+		case ">=":
+			return boolConstant(l >= r), nil
+		}
+		return constant{}, errors.New("invalid operands for " + operator + ": " + left.String() + ", " + right.String())
+	}
+
+	l, r := left.bits, right.bits
+	signed := !left.isUnsigned()
+	switch operator {
+	case "+":
+		return intConstant(kind, l+r), nil
+	case "-":
+		return intConstant(kind, l-r), nil
+	case "*":
+		return intConstant(kind, l*r), nil
+	case "/", "%":
+		if r == 0 {
+			return constant{}, errors.New("division by zero: " + left.String() + " " + operator + " " + right.String())
+		}
+		switch {
+		case operator == "/" && signed:
+			return intConstant(kind, uint64(int64(l)/int64(r))), nil
+		case operator == "/":
+			return intConstant(kind, l/r), nil
+		case signed:
+			return intConstant(kind, uint64(int64(l)%int64(r))), nil
+		}
+		return intConstant(kind, l%r), nil
+	case "&":
+		return intConstant(kind, l&r), nil
+	case "|":
+		return intConstant(kind, l|r), nil
+	case "^":
+		return intConstant(kind, l^r), nil
+	case "==":
+		return boolConstant(l == r), nil
+	case "!=":
+		return boolConstant(l != r), nil
+	}
+	var less, equal bool
+	if signed {
+		less, equal = int64(l) < int64(r), l == r
+	} else {
+		less, equal = l < r, l == r
+	}
+	switch operator {
+	case "<":
+		return boolConstant(less), nil
+	case "<=":
+		return boolConstant(less || equal), nil
+	case ">":
+		return boolConstant(!less && !equal), nil
+	case ">=":
+		return boolConstant(!less), nil
+	}
+	return constant{}, errors.New("unhandled operator: " + left.String() + " " + operator + " " + right.String())
+}
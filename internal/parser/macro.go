@@ -0,0 +1,205 @@
+package parser
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"text/scanner"
+)
+
+// functionMacro is a function-like macro, ie.
+// #define MAKE_D3D11_HRESULT( code )  MAKE_HRESULT( 1, _FACD3D11, code )
+type functionMacro struct {
+	params []string
+	body   []string
+}
+
+// makeHRESULT is the macro that error and status codes are made with,
+// macros that expand it are HRESULTs
+const makeHRESULT = "MAKE_HRESULT"
+
+// hresultSrc declares MAKE_HRESULT as it is in winerror.h, which
+// isn't part of the DirectX SDK
+const hresultSrc = `#define MAKE_HRESULT(sev,fac,code) \
+    ((HRESULT) (((unsigned long)(sev)<<31) | ((unsigned long)(fac)<<16) | ((unsigned long)(code))) )`
+
+// textSrc declares the TEXT macros as they are in winnt.h, strings
+// are wide strings if UNICODE is defined
+const textSrc = `#ifdef UNICODE
+#define __TEXT(quote) L##quote
+#else
+#define __TEXT(quote) quote
+#endif
+#define TEXT(quote) __TEXT(quote)`
+
+// maxExpansionDepth is the maximum number of nested macro expansions,
+// this stops macros that expand to themselves from never finishing
+const maxExpansionDepth = 32
+
+// parseFunctionMacro parses the parameters and body of a function-like
+// macro, the current token is the ( after the macro identifier
+func (p *parser) parseFunctionMacro(ident string) {
+	oldWhitespace := p.Whitespace
+	oldError := p.Error
+	p.Whitespace &^= 1 << '\n'
+	// NOTE: Scanner errors are ignored as the body can contain
+	// things like "0x##l", see skipLine
+	p.Error = func(s *scanner.Scanner, msg string) {}
+	defer func() {
+		p.Whitespace = oldWhitespace
+		p.Error = oldError
+	}()
+
+	macro := functionMacro{}
+	for {
+		tok := p.Scan()
+		v := p.TokenText()
+		if tok == scanner.EOF || v == "\n" {
+			p.diagnosticf(p.Position, SeverityWarning, "unexpected end of function-like macro parameters")
+			return
+		}
+		if v == ")" {
+			break
+		}
+		if v == "," || v == "\\" {
+			continue
+		}
+		macro.params = append(macro.params, v)
+	}
+	for {
+		tok := p.Scan()
+		v := p.TokenText()
+		if tok == scanner.EOF || v == "\n" {
+			break
+		}
+		if v == "\\" {
+			if p.Peek() == '\n' {
+				// Line continuation
+				p.Next()
+			}
+			continue
+		}
+		macro.body = append(macro.body, v)
+	}
+	p.symbols.functionMacros[ident] = macro
+}
+
+// hasMacroCall returns true if the tokens call a function-like macro
+func (symbols *symbolTable) hasMacroCall(tokens []string) bool {
+	for i := 0; i+1 < len(tokens); i++ {
+		if _, ok := symbols.functionMacros[tokens[i]]; ok && tokens[i+1] == "(" {
+			return true
+		}
+	}
+	return false
+}
+
+// expandMacros replaces calls to function-like macros in the tokens with
+// the body of the macro. hresult is true if MAKE_HRESULT was expanded.
+func (symbols *symbolTable) expandMacros(tokens []string) (r []string, hresult bool, err error) {
+	return symbols.expand(tokens, 0)
+}
+
+func (symbols *symbolTable) expand(tokens []string, depth int) (r []string, hresult bool, err error) {
+	if depth > maxExpansionDepth {
+		return nil, false, errors.New("macro expansion is nested too deeply")
+	}
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		macro, ok := symbols.functionMacros[t]
+		if !ok || i+1 >= len(tokens) || tokens[i+1] != "(" {
+			r = append(r, t)
+			continue
+		}
+		args, end, err := macroArgs(tokens, i+1)
+		if err != nil {
+			return nil, false, errors.New(t + ": " + err.Error())
+		}
+		if len(args) != len(macro.params) && !(len(macro.params) == 0 && len(args) == 1 && len(args[0]) == 0) {
+			return nil, false, errors.New(t + ": expected " + strconv.Itoa(len(macro.params)) + " arguments, got " + strconv.Itoa(len(args)))
+		}
+		body := macro.substitute(args)
+		expanded, isHRESULT, err := symbols.expand(body, depth+1)
+		if err != nil {
+			return nil, false, err
+		}
+		if t == makeHRESULT || isHRESULT {
+			hresult = true
+		}
+		r = append(r, expanded...)
+		i = end
+	}
+	return r, hresult, nil
+}
+
+// substitute returns the body of the macro with the parameters replaced
+// by the arguments. "#param" is replaced by the argument as a string and
+// "a ## b" pastes the tokens together.
+func (macro functionMacro) substitute(args [][]string) []string {
+	var r []string
+	paste := false
+	for i := 0; i < len(macro.body); i++ {
+		t := macro.body[i]
+		if t == "#" && i+1 < len(macro.body) && macro.body[i+1] == "#" {
+			paste = true
+			i++
+			continue
+		}
+		stringize := false
+		if t == "#" && i+1 < len(macro.body) && macro.param(macro.body[i+1]) != -1 {
+			stringize = true
+			i++
+			t = macro.body[i]
+		}
+		tokens := []string{t}
+		if param := macro.param(t); param != -1 {
+			tokens = args[param]
+		}
+		if stringize {
+			tokens = []string{strconv.Quote(strings.Join(tokens, " "))}
+		}
+		if paste && len(r) > 0 && len(tokens) > 0 {
+			r[len(r)-1] += tokens[0]
+			tokens = tokens[1:]
+		}
+		paste = false
+		r = append(r, tokens...)
+	}
+	return r
+}
+
+// param returns the index of the parameter with the name, or -1
+func (macro functionMacro) param(name string) int {
+	for i, param := range macro.params {
+		if param == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// macroArgs returns the tokens of each argument of the macro call that
+// starts with the ( at tokens[start], and the index of the closing )
+func macroArgs(tokens []string, start int) (args [][]string, end int, err error) {
+	var arg []string
+	depth := 0
+	for i := start + 1; i < len(tokens); i++ {
+		switch t := tokens[i]; t {
+		case "(":
+			depth++
+		case ")":
+			if depth == 0 {
+				return append(args, arg), i, nil
+			}
+			depth--
+		case ",":
+			if depth == 0 {
+				args = append(args, arg)
+				arg = nil
+				continue
+			}
+		}
+		arg = append(arg, tokens[i])
+	}
+	return nil, 0, errors.New("missing ) for macro arguments")
+}
@@ -1,635 +1,1167 @@
 package parser
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-	"os"
+	"math"
 	"strconv"
 	"strings"
 	"text/scanner"
-	"unicode"
-	"unicode/utf8"
 
 	"github.com/silbinarywolf/directx-bind-gen/internal/types"
 	"github.com/silbinarywolf/directx-bind-gen/internal/typetrans"
 )
 
-var precedence = map[string]int{
-	"(":  1,
-	")":  1,
-	"||": 2,
-	"&&": 2,
-	"==": 3,
-	"!=": 3, // NOTE(Jae): 2018(?) - Didn't check this against other langs
-	// NOTE(Jae): 2020-02-18
-	// Need << and >> to have a precdence lower than +, -, /, *
-	// otherwise DXGI_USAGE_SHADER_INPUT ends up not being expected 16
-	// (im unsure of if this means the parentheses are handled incorrectly
-	// but whatever for this use-case for now)
-	"<<": 4,
-	">>": 4,
-	"+":  5,
-	"-":  5,
-	"/":  5,
-	"*":  5,
-	// NOTE(Jae): 2020-02-18
-	// Everything under here is naively copied from and untested
-	// https://en.wikipedia.org/wiki/Operators_in_C_and_C%2B%2B
-	"<":  9,
-	"<=": 9,
-	">":  9,
-	">=": 9,
+type parser struct {
+	scanner.Scanner
+
+	file types.File
+
+	// decl is the declaration currently being parsed, this is
+	// used to give context to diagnostics
+	decl        string
+	diagnostics []Diagnostic
+	// declLine is the line that the declaration currently
+	// being parsed starts on
+	declLine int
+
+	// structIdentToGuid is used to attach GUID/IID data
+	// to a struct
+	structIdentToGuid     map[string]string
+	structIdentToBase     map[string]string
+	vtblStructIdentToData map[string]*types.Struct
+
+	// symbols are the macros of this file and the
+	// files that it includes
+	symbols *symbolTable
+
+	// comments are the comments scanned since documentation was
+	// last taken, see takeDoc
+	comments []comment
+	// doc is the documentation of the declaration being parsed
+	doc string
+	// lastDoc is the documentation of the last declaration, a
+	// comment after it on lastDocLine is added to it
+	lastDoc     *string
+	lastDocLine int
+}
+
+// Config is the configuration of the preprocessor.
+//
+// Defines and Undefines are the macros that are used to evaluate
+// conditional directives such as #if and #ifdef. Macros that are in
+// neither are unknown and all branches that depend on them are parsed.
+type Config struct {
+	// Defines are macros that are defined and their values, ie. "_MSC_VER": "1600"
+	Defines map[string]string
+	// Undefines are macros that are known to not be defined
+	Undefines []string
+
+	// IncludePaths are the folders searched for #include files
+	IncludePaths []string
+	// SkipIncludes are the names of files that aren't parsed
+	// when included, ie. "d3d10shader.h"
+	SkipIncludes []string
 }
 
-func OperatorPrecedence(operator string) int {
-	r, ok := precedence[operator]
-	if !ok {
-		panic("Invalid operator, no precedence found: " + operator)
+// bailout is used by errorf to unwind the parser to the
+// declaration that is currently being parsed
+type bailout struct{}
+
+// parse parses a DirectX header file.
+//
+// Declarations that can't be parsed are skipped and reported as
+// diagnostics.
+func parse(filename string, src []byte, pp *preprocessor) (types.File, []Diagnostic) {
+	src = pp.preprocess(filename, src)
+	p := &parser{
+		diagnostics:           pp.diagnostics,
+		structIdentToGuid:     make(map[string]string),
+		structIdentToBase:     make(map[string]string),
+		vtblStructIdentToData: make(map[string]*types.Struct),
+		symbols:               pp.symbols,
 	}
-	return r
+	p.file.Filename = filename
+	p.Init(bytes.NewReader(src))
+	p.Filename = filename
+	p.Mode = scanner.GoTokens &^ scanner.SkipComments // comments are documentation
+	p.Error = func(s *scanner.Scanner, msg string) {
+		p.diagnostics = append(p.diagnostics, Diagnostic{
+			Pos:      s.Pos(),
+			Severity: SeverityError,
+			Decl:     p.decl,
+			Msg:      msg,
+		})
+	}
+	for tok := p.Scan(); tok != scanner.EOF; tok = p.Scan() {
+		p.parseDecl()
+	}
+	p.attachTrailingDoc()
+	p.applyAdditionalData()
+	return p.file, p.diagnostics
 }
 
-func IsOperator(operator string) bool {
-	c := operator[0]
-	return c == '<' ||
-		c == '+' ||
-		c == '-' ||
-		operator == "<<" ||
-		operator == ">>" ||
-		operator == "++"
+// errorf records an error for the current token and skips the rest of
+// the declaration being parsed
+func (p *parser) errorf(format string, args ...interface{}) {
+	p.diagnosticf(p.Position, SeverityError, format, args...)
+	panic(bailout{})
 }
 
-func IsNumber(str string) bool {
-	c := str[0]
-	return c >= '0' && c <= '9'
+func (p *parser) diagnosticf(pos scanner.Position, severity Severity, format string, args ...interface{}) {
+	if !pos.IsValid() {
+		pos = p.Pos()
+	}
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Pos:      pos,
+		Severity: severity,
+		Decl:     p.decl,
+		Msg:      fmt.Sprintf(format, args...),
+	})
 }
 
-func IsIdent(str string) bool {
-	c := str[0]
-	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+// sync skips tokens until the end of the current statement or block
+// so that parsing can continue after an error
+func (p *parser) sync() {
+	for tok := p.Scan(); tok != scanner.EOF; tok = p.Scan() {
+		switch p.TokenText() {
+		case ";", "}":
+			return
+		}
+	}
 }
 
-func NumberToFloat64(str string) float64 {
-	if len(str) > 1 &&
-		str[0] == '0' &&
-		str[1] == 'x' {
-		i, err := strconv.ParseInt(str[2:], 16, 0)
-		if err != nil {
-			panic("Failed to parse hex value.")
+// parseDecl parses the declaration starting at the current token,
+// if it fails, the parser will skip to the next declaration.
+func (p *parser) parseDecl() {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+			p.sync()
+		}
+		p.decl = ""
+	}()
+
+	p.attachTrailingDoc()
+	p.doc = p.takeDoc()
+	p.declLine = p.Position.Line
+	switch p.TokenText() {
+	case "#":
+		p.Scan()
+		switch p.TokenText() {
+		case "define", "DEFINE":
+			p.parseDefine()
+		}
+	case "MIDL_INTERFACE":
+		p.decl = "MIDL_INTERFACE"
+		p.Scan()
+		if tok := p.TokenText(); tok != "(" {
+			p.errorf("unexpected token: %s after MIDL_INTERFACE macro", tok)
+		}
+		p.Scan()
+		guid := p.TokenText()
+		if guid[0] != '"' {
+			p.errorf("unexpected guid value doesn't start with \": %s", guid)
+		}
+		guid = guid[1 : len(guid)-1] // trim quotes off either side
+		p.Scan()
+		if tok := p.TokenText(); tok != ")" {
+			p.errorf("unexpected token: %s after MIDL_INTERFACE data: %s", tok, guid)
+		}
+		p.Scan()
+		structName := p.TokenText()
+		p.structIdentToGuid[structName] = guid
+		p.Scan()
+		if p.TokenText() == ":" {
+			// ie. ID3D11DeviceChild : public IUnknown
+			p.Scan()
+			if tok := p.TokenText(); tok != "public" {
+				p.errorf("unexpected token: %s after %s :, expected public", tok, structName)
+			}
+			p.Scan()
+			p.structIdentToBase[structName] = p.TokenText()
 		}
-		return float64(i)
+	case "typedef":
+		p.Scan()
+		for isTypeQualifier(p.TokenText()) {
+			// ie. "typedef const WAVEFORMATEX *PCWAVEFORMATEX;"
+			p.Scan()
+		}
+		kind := p.TokenText()
+		p.Scan()
+		name := p.TokenText()
+		p.decl = "typedef " + kind + " " + name
+		switch kind {
+		case "UINT":
+			p.file.TypeAliases = append(p.file.TypeAliases, types.TypeAlias{
+				Ident:  name,
+				Source: p.source(name),
+				Alias:  typetrans.UIntTypeTranslation().GoType,
+			})
+		case "enum":
+			p.parseEnum(name)
+		case "struct":
+			p.parseStruct(name)
+		case "interface":
+			// ignore, no-op
+		default:
+			p.parseTypeAliases(kind)
+		}
+	case "enum":
+		p.Scan()
+		name := p.TokenText()
+		p.decl = "enum " + name
+		p.parseEnum(name)
+	case "DEFINE_GUID", "EXTERN_GUID", "DEFINE_IID", "DEFINE_CLSID":
+		p.parseDefineGuid()
+	case "DECLARE_INTERFACE", "DECLARE_INTERFACE_":
+		p.parseDeclareInterface()
+	case "HRESULT":
+		p.parseFunction()
+	case "interface":
+		p.Scan()
+		if p.TokenText() == "DECLSPEC_UUID" {
+			// ie. interface DECLSPEC_UUID("81BDCBCA-64D4-426d-AE8D-AD0147F4275C") IDirect3D9;
+			p.Scan()
+			if tok := p.TokenText(); tok != "(" {
+				p.errorf("unexpected token: %s after DECLSPEC_UUID", tok)
+			}
+			p.Scan()
+			guid := p.TokenText()
+			if guid[0] != '"' {
+				p.errorf("unexpected guid value doesn't start with \": %s", guid)
+			}
+			p.Scan()
+			if tok := p.TokenText(); tok != ")" {
+				p.errorf("unexpected token: %s after DECLSPEC_UUID data: %s", tok, guid)
+			}
+			p.Scan()
+			p.structIdentToGuid[p.TokenText()] = guid[1 : len(guid)-1]
+			return
+		}
+		name := p.TokenText()
+		p.decl = "interface " + name
+		p.Scan()
+		if p.TokenText() == name {
+			// ignore pattern "typedef interface ID3D11Device ID3D11Device;"
+			return
+		}
+		if tok := p.TokenText(); tok != "{" {
+			p.errorf("unexpected token: %s for interface %s", tok, name)
+		}
+		data := types.Struct{
+			Ident:  name,
+			Source: p.source(name),
+		}
+		data.Fields = p.parseStructFields()
+		p.file.Structs = append(p.file.Structs, data)
+		p.declared(&p.file.Structs[len(p.file.Structs)-1].Doc)
 	}
-	i, err := strconv.ParseInt(str, 10, 0)
-	if err != nil {
-		panic(fmt.Sprintf("Tried to parse int and failed: %s", str))
+}
+
+// source returns the source of a declaration named ident that
+// starts at the declaration currently being parsed
+func (p *parser) source(ident string) types.Source {
+	return types.Source{
+		CIdent: ident,
+		Line:   p.declLine,
 	}
-	return float64(i)
 }
 
-func ParseFile(filename string) types.File {
-	f, err := os.Open(filename)
-	if err != nil {
-		panic(err)
+// parseTypeAliases parses the names that a typedef declares for the type,
+// the current token is the first name, ie. "*PWAVEFORMATEX" in
+// "typedef WAVEFORMATEX *PWAVEFORMATEX, *LPWAVEFORMATEX;". Qualifiers are
+// dropped as Go has no const. Typedefs of arrays, function pointers and
+// types of more than one word, ie. "unsigned long", are skipped.
+func (p *parser) parseTypeAliases(kind string) {
+	if !isIdent(kind) {
+		return
+	}
+	for {
+		depth := 0
+		for p.TokenText() == "*" || isTypeQualifier(p.TokenText()) {
+			if p.TokenText() == "*" {
+				depth++
+			}
+			p.Scan()
+		}
+		name := p.TokenText()
+		if !isIdent(name) {
+			return
+		}
+		p.Scan()
+		if tok := p.TokenText(); tok != "," && tok != ";" {
+			return
+		}
+		p.file.TypeAliases = append(p.file.TypeAliases, types.TypeAlias{
+			Ident:  name,
+			Source: p.source(name),
+			Alias:  strings.Repeat("*", depth) + kind,
+		})
+		if p.TokenText() == ";" {
+			return
+		}
+		p.Scan()
 	}
-	defer f.Close()
+}
 
-	// structIdentToGuid is used to attach GUID/IID data
-	// to a struct
-	structIdentToGuid := make(map[string]string)
-	vtblStructIdentToData := make(map[string]*types.Struct)
-
-	//
-	defineValuesMap := make(map[string]string)
-
-	var file types.File
-	file.Filename = filename
-
-	var s scanner.Scanner
-	s.Init(f)
-	s.Filename = filename
-	s.Mode = scanner.GoTokens //^= scanner.SkipComments // don't skip comments
-MainLoop:
-	for tok := s.Scan(); tok != scanner.EOF; tok = s.Scan() {
-		switch s.TokenText() {
-		case "#":
-			s.Scan()
-			switch s.TokenText() {
-			case "define", "DEFINE":
-				//constIdentPos := s.Pos()
-				s.Scan()
-				constIdent := s.TokenText()
-				if constIdent == "INTERFACE" {
-					// Ignore cases like:
-					// #undef INTERFACE
-					// #define INTERFACE ID3D10ShaderReflection1
-					continue
-				}
-				if constIdent == "IID_ID3DBlob" {
-					// Ignore cases like:
-					// - #define IID_ID3DBlob IID_ID3D10Blob
-					continue
-				}
-				// A few cases to handle:
-				// - #define _INCLUDE_H
-				// - #define D3D_CONST ( 3 )
-				// - #DEFINE DX_VERSION 455
-				var exprTokens []string
-				{
-					skipThisMacro := false
-					oldMode := s.Mode
-					oldWhitespace := s.Whitespace
-					// https://golang.org/pkg/text/scanner/#example__whitespace
-					//s.Mode ^= scanner.GoWhitespace
-					//s.Whitespace ^= 1<<'\t' | 1<<'\n' // don't skip tabs and new lines
-					// TODO(Jae): confirm this works
-					s.Whitespace ^= 1 << '\n'
-					for {
-						prevPos := s.Pos()
-						s.Scan()
-						nextPos := s.Pos()
-						v := s.TokenText()
-						v = strings.TrimSpace(v)
-						if v == "\\" {
-							continue
-						}
-						if v == "" || v == "\n" {
-							break
-						}
-						// Handle cases like:
-						// - #define MAKE_D3D11_HRESULT( code )  MAKE_HRESULT( 1, _FACD3D11, code )
-						if v == "(" {
-							// Ignore non-trivial macros like:
-							// - #define __in_range(x, y)
-							if len(exprTokens) == 0 &&
-								prevPos.Offset == nextPos.Offset-1 {
-								skipThisMacro = true
-								break
-							}
-							// Ignore non-trivial macros like:
-							// - #define MAKE_D3D11_HRESULT( code )  MAKE_HRESULT( 1, _FACD3D11, code )
-							if len(exprTokens) > 0 &&
-								IsIdent(exprTokens[len(exprTokens)-1]) &&
-								// ie. 49 == 50-1, for the case MAKE_HRESULT
-								prevPos.Column == nextPos.Column-1 {
-								skipThisMacro = true
-								break
-							}
-						}
-						exprTokens = append(exprTokens, v)
-					}
-					s.Mode = oldMode
-					s.Whitespace = oldWhitespace
-					if skipThisMacro {
-						continue MainLoop
-					}
-				}
-				if len(exprTokens) == 0 {
-					continue
-				}
+// isTypeQualifier returns true if the token is a C type qualifier
+func isTypeQualifier(tok string) bool {
+	switch tok {
+	case "const", "CONST", "volatile":
+		return true
+	}
+	return false
+}
 
-				// Based on a Pratt Expression Parser
-				// - http://journal.stuffwithstuff.com/2011/03/19/pratt-parsers-expression-parsing-made-easy/
-				infixNodes := make([]string, 0, 10)
-				{
-					//hasNumberOrOperator := false
-					parenOpenCount := 0
-					parenCloseCount := 0
-					//expectOperator := false
-					operatorNodes := make([]string, 0, 10)
-				Loop:
-					for len(exprTokens) > 0 {
-						t := exprTokens[0]
-						exprTokens = exprTokens[1:]
-						switch t {
-						//case ",":
-						// Ignore function macros like:
-						// - #define __in_range(x, y)
-						//continue MainLoop
-						case "(":
-							/*if len(infixNodes) > 0 &&
-								IsIdent(infixNodes[len(infixNodes)-1]) {
-								// Ignore "complex" macros like:
-								// - #define MAKE_D3D11_HRESULT( code )  MAKE_HRESULT( 1, _FACD3D11, code )
-								continue MainLoop
-							}*/
-							parenOpenCount++
-						case ")":
-							// If hit end
-							if parenCloseCount == 0 && parenOpenCount == 0 {
-								break Loop
-							}
-							parenCloseCount++
-							// I actually dont remember why this needs to be here.
-							// But OK. Copy-pasted from old expression evaluation code
-							// on an old compiler project
-							if len(operatorNodes) > 0 {
-								topOperatorNode := operatorNodes[len(operatorNodes)-1]
-								if topOperatorNode == "(" {
-									infixNodes = append(infixNodes, topOperatorNode)
-									operatorNodes = operatorNodes[:len(operatorNodes)-1]
-								}
-							}
-						case "L":
-							// ( 1L << (0 + 4) )
-							// Ignore for now, its to hint that this macro is:
-							// "....an integer constant which has long int type instead of int."
-							continue
-						case "UL":
-							// ( 1UL )
-							// Ignore for now, its to hint that this macro is:
-							// "....an integer constant which has unsigned long int type instead of int."
-							continue
-						case "f":
-							// add f to number, ie. "1.0f"
-							if len(infixNodes) == 0 {
-								panic("Unexpected error. Cannot add f to number for #define: " + constIdent)
-							}
-							// Ignore for now. Its a hint that this type is a float.
-							//infixNodes[len(infixNodes)-1] += "f"
-						default:
-							if IsNumber(t) || IsIdent(t) {
-								infixNodes = append(infixNodes, t)
-								continue
-							}
-							if IsOperator(t) {
-								// Handle <<, ++, etc
-								if len(operatorNodes) > 0 {
-									prevOp := operatorNodes[len(operatorNodes)-1]
-									if t == prevOp {
-										operatorNodes = operatorNodes[:len(operatorNodes)-1]
-										t += prevOp
-									}
-								}
-								// Handle operators
-								for len(operatorNodes) > 0 {
-									topOperatorNode := operatorNodes[len(operatorNodes)-1]
-									if OperatorPrecedence(topOperatorNode) < OperatorPrecedence(t) {
-										break
-									}
-									operatorNodes = operatorNodes[:len(operatorNodes)-1]
-									infixNodes = append(infixNodes, topOperatorNode)
-								}
-								operatorNodes = append(operatorNodes, t)
-								continue
-							}
-							panic("Unhandled expression token: " + t + " for #define: " + constIdent)
-						}
-					}
+// isIdent returns true if the token is an identifier
+func isIdent(tok string) bool {
+	if tok == "" || (tok[0] >= '0' && tok[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(tok); i++ {
+		if !isIdentChar(tok[i]) {
+			return false
+		}
+	}
+	return true
+}
 
-					for len(operatorNodes) > 0 {
-						topOperatorNode := operatorNodes[len(operatorNodes)-1]
-						operatorNodes = operatorNodes[:len(operatorNodes)-1]
-						infixNodes = append(infixNodes, topOperatorNode)
-					}
-					if parenOpenCount != parenCloseCount {
-						// todo(Jae): better error message
-						panic("Mismatching paren open and close count")
-					}
-				}
-				// Evaluate expression
-				stack := make([]string, 0, 10)
-				for len(infixNodes) > 0 {
-					t := infixNodes[0]
-					infixNodes = infixNodes[1:]
-					if IsNumber(t) {
-						stack = append(stack, t)
-						continue
-					}
-					if IsOperator(t) {
-						rightValue := stack[len(stack)-1]
-						stack = stack[:len(stack)-1]
-						if len(stack) == 0 {
-							//if t == "<<" {
-							//	panic("Cant prefix a value with: " + t)
-							//}
-							// Operator only, ie. -42
-							// ie. t = "-", rightValue="42"
-							stack = append(stack, t+rightValue)
-							continue
-						}
-						leftValue := stack[len(stack)-1]
-						stack = stack[:len(stack)-1]
-						leftValueFloat64 := NumberToFloat64(leftValue)
-						rightValueFloat64 := NumberToFloat64(rightValue)
-						switch t {
-						case "+":
-							result := leftValueFloat64 + rightValueFloat64
-							//fmt.Printf("Result: %v\n", result)
-							stack = append(stack, fmt.Sprintf("%v", result))
-							//panic("TODO: handle operator'ing two values together:\n" + leftValue + " " + t + " " + rightValue + " for #define: " + constIdent)
-							continue
-						case "<<":
-							result := uint64(leftValueFloat64) << uint64(rightValueFloat64)
-							//fmt.Printf("result: %d for const: %s\n", result, constIdent)
-							stack = append(stack, fmt.Sprintf("%d", result))
-						default:
-							panic("TODO: handle operator'ing two values together:\n" + leftValue + " " + t + " " + rightValue + " for #define: " + constIdent)
-						}
-						continue
-					}
-					if IsIdent(t) {
-						v, ok := defineValuesMap[t]
-						if !ok {
-							panic("Unable to find existing identifier: " + t + " for this #define: " + constIdent)
-						}
-						stack = append(stack, v)
-						continue
-					}
-					panic("Unhandled evaluation token: " + t + " for #define: " + constIdent)
-				}
-				if len(stack) == 0 {
-					panic("Unexpected error, empty stack from evaluating expression for #define: " + constIdent)
-				}
-				if len(stack) > 1 {
-					panic(fmt.Sprintf("Unexpected error, stack size is %d instead of 1 (%v) for #define: %s", len(stack), stack, constIdent))
-				}
-				result := stack[0]
-
-				defineValuesMap[constIdent] = result
-				// defineValuesMap
-				/*fmt.Printf(`
-					#define: %s
-					infix Nodes: %v
-				`, constIdent, infixNodes)
-				if len(infixNodes) > 1 {
-					panic(fmt.Sprintf("infix: %v\n", infixNodes))
-				}*/
-
-				// Add parsed macro
-				record := types.Macro{
-					Ident: constIdent,
+func (p *parser) parseDefine() {
+	p.Scan()
+	constIdentPos := p.Position
+	constIdent := p.TokenText()
+	p.decl = "#define " + constIdent
+	if constIdent == "INTERFACE" {
+		// Ignore cases like:
+		// #undef INTERFACE
+		// #define INTERFACE ID3D10ShaderReflection1
+		return
+	}
+	if constIdent == "IID_ID3DBlob" {
+		// Ignore cases like:
+		// - #define IID_ID3DBlob IID_ID3D10Blob
+		return
+	}
+	// A few cases to handle:
+	// - #define _INCLUDE_H
+	// - #define D3D_CONST ( 3 )
+	// - #DEFINE DX_VERSION 455
+	var exprTokens []string
+	{
+		skipReason := ""
+		oldMode := p.Mode
+		oldWhitespace := p.Whitespace
+		// https://golang.org/pkg/text/scanner/#example__whitespace
+		//s.Mode ^= scanner.GoWhitespace
+		//s.Whitespace ^= 1<<'\t' | 1<<'\n' // don't skip tabs and new lines
+		// TODO(Jae): confirm this works
+		p.Whitespace ^= 1 << '\n'
+		for {
+			prevPos := p.Pos()
+			p.Scan()
+			nextPos := p.Pos()
+			v := p.TokenText()
+			v = strings.TrimSpace(v)
+			if v == "\\" {
+				if p.Peek() == '\n' {
+					// Line continuation
+					p.Next()
 				}
-				record.StringValue = new(string)
-				*record.StringValue = result
-				file.Macros = append(file.Macros, record)
-			}
-		case "MIDL_INTERFACE":
-			s.Scan()
-			if tok := s.TokenText(); tok != "(" {
-				panic(s.String() + ": unexpected token: " + tok + " after MIDL_INTERFACE macro")
-			}
-			s.Scan()
-			guid := s.TokenText()
-			if guid[0] != '"' {
-				panic(s.String() + ": unexpected guid value doesn't start with \": " + guid)
+				continue
 			}
-			guid = guid[1 : len(guid)-1] // trim quotes off either side
-			s.Scan()
-			if tok := s.TokenText(); tok != ")" {
-				panic(s.String() + ": unexpected token: " + tok + " after MIDL_INTERFACE data: " + guid)
+			if v == "" || v == "\n" {
+				break
 			}
-			s.Scan()
-			structName := s.TokenText()
-			structIdentToGuid[structName] = guid
-		case "typedef":
-			s.Scan()
-			kind := s.TokenText()
-			s.Scan()
-			name := s.TokenText()
-			switch kind {
-			case "UINT":
-				file.TypeAliases = append(file.TypeAliases, types.TypeAlias{
-					Ident: name,
-					Alias: typetrans.UIntTypeTranslation().GoType,
-				})
-			case "enum":
-				s.Scan()
-				if t := s.TokenText(); t != "{" {
-					continue
+			if v == "(" {
+				// Handle function-like macros like:
+				// - #define MAKE_D3D11_HRESULT( code )  MAKE_HRESULT( 1, _FACD3D11, code )
+				// - #define X2DEFAULT(x) =x
+				if len(exprTokens) == 0 &&
+					prevPos.Offset == nextPos.Offset-1 {
+					p.Mode = oldMode
+					p.Whitespace = oldWhitespace
+					p.parseFunctionMacro(constIdent)
+					return
 				}
-				data := types.Enum{}
-				for {
-					s.Scan()
-					kind := s.TokenText()
-					if kind == "}" {
-						// This case occurs if enum has "," on last item
-						break
-					}
-					s.Scan() // =
-					if tok := s.TokenText(); tok != "=" {
-						panic(s.String() + ": unexpected token: " + tok + " after enum field value: " + kind)
-					}
-					s.Scan()
-					rawValue, isEndOfEnum := parseEnumExpr(&s, name)
-					enumField := types.EnumField{
-						Ident: kind,
-					}
-					enumField.RawValue = rawValue
-					if evalValue := tryEvaluateExpr(rawValue); evalValue != nil {
-						switch value := evalValue.(type) {
-						case string:
-							enumField.StringValue = &value
-						case uint32:
-							enumField.UInt32Value = &value
-						default:
-							panic(fmt.Sprintf("Unhandled evaluated expression type: %T", value))
-						}
-					}
-					data.Fields = append(data.Fields, enumField)
-					if isEndOfEnum {
+				// Ignore calls to unknown function-like macros like:
+				// - #define D2DERR_INSUFFICIENT_BUFFER HRESULT_FROM_WIN32(ERROR_INSUFFICIENT_BUFFER)
+				if len(exprTokens) > 0 &&
+					IsIdent(exprTokens[len(exprTokens)-1]) {
+					if _, ok := p.symbols.functionMacros[exprTokens[len(exprTokens)-1]]; !ok {
+						skipReason = "calling unknown function-like macro " + exprTokens[len(exprTokens)-1] + " is not supported"
 						break
 					}
 				}
-				s.Scan()
-				data.Ident = s.TokenText()
-				file.Enums = append(file.Enums, data)
-			case "struct":
-				s.Scan()
-				if t := s.TokenText(); t != "{" {
-					// For debugging
-					// fmt.Printf("skip struct: %s\nkind: %s\n", name, kind)
-					continue
-				}
+			}
+			exprTokens = append(exprTokens, v)
+		}
+		if skipReason != "" {
+			p.diagnosticf(constIdentPos, SeverityWarning, "%s", skipReason)
+			// Skip the rest of the macro
+			p.skipLine()
+		}
+		p.Mode = oldMode
+		p.Whitespace = oldWhitespace
+		if skipReason != "" {
+			return
+		}
+	}
+	if len(exprTokens) == 0 {
+		return
+	}
 
-				// Get struct macro header
-				//fmt.Printf("struct: %s\nkind: %s\n", name, kind)
+	exprTokens, hresult, err := p.symbols.expandMacros(exprTokens)
+	if err != nil {
+		p.diagnosticf(constIdentPos, SeverityError, "%s", err)
+		return
+	}
+	if len(exprTokens) == 1 && p.symbols.hresults[exprTokens[0]] {
+		// ie. #define D3D10_ERROR_FILE_NOT_FOUND D3D11_ERROR_FILE_NOT_FOUND
+		hresult = true
+	}
+	result, err := evaluateExpr(exprTokens, p.symbols.lookupValue)
+	if err != nil {
+		p.diagnosticf(constIdentPos, SeverityError, "%s", err)
+		return
+	}
+	p.symbols.values[constIdent] = result
+	p.symbols.hresults[constIdent] = hresult
 
-				// Get struct fields
-				data := types.Struct{
-					Ident: name,
-				}
-				data.Fields = parseStructFields(&s)
-				s.Scan() // Scan and get struct name again
-				s.Scan() // ;
-				if tok := s.TokenText(); tok != ";" {
-					panic(s.String() + ": unexpected token: " + tok + " at end of struct: " + data.Ident + "expected ;")
-				}
+	// Add parsed macro
+	record := types.Macro{
+		Ident:   constIdent,
+		Source:  p.source(constIdent),
+		HRESULT: hresult,
+	}
+	record.StringValue = new(string)
+	*record.StringValue = result.String()
+	record.Const = result.toConst()
+	p.file.Macros = append(p.file.Macros, record)
+	p.declared(&p.file.Macros[len(p.file.Macros)-1].Doc)
+}
 
-				isVtbl := len(data.Fields) > 0 && data.Fields[0].Name == "BEGIN_INTERFACE"
-				if isVtbl {
-					data.Fields = data.Fields[1:]
-				}
-				if isVtbl {
-					vtblStructIdentToData[data.Ident] = &data
-				} else {
-					file.Structs = append(file.Structs, data)
-				}
-			case "interface":
-				// ignore, no-op
-			default:
-				nameRuneValue, _ := utf8.DecodeRuneInString(name[0:])
-				runeValue, _ := utf8.DecodeRuneInString(kind[0:])
-				if unicode.IsLetter(runeValue) &&
-					unicode.IsLetter(nameRuneValue) {
-					file.TypeAliases = append(file.TypeAliases, types.TypeAlias{
-						Ident: name,
-						Alias: kind,
-					})
-				}
-				// Ignore tokens: read type until end of line
-				///*line := s.Line
-				//for tok := s.Scan(); tok != scanner.EOF && line == s.Line; tok = s.Scan() {
-				//	// scan until end of line
-				//}*/
+func (p *parser) parseEnum(name string) {
+	if name != "{" {
+		// Not an anonymous enum, ie. "typedef enum { ... } D3DX11_FILTER_FLAG"
+		p.Scan()
+	}
+	if t := p.TokenText(); t != "{" {
+		return
+	}
+	data := types.Enum{}
+	// next is the value of an enumerator without an initialiser,
+	// it's one more than the previous enumerator
+	next := intConstant(kindInt, 0)
+	nextRaw, hasNext := "0", true
+	// endLine is the line that the last field ended on, comments
+	// after it on the same line are its documentation
+	endLine := 0
+	for {
+		p.Scan()
+		kind := p.TokenText()
+		if endLine > 0 {
+			field := &data.Fields[len(data.Fields)-1]
+			field.Doc = appendDoc(field.Doc, p.takeTrailingDoc(endLine))
+			endLine = 0
+		}
+		if kind == "}" {
+			// This case occurs if enum has "," on last item
+			break
+		}
+		enumField := types.EnumField{
+			Ident: kind,
+			Source: types.Source{
+				CIdent: kind,
+				Line:   p.Position.Line,
+			},
+			Doc: p.takeDoc(),
+		}
+		fieldLine := p.Position.Line
+		p.Scan()
+		isEndOfEnum := false
+		var value constant
+		ok := false
+		switch tok := p.TokenText(); tok {
+		case "=":
+			p.Scan()
+			var exprTokens []string
+			exprTokens, isEndOfEnum = p.parseEnumExpr()
+			var err error
+			enumField.RawValue, value, ok, err = p.evaluateEnumExpr(exprTokens)
+			if err != nil {
+				p.errorf("cannot evaluate enum field value: %s, error: %s", enumField.RawValue, err)
 			}
-		case "HRESULT":
-			// Parse functions
-			s.Scan()
-			if tok := s.TokenText(); tok != "WINAPI" {
-				// Ignore if not a function
-				// Expecting pattern "HRESULT WINAPI"
-				continue
+		case ",", "}":
+			// ie. D3D_BLOB_INPUT_SIGNATURE_BLOB,
+			isEndOfEnum = tok == "}"
+			enumField.RawValue = nextRaw
+			value, ok = next, hasNext
+		default:
+			p.errorf("unexpected token: %s after enum field: %s", tok, kind)
+		}
+		if ok {
+			v := uint32(value.bits)
+			enumField.UInt32Value = &v
+			enumField.Const = value.toConst()
+			p.symbols.enumerators[kind] = value
+			next, _ = evaluateBinary("+", value, intConstant(kindInt, 1))
+			nextRaw, hasNext = next.String(), true
+		} else {
+			// The value isn't known, so the next value is
+			// an expression of this field, ie. "FIELD + 1"
+			nextRaw, hasNext = kind+" + 1", false
+		}
+		data.Fields = append(data.Fields, enumField)
+		if isEndOfEnum {
+			// ie. "D3D11_CREATE_DEVICE_BGRA_SUPPORT = 0x20 // comment" before }
+			field := &data.Fields[len(data.Fields)-1]
+			field.Doc = appendDoc(field.Doc, p.takeTrailingDoc(fieldLine))
+			break
+		}
+		endLine = p.Position.Line
+	}
+	p.Scan()
+	data.Ident = p.TokenText()
+	if data.Ident == ";" {
+		// Enums without a typedef, ie. "enum _D3DX11_ERR { ... };"
+		data.Ident = name
+	}
+	data.Source = p.source(data.Ident)
+	if data.Ident == "{" {
+		// The fields of anonymous enums are constants, ie.
+		// enum { DSBCAPS_ALL = 0x1 };
+		for _, field := range data.Fields {
+			record := types.Macro{
+				Ident:  field.Ident,
+				Source: field.Source,
+				Doc:    field.Doc,
 			}
-			s.Scan()
-			funcName := s.TokenText()
-			s.Scan()
-			if tok := s.TokenText(); tok != "(" {
-				panic(s.String() + ": unexpected token: " + tok + " after function name: " + funcName)
+			record.StringValue = new(string)
+			*record.StringValue = field.RawValue
+			if field.Const != nil {
+				record.Const = field.Const
+				*record.StringValue = strconv.FormatInt(field.Const.Int64, 10)
+				if field.Const.Kind == types.ConstUint64 {
+					*record.StringValue = strconv.FormatUint(field.Const.Uint64, 10)
+				}
 			}
-			parameters := parseFunctionPointerParameterFields(&s)
-			if tok := s.TokenText(); tok != ")" {
-				panic(s.String() + ": unexpected token: " + tok + " after function parameters for: " + funcName)
+			p.file.Macros = append(p.file.Macros, record)
+		}
+		return
+	}
+	p.file.Enums = append(p.file.Enums, data)
+	p.declared(&p.file.Enums[len(p.file.Enums)-1].Doc)
+}
+
+func (p *parser) parseStruct(name string) {
+	p.Scan()
+	if t := p.TokenText(); t != "{" {
+		// For debugging
+		// fmt.Printf("skip struct: %s\nkind: %s\n", name, kind)
+		return
+	}
+
+	// Get struct fields
+	data := types.Struct{
+		Ident: name,
+	}
+	data.Fields = p.parseStructFields()
+	p.Scan() // Scan and get struct name again
+	if typedefName := p.TokenText(); typedefName != ";" && typedefName != name {
+		// Use the typedef name rather than the tag, ie.
+		// typedef struct _D3D11_SHADER_DESC { ... } D3D11_SHADER_DESC;
+		data.Ident = typedefName
+	}
+	data.Source = p.source(data.Ident)
+	p.Scan() // ;
+	if tok := p.TokenText(); tok != ";" {
+		p.errorf("unexpected token: %s at end of struct: %s, expected ;", tok, data.Ident)
+	}
+
+	isVtbl := len(data.Fields) > 0 && data.Fields[0].Name == "BEGIN_INTERFACE"
+	if isVtbl {
+		data.Fields = data.Fields[1:]
+	}
+	if isVtbl {
+		p.vtblStructIdentToData[data.Ident] = &data
+		p.declared(&data.Doc)
+	} else {
+		p.file.Structs = append(p.file.Structs, data)
+		p.declared(&p.file.Structs[len(p.file.Structs)-1].Doc)
+	}
+}
+
+func (p *parser) parseFunction() {
+	// Parse functions
+	p.Scan()
+	if tok := p.TokenText(); tok != "WINAPI" {
+		// Ignore if not a function
+		// Expecting pattern "HRESULT WINAPI"
+		return
+	}
+	p.Scan()
+	funcName := p.TokenText()
+	p.decl = "function " + funcName
+	p.Scan()
+	if tok := p.TokenText(); tok != "(" {
+		p.errorf("unexpected token: %s after function name: %s", tok, funcName)
+	}
+	parameters := p.parseFunctionPointerParameterFields()
+	if tok := p.TokenText(); tok != ")" {
+		p.errorf("unexpected token: %s after function parameters for: %s", tok, funcName)
+	}
+	p.Scan()
+	if tok := p.TokenText(); tok != ";" {
+		p.errorf("unexpected token: %s after function parameters for: %s", tok, funcName)
+	}
+	p.file.Functions = append(p.file.Functions, types.Function{
+		Ident:      funcName,
+		Source:     p.source(funcName),
+		DLLCall:    funcName,
+		Parameters: parameters,
+	})
+	p.declared(&p.file.Functions[len(p.file.Functions)-1].Doc)
+}
+
+// parseDefineGuid parses a named GUID, ie.
+//
+// DEFINE_GUID(IID_ID3D11ShaderReflection, 0x0a233719, 0x3960, 0x4578, 0x9d, 0x7c, 0x20, 0x3b, 0x8b, 0x1d, 0x9c, 0xc1);
+// DEFINE_IID(IXAPO, A90BC001, E897, E897, 55, E4, 9E, 47, 00, 00, 00, 00);
+func (p *parser) parseDefineGuid() {
+	macro := p.TokenText()
+	p.Scan()
+	if tok := p.TokenText(); tok != "(" {
+		p.errorf("unexpected token: %s after %s", tok, macro)
+	}
+	p.Scan()
+	name := p.TokenText()
+	p.decl = macro + " " + name
+	if !IsIdent(name) {
+		p.errorf("unexpected token: %s, expected GUID name", name)
+	}
+
+	// The values of DEFINE_IID and DEFINE_CLSID don't have a 0x prefix
+	// so scanner errors are ignored, ie. "09" is not valid octal
+	var values []string
+	{
+		oldError := p.Error
+		p.Error = func(s *scanner.Scanner, msg string) {}
+		defer func() {
+			p.Error = oldError
+		}()
+		p.Scan()
+		if tok := p.TokenText(); tok != "," {
+			p.errorf("unexpected token: %s after GUID name, expected ,", tok)
+		}
+		value := ""
+	ValueLoop:
+		for {
+			if tok := p.Scan(); tok == scanner.EOF {
+				p.errorf("unexpected end of file, expected )")
 			}
-			s.Scan()
-			if tok := s.TokenText(); tok != ";" {
-				panic(s.String() + ": unexpected token: " + tok + " after function parameters for: " + funcName)
+			switch tok := p.TokenText(); tok {
+			case ",", ")":
+				values = append(values, value)
+				value = ""
+				if tok == ")" {
+					break ValueLoop
+				}
+			default:
+				value += tok
 			}
-			file.Functions = append(file.Functions, types.Function{
-				Ident:      funcName,
-				DLLCall:    funcName,
-				Parameters: parameters,
-			})
-		case "interface":
-			s.Scan()
-			name := s.TokenText()
-			s.Scan()
-			if s.TokenText() == name {
-				// ignore pattern "typedef interface ID3D11Device ID3D11Device;"
-				continue
+		}
+	}
+
+	// ie. "0a233719-3960-4578-9d7c-203b8b1d9cc1"
+	digits := [...]int{8, 4, 4, 2, 2, 2, 2, 2, 2, 2, 2}
+	if len(values) != len(digits) {
+		p.errorf("expected %d values in %s, got %d", len(digits), macro, len(values))
+	}
+	var guid strings.Builder
+	for i, value := range values {
+		switch i {
+		case 1, 2, 3, 5:
+			guid.WriteByte('-')
+		}
+		value = strings.TrimPrefix(strings.TrimPrefix(value, "0x"), "0X")
+		v, err := strconv.ParseUint(value, 16, digits[i]*4)
+		if err != nil {
+			p.errorf("cannot parse GUID value: %s, error: %s", values[i], err)
+		}
+		fmt.Fprintf(&guid, "%0*x", digits[i], v)
+	}
+
+	record := types.Guid{
+		Ident: name,
+		GUID:  guid.String(),
+	}
+	switch macro {
+	case "DEFINE_IID":
+		// Also declares the GUID of the interface, ie. "__uuidof(IXAPO)"
+		p.structIdentToGuid[name] = record.GUID
+		record.Ident = "IID_" + name
+	case "DEFINE_CLSID":
+		record.Ident = "CLSID_" + name
+	}
+	record.Source = p.source(record.Ident)
+	p.file.Guids = append(p.file.Guids, record)
+}
+
+// parseDeclareInterface parses COM interfaces declared with the
+// macros from objbase.h, ie.
+//
+// DECLARE_INTERFACE_(IXAudio2, IUnknown)
+//
+//	{
+//	    STDMETHOD(GetDeviceCount) (THIS_ __out UINT32* pCount) PURE;
+//	    STDMETHOD_(ULONG, AddRef) (THIS) PURE;
+//	};
+func (p *parser) parseDeclareInterface() {
+	isDerived := p.TokenText() == "DECLARE_INTERFACE_"
+	p.Scan()
+	if tok := p.TokenText(); tok != "(" {
+		p.errorf("unexpected token: %s after DECLARE_INTERFACE macro", tok)
+	}
+	p.Scan()
+	name := p.TokenText()
+	p.decl = "interface " + name
+	if !IsIdent(name) {
+		p.errorf("unexpected token: %s, expected interface name", name)
+	}
+	base := ""
+	if isDerived {
+		p.Scan()
+		if tok := p.TokenText(); tok != "," {
+			p.errorf("unexpected token: %s after interface name: %s, expected ,", tok, name)
+		}
+		p.Scan()
+		base = p.TokenText()
+	}
+	p.Scan()
+	if tok := p.TokenText(); tok != ")" {
+		p.errorf("unexpected token: %s after DECLARE_INTERFACE data: %s", tok, name)
+	}
+	p.Scan()
+	if tok := p.TokenText(); tok != "{" {
+		p.errorf("unexpected token: %s after DECLARE_INTERFACE, expected {", tok)
+	}
+	vtbl := &types.Struct{
+		Ident:  name + "Vtbl",
+		Source: p.source(name + "Vtbl"),
+	}
+	// endLine is the line that the last method ended on, comments
+	// after it on the same line are its documentation
+	endLine := 0
+	for {
+		if tok := p.Scan(); tok == scanner.EOF {
+			p.errorf("unexpected end of file, expected }")
+		}
+		if endLine > 0 {
+			method := &vtbl.Fields[len(vtbl.Fields)-1]
+			method.Doc = appendDoc(method.Doc, p.takeTrailingDoc(endLine))
+			endLine = 0
+		}
+		tok := p.TokenText()
+		if tok == "}" {
+			break
+		}
+		doc := p.takeDoc()
+		if _, ok := p.symbols.functionMacros[tok]; ok {
+			// ie. Declare_IXAudio2Voice_Methods();
+			vtbl.Fields = append(vtbl.Fields, p.expandMethods(name)...)
+			continue
+		}
+		if method, ok := p.parseMethod(name); ok {
+			method.Doc = doc
+			vtbl.Fields = append(vtbl.Fields, method)
+			endLine = p.Position.Line
+		}
+	}
+	p.Scan()
+	if tok := p.TokenText(); tok != ";" {
+		p.errorf("unexpected token: %s at end of interface: %s, expected ;", tok, name)
+	}
+	if base != "" {
+		baseVtbl, ok := p.symbols.interfaces[base]
+		if !ok {
+			p.diagnosticf(scanner.Position{}, SeverityWarning, "unknown base interface: %s, its methods are missing", base)
+		} else {
+			vtbl.Fields = inheritMethods(name, baseVtbl.Fields, vtbl.Fields)
+		}
+	}
+	p.symbols.interfaces[name] = vtbl
+
+	// Declare the same way as the C version of MIDL interfaces, ie.
+	// interface ID3D11DeviceChild { CONST_VTBL struct ID3D11DeviceChildVtbl *lpVtbl; };
+	vtblIdent := "CONST_VTBL struct " + vtbl.Ident
+	p.file.Structs = append(p.file.Structs, types.Struct{
+		Ident:  name,
+		Source: p.source(name),
+		Fields: []types.StructField{
+			{
+				Name: "lpVtbl",
+				TypeInfo: types.NewPointer(vtblIdent, types.Pointer{
+					TypeInfo: types.NewBasicType(vtblIdent, types.BasicType{}),
+					Depth:    1,
+				}),
+			},
+		},
+		VtblStruct: vtbl,
+		Base:       base,
+	})
+	p.declared(&p.file.Structs[len(p.file.Structs)-1].Doc)
+}
+
+// parseMethod parses a STDMETHOD or STDMETHOD_ method of an interface,
+// the method is returned as a function pointer field like in MIDL vtbls.
+// Function-like macros defined in the interface are kept so that calls
+// to them can be expanded, see expandMethods. Anything else is skipped.
+//
+// If a method can't be parsed, the whole interface is skipped as
+// the vtbl would have the wrong layout without it.
+func (p *parser) parseMethod(interfaceName string) (types.StructField, bool) {
+	pos := p.Position
+	switch macro := p.TokenText(); macro {
+	case "#":
+		// ie. #define Declare_IXAudio2Voice_Methods() \
+		p.Scan()
+		if p.TokenText() != "define" {
+			p.skipLine()
+			return types.StructField{}, false
+		}
+		p.Scan()
+		ident := p.TokenText()
+		if !IsIdent(ident) || p.Peek() != '(' {
+			p.skipLine()
+			return types.StructField{}, false
+		}
+		p.Scan()
+		p.parseFunctionMacro(ident)
+		return types.StructField{}, false
+	case "STDMETHOD", "STDMETHOD_":
+		p.Scan()
+		if tok := p.TokenText(); tok != "(" {
+			p.errorf("unexpected token: %s after %s", tok, macro)
+		}
+		if macro == "STDMETHOD_" {
+			// Skip return type, ie. STDMETHOD_(ULONG, AddRef)
+			for depth := 0; ; {
+				if scanTok := p.Scan(); scanTok == scanner.EOF {
+					p.errorf("unexpected end of file in return type of method")
+				}
+				switch p.TokenText() {
+				case "(":
+					depth++
+				case ")":
+					depth--
+				}
+				if p.TokenText() == "," && depth == 0 {
+					break
+				}
 			}
-			if tok := s.TokenText(); tok != "{" {
-				panic(s.String() + ": unexpected token: " + tok + " for interface " + name)
+		}
+		p.Scan()
+		name := p.TokenText()
+		p.Scan()
+		if tok := p.TokenText(); tok != ")" {
+			p.errorf("unexpected token: %s after method name: %s", tok, name)
+		}
+		p.Scan()
+		if tok := p.TokenText(); tok != "(" {
+			p.errorf("unexpected token: %s after method name: %s, expected (", tok, name)
+		}
+		// NOTE: Some methods in XAudio2.h and dsound.h are missing THIS_,
+		// This is still passed when they are called from C++
+		params := p.parseFunctionPointerParameterFields()
+		params = append([]types.StructField{thisParameter(interfaceName)}, params...)
+		p.Scan()
+		if p.TokenText() == "PURE" {
+			p.Scan()
+		}
+		if tok := p.TokenText(); tok != ";" {
+			p.errorf("unexpected token: %s after method: %s, expected ;", tok, name)
+		}
+		return types.StructField{
+			TypeInfo: types.NewFunctionPointer(types.FunctionPointer{
+				Parameters: params,
+			}),
+			Name: name,
+		}, true
+	default:
+		// ie. Declare_IXAudio2Voice_Methods();
+		for p.TokenText() != ";" {
+			if p.TokenText() == "}" {
+				p.errorf("unexpected token: } in interface: %s, expected ;", interfaceName)
 			}
-			data := types.Struct{
-				Ident: name,
+			if tok := p.Scan(); tok == scanner.EOF {
+				p.errorf("unexpected end of file, expected ;")
 			}
-			data.Fields = parseStructFields(&s)
-			file.Structs = append(file.Structs, data)
 		}
+		p.diagnosticf(pos, SeverityWarning, "skipped %s, only STDMETHOD and STDMETHOD_ are supported in interfaces", macro)
+		return types.StructField{}, false
 	}
+}
+
+// expandMethods parses the methods that a call to a function-like
+// macro in an interface expands to, ie. in XAudio2.h
+//
+//	#define Declare_IXAudio2Voice_Methods() \
+//	    STDMETHOD_(void, GetVoiceDetails) (THIS_ __out XAUDIO2_VOICE_DETAILS* pVoiceDetails) PURE; \
+//	    ...
+//
+//	DECLARE_INTERFACE_(IXAudio2SourceVoice, IXAudio2Voice)
+//	{
+//	    Declare_IXAudio2Voice_Methods();
+//	    ...
+//	};
+//
+// Diagnostics for the expanded methods are reported at the call.
+func (p *parser) expandMethods(interfaceName string) []types.StructField {
+	pos := p.Position
+	call := []string{p.TokenText()}
+	for {
+		if tok := p.Scan(); tok == scanner.EOF {
+			p.errorf("unexpected end of file, expected ;")
+		}
+		tok := p.TokenText()
+		if tok == "}" {
+			p.errorf("unexpected token: } in interface: %s, expected ;", interfaceName)
+		}
+		// The ; ends the last method, ie. "STDMETHOD_(void, DestroyVoice) (THIS) PURE"
+		call = append(call, tok)
+		if tok == ";" {
+			break
+		}
+	}
+	tokens, _, err := p.symbols.expandMacros(call)
+	if err != nil {
+		p.errorf("cannot expand %s: %s", call[0], err)
+	}
+
+	m := &parser{
+		decl:    p.decl,
+		symbols: p.symbols,
+	}
+	m.Init(strings.NewReader(strings.Join(tokens, " ")))
+	m.Filename = pos.Filename
+	m.Mode = p.Mode
+	m.Error = func(s *scanner.Scanner, msg string) {
+		m.diagnosticf(pos, SeverityError, "%s", msg)
+	}
+	defer func() {
+		for _, d := range m.diagnostics {
+			d.Pos = pos
+			p.diagnostics = append(p.diagnostics, d)
+		}
+	}()
+	var methods []types.StructField
+	for tok := m.Scan(); tok != scanner.EOF; tok = m.Scan() {
+		if m.TokenText() == ";" {
+			continue
+		}
+		if method, ok := m.parseMethod(interfaceName); ok {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// skipLine skips the rest of the current line, lines
+// ending with \ are also skipped. Scanner errors are ignored
+// as macros can contain things like "0x##l".
+func (p *parser) skipLine() {
+	oldWhitespace := p.Whitespace
+	oldError := p.Error
+	p.Whitespace &^= 1 << '\n'
+	p.Error = func(s *scanner.Scanner, msg string) {}
+	for {
+		if tok := p.Scan(); tok == scanner.EOF || tok == '\n' {
+			break
+		}
+		if p.TokenText() == "\\" && p.Peek() == '\n' {
+			// Skip new line after line continuation
+			p.Next()
+		}
+	}
+	p.Whitespace = oldWhitespace
+	p.Error = oldError
+}
+
+// skipParens skips to the ) that closes the current ( token
+func (p *parser) skipParens() {
+	for depth := 1; depth > 0; {
+		if tok := p.Scan(); tok == scanner.EOF {
+			p.errorf("unexpected end of file, expected )")
+		}
+		switch p.TokenText() {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+	}
+}
+
+// thisParameter returns the first parameter of a method,
+// ie. "ID3D11DeviceChild * This"
+func thisParameter(interfaceName string) types.StructField {
+	return types.StructField{
+		Name: "This",
+		TypeInfo: types.NewPointer(interfaceName, types.Pointer{
+			TypeInfo: types.NewBasicType(interfaceName, types.BasicType{}),
+			Depth:    1,
+		}),
+	}
+}
+
+// inheritMethods adds the methods of the base interface to the methods
+// of the derived interface if they aren't redeclared. The methods of
+// IUnknown are normally redeclared, but derived interfaces like
+// IXAudio2SourceVoice don't redeclare the methods of IXAudio2Voice.
+func inheritMethods(interfaceName string, baseMethods []types.StructField, methods []types.StructField) []types.StructField {
+	isRedeclared := len(methods) >= len(baseMethods)
+	for i := 0; isRedeclared && i < len(baseMethods); i++ {
+		isRedeclared = baseMethods[i].Name == methods[i].Name
+	}
+	if isRedeclared {
+		return methods
+	}
+	r := make([]types.StructField, 0, len(baseMethods)+len(methods))
+	for _, method := range baseMethods {
+		baseTypeInfo := method.TypeInfo.Type.(*types.FunctionPointer)
+		params := make([]types.StructField, len(baseTypeInfo.Parameters))
+		copy(params, baseTypeInfo.Parameters)
+		params[0] = thisParameter(interfaceName)
+		method.TypeInfo = types.NewFunctionPointer(types.FunctionPointer{
+			Parameters: params,
+		})
+		r = append(r, method)
+	}
+	return append(r, methods...)
+}
 
-	// Apply additional data
-	for i := 0; i < len(file.Structs); i++ {
-		record := &file.Structs[i]
+// applyAdditionalData attaches GUIDs and vtbls to structs
+func (p *parser) applyAdditionalData() {
+	for i := 0; i < len(p.file.Structs); i++ {
+		record := &p.file.Structs[i]
 
 		// Apply GUID data to struct (if it exists)
-		if guid, ok := structIdentToGuid[record.Ident]; ok {
+		if guid, ok := p.structIdentToGuid[record.Ident]; ok {
 			record.GUID = guid
 		}
+		if base, ok := p.structIdentToBase[record.Ident]; ok {
+			record.Base = base
+		}
 
 		// NOTE(Jae): 2020-01-26
 		// A bit of a hack to determine the name. Should probably make
 		// this more robust but we'll see!
 		determineVtblName := record.Ident + "Vtbl"
-		if vtblStruct, ok := vtblStructIdentToData[determineVtblName]; ok {
+		if vtblStruct, ok := p.vtblStructIdentToData[determineVtblName]; ok {
 			record.VtblStruct = vtblStruct
+			p.symbols.interfaces[record.Ident] = vtblStruct
 		}
 	}
-
-	return file
 }
 
 // parsePointerDepth will return 1 = *, 2 = **, 3 = ***, etc
-func parsePointerDepth(s *scanner.Scanner) int {
+func (p *parser) parsePointerDepth() int {
 	r := 0
-	for t := s.TokenText(); t == "*"; t = s.TokenText() {
-		s.Scan()
+	for t := p.TokenText(); t == "*"; t = p.TokenText() {
+		p.Scan()
 		r++
 	}
 	return r
 }
 
-func parseEnumExpr(s *scanner.Scanner, enumIdent string) (string, bool) {
-	value := ""
+func (p *parser) parseEnumExpr() ([]string, bool) {
+	var tokens []string
+	depth := 0
 	for {
-		value += s.TokenText()
-		s.Scan()
-		switch tok := s.TokenText(); tok {
+		switch p.TokenText() {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		tokens = append(tokens, p.TokenText())
+		tok := p.Scan()
+		if tok == scanner.EOF {
+			p.errorf("unexpected end of file in enum field value: %s", strings.Join(tokens, ""))
+		}
+		switch tok := p.TokenText(); tok {
 		case ",":
-			return value, false
+			// Commas in parens separate the arguments of macros
+			if depth == 0 {
+				return tokens, false
+			}
 		case "}":
-			return value, true
+			return tokens, true
 		}
 	}
 }
 
-func tryEvaluateExpr(expr string) interface{} {
-	if len(expr) >= 3 && expr[1] == 'x' {
-		// Parse 0x1, 0x11, 0x1234, etc
-		expr = expr[2:]
-		if expr[len(expr)-1:] == "L" {
-			expr = expr[:len(expr)-1]
-		}
-		switch len(expr) {
-		case 1, 2:
-			i, err := strconv.ParseUint(expr, 16, 8)
-			if err != nil {
-				panic(err)
-			}
-			return uint32(i)
-		case 3, 4:
-			i, err := strconv.ParseUint(expr, 16, 16)
-			if err != nil {
-				panic(err)
-			}
-			return uint32(i)
-		case 5, 6, 7, 8:
-			i, err := strconv.ParseUint(expr, 16, 32)
-			if err != nil {
-				panic(err)
-			}
-			return uint32(i)
-		default:
-			panic(fmt.Sprintf("Unhandld hex expression: %s, size is: %d", expr, len(expr)))
+// evaluateEnumExpr returns the value of an enum field. Calls to
+// function-like macros are expanded, ie. MAKE_DDHRESULT(2900), and the
+// expanded expression is evaluated with the values of enumerators and
+// #define constants. ok is false if the value can't be evaluated.
+func (p *parser) evaluateEnumExpr(exprTokens []string) (rawValue string, value constant, ok bool, err error) {
+	rawValue = strings.Join(exprTokens, "")
+	if p.symbols.hasMacroCall(exprTokens) {
+		if exprTokens, _, err = p.symbols.expandMacros(exprTokens); err != nil {
+			return rawValue, constant{}, false, err
 		}
-		/*// uint32
-		{
-			i, err := strconv.ParseUint(expr, 10, 32)
-			if err != nil {
-				panic(err)
-			}
-			return uint32(i)
-		}*/
+		rawValue = strings.Join(exprTokens, "")
+	}
+	value, err = evaluateExpr(exprTokens, p.symbols.lookupEnumValue)
+	if err != nil {
+		// NOTE: Expressions that use declarations other than
+		// enumerators and constants are printed as is
+		return rawValue, constant{}, false, nil
+	}
+	if value.isFloat() || value.isString() {
+		return rawValue, constant{}, false, errors.New("enum values must be integers")
 	}
-	return nil
+	v := int64(value.bits)
+	if value.isUnsigned() && value.bits > math.MaxInt64 || v < math.MinInt32 || v > math.MaxUint32 {
+		return rawValue, constant{}, false, nil
+	}
+	return rawValue, value, true, nil
 }
 
-func parseFunctionPointerParameterFields(s *scanner.Scanner) []types.StructField {
-	return parseFields(s, ",", ")")
+func (p *parser) parseFunctionPointerParameterFields() []types.StructField {
+	return p.parseFields(",", ")")
 }
 
-func parseStructFields(s *scanner.Scanner) []types.StructField {
-	return parseFields(s, ";", "}")
+func (p *parser) parseStructFields() []types.StructField {
+	return p.parseFields(";", "}")
 }
 
-func parseFields(s *scanner.Scanner, endOfFieldToken string, endOfListToken string) []types.StructField {
+func (p *parser) parseFields(endOfFieldToken string, endOfListToken string) []types.StructField {
 	var fields []types.StructField
+	// endLine is the line that the last field ended on, comments
+	// after it on the same line are its documentation
+	endLine := 0
 FieldLoop:
 	for {
-		var isOut, isDeref, hasECount bool
+		var annotation types.Annotation
 
 		// Scan next field
-		s.Scan()
-		switch v := s.TokenText(); v {
+		if tok := p.Scan(); tok == scanner.EOF {
+			p.errorf("unexpected end of file, expected %s", endOfListToken)
+		}
+		if endLine > 0 {
+			field := &fields[len(fields)-1]
+			field.Doc = appendDoc(field.Doc, p.takeTrailingDoc(endLine))
+			endLine = 0
+		}
+		// ie. "/* [annotation] */" above a parameter
+		doc := p.takeDoc()
+		switch v := p.TokenText(); v {
 		case endOfListToken:
 			// End of struct ('}') or list (')')
 			break FieldLoop
@@ -644,58 +1176,37 @@ FieldLoop:
 		case "END_INTERFACE":
 			// Ignore END_INTERFACE macro
 			continue
+		case "THIS", "THIS_":
+			// Ignore the This parameter of STDMETHOD methods, it's
+			// added by parseMethod
+			continue
 		case "union":
-			s.Scan()
-			if expect := "{"; s.TokenText() != expect {
-				panic(s.String() + ": unexpected token: " + s.TokenText() + " expected " + expect + " after \"union\" keyword.")
+			p.Scan()
+			if expect := "{"; p.TokenText() != expect {
+				p.errorf("unexpected token: %s expected %s after \"union\" keyword", p.TokenText(), expect)
 			}
 
 			// Parse union struct fields
-			unionFields := parseStructFields(s)
+			unionFields := p.parseStructFields()
 
-			s.Scan()
-			if expect := ";"; s.TokenText() != expect {
-				panic(s.String() + ": unexpected token: " + s.TokenText() + " after " + expect + " union")
+			p.Scan()
+			if expect := ";"; p.TokenText() != expect {
+				p.errorf("unexpected token: %s expected %s after union", p.TokenText(), expect)
 			}
 			fields = append(fields, types.StructField{
 				TypeInfo: types.NewUnion(types.Union{
 					Fields: unionFields,
 				}),
-				Name:      "",
-				IsOut:     isOut,
-				HasECount: hasECount,
+				Name:       "",
+				Annotation: annotation,
+				Doc:        doc,
 			})
+			endLine = p.Position.Line
 			continue
 		default:
-			metaValue := s.TokenText()
-			if strings.HasPrefix(metaValue, "__") {
-				isOut = strings.Contains(metaValue, "_out")
-				isDeref = strings.Contains(metaValue, "_deref")
-				hasECount = strings.Contains(metaValue, "_ecount")
-
-				// Skip meta info like:
-				// - __in
-				// - __in_bcount_opt( DataSize )
-				s.Scan()
-				if s.TokenText() == "(" {
-					// Ignore params for now
-					s.Scan()
-					for depth := 0; ; {
-						if s.TokenText() == ")" {
-							if depth > 0 {
-								depth--
-							} else {
-								s.Scan()
-								break
-							}
-						}
-						s.Scan()
-						if s.TokenText() == "(" {
-							depth++
-							s.Scan()
-						}
-					}
-				}
+			// Annotations can be combined, ie. "__in_opt __reserved void* pReserved"
+			for isAnnotation(p.TokenText()) {
+				p.parseAnnotation(&annotation)
 			}
 		}
 		// Read type info patterns:
@@ -705,9 +1216,9 @@ FieldLoop:
 		kind := ""
 		for {
 			// TODO(Jae): maybe store pointer depth
-			parsePointerDepth(s)
-			v := s.TokenText()
-			s.Scan()
+			p.parsePointerDepth()
+			v := p.TokenText()
+			p.Scan()
 			switch v {
 			case "const", "CONST":
 				// Handle alternate "const" case where it
@@ -719,6 +1230,9 @@ FieldLoop:
 				// TODO(Jae): 2020-01-26
 				// Consider storing flag for const variable
 				continue
+			case "enum":
+				// ie. "__out enum D3D_FEATURE_LEVEL* pLevel"
+				continue
 			case "CONST_VTBL",
 				"struct":
 				if kind == "" {
@@ -735,68 +1249,78 @@ FieldLoop:
 			}
 			break
 		}
-		if s.TokenText() == "(" {
+		if p.TokenText() == "(" {
 			// Detect function pointer
-			s.Scan() // skip type, ie. STDMETHODCALLTYPE
+			p.Scan() // skip type, ie. STDMETHODCALLTYPE
 
 			// TODO(Jae): Use pointer depth in return type
-			s.Scan()
-			parsePointerDepth(s)
-			callType := s.TokenText()
+			p.Scan()
+			p.parsePointerDepth()
+			callType := p.TokenText()
 
-			s.Scan()
-			if s.TokenText() != ")" {
-				panic(s.String() + ": unexpected token: " + s.TokenText() + " after type: " + kind)
+			p.Scan()
+			if p.TokenText() != ")" {
+				p.errorf("unexpected token: %s after type: %s", p.TokenText(), kind)
 			}
 			// TODO(Jae):
 			// Parse name of the field `HRESULT ( STDMETHODCALLTYPE *QueryInterface )`
-			s.Scan()
-			if s.TokenText() != "(" {
-				panic(s.String() + ": unexpected token: " + s.TokenText() + " after type: " + kind)
+			p.Scan()
+			if p.TokenText() != "(" {
+				p.errorf("unexpected token: %s after type: %s", p.TokenText(), kind)
 			}
-			params := parseFunctionPointerParameterFields(s)
-			s.Scan()
-			if s.TokenText() != ";" {
-				panic(s.String() + ": unexpected token: " + s.TokenText() + " after type: " + kind)
+			params := p.parseFunctionPointerParameterFields()
+			p.Scan()
+			if p.TokenText() != ";" {
+				p.errorf("unexpected token: %s after type: %s", p.TokenText(), kind)
 			}
 			fields = append(fields, types.StructField{
 				TypeInfo: types.NewFunctionPointer(types.FunctionPointer{
 					Parameters: params,
 				}),
-				Name:      callType,
-				IsOut:     isOut,
-				IsDeref:   isDeref,
-				HasECount: hasECount,
+				Name:       callType,
+				Annotation: annotation,
+				Doc:        doc,
 			})
+			endLine = p.Position.Line
 			continue
 		}
-		if s.TokenText() == "(" {
-			panic(s.String() + ": unexpected token: " + s.TokenText() + " after type: " + kind)
+		if p.TokenText() == "(" {
+			p.errorf("unexpected token: %s after type: %s", p.TokenText(), kind)
 		}
 		// Get *const pointer or just * info
-		pointerDepth := parsePointerDepth(s)
-		switch v := s.TokenText(); v {
+		pointerDepth := p.parsePointerDepth()
+		switch v := p.TokenText(); v {
 		case "const":
 			// Handle alternate "const" case where it
 			// comes after the type rather than before
 			// ie.
 			// - "__in_ecount(NumBuffers)  ID3D11Buffer *const *ppConstantBuffers);"
-			s.Scan()
+			p.Scan()
 
 			// TODO(Jae): Flag this type as "const"?
 			//kind = kind + " " + v
 
 			// Re-read pointer info after *const
-			pointerDepth += parsePointerDepth(s)
+			pointerDepth += p.parsePointerDepth()
+		}
+		name := p.TokenText()
+		if name == endOfFieldToken || name == endOfListToken {
+			// Unnamed parameter, ie. "STDMETHOD(Initialize)(THIS_ HINSTANCE,DWORD) PURE;"
+			name = "param" + strconv.Itoa(len(fields))
+		} else {
+			p.Scan()
+			if IsIdent(p.TokenText()) && p.Peek() == '(' {
+				// Skip macros after the name, ie. "UINT32 Flags X2DEFAULT(0)"
+				p.Scan()
+				p.skipParens()
+				p.Scan()
+			}
 		}
-		name := s.TokenText()
-		//panic(s.String() + ": debug " + kind + " " + name)
 
 		// Detect ;
 		var typeInfo types.TypeInfo
 		isLastField := false
-		s.Scan()
-		switch tok := s.TokenText(); tok {
+		switch tok := p.TokenText(); tok {
 		case endOfFieldToken, endOfListToken:
 			// Simple type
 			typeInfo = types.NewBasicType(kind, types.BasicType{})
@@ -811,22 +1335,22 @@ FieldLoop:
 			// Array type
 			var dimens []int
 		ArrayLenLoop:
-			for ; ; s.Scan() {
-				switch tok := s.TokenText(); tok {
+			for ; ; p.Scan() {
+				switch tok := p.TokenText(); tok {
 				case "[":
-					s.Scan()
+					p.Scan()
 					{
 						// Add
-						dStr := s.TokenText()
+						dStr := p.TokenText()
 						d, err := strconv.Atoi(dStr)
 						if err != nil {
-							panic(s.String() + ": cannot parse array len value: " + dStr + ", error: " + err.Error())
+							p.errorf("cannot parse array len value: %s, error: %s", dStr, err)
 						}
 						dimens = append(dimens, d)
 					}
-					s.Scan()
-					if expect := "]"; s.TokenText() != expect {
-						panic(s.String() + ": expected token: " + expect + " after array type: " + kind)
+					p.Scan()
+					if expect := "]"; p.TokenText() != expect {
+						p.errorf("expected token: %s after array type: %s", expect, kind)
 					}
 				case endOfFieldToken:
 					break ArrayLenLoop
@@ -834,14 +1358,14 @@ FieldLoop:
 					isLastField = true
 					break ArrayLenLoop
 				default:
-					panic(s.String() + ": expected token: " + endOfFieldToken + " after array type: " + kind)
+					p.errorf("expected token: %s after array type: %s", endOfFieldToken, kind)
 				}
 			}
 			typeInfo = types.NewArray(kind, types.Array{
 				Dimens: dimens,
 			})
 		default:
-			panic(s.String() + ": expected [ or " + endOfFieldToken + " token, mishandled token:" + name)
+			p.errorf("expected [ or %s token, mishandled token: %s", endOfFieldToken, name)
 		}
 		if pointerDepth > 0 {
 			// Wrap in pointer type if applicable
@@ -851,15 +1375,16 @@ FieldLoop:
 			})
 		}
 		fields = append(fields, types.StructField{
-			TypeInfo:  typeInfo,
-			Name:      name,
-			IsOut:     isOut,
-			IsDeref:   isDeref,
-			HasECount: hasECount,
+			TypeInfo:   typeInfo,
+			Name:       name,
+			Annotation: annotation,
+			Doc:        doc,
 		})
+		endLine = p.Position.Line
 		if isLastField {
 			break FieldLoop
 		}
 	}
+	resolveCountParams(fields)
 	return fields
 }
@@ -0,0 +1,770 @@
+package parser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"text/scanner"
+
+	"github.com/silbinarywolf/directx-bind-gen/internal/types"
+)
+
+type GoldenRule struct {
+	In string
+	// Fields are the names of the fields that In is parsed into
+	Fields []string
+}
+
+var structTestData = []GoldenRule{
+	{
+		// typedef struct D3D11_BOX
+		In: `
+	    UINT left;
+	    UINT top;
+	    UINT front;
+	    UINT right;
+	    UINT bottom;
+	    UINT back;
+	    } 	D3D11_BOX;`,
+		Fields: []string{"left", "top", "front", "right", "bottom", "back"},
+	},
+	{
+		// typedef struct ID3D11DeviceChildVtbl
+		In: `
+    	BEGIN_INTERFACE
+        
+        HRESULT ( STDMETHODCALLTYPE *QueryInterface )( 
+            ID3D11DeviceChild * This,
+            /* [in] */ REFIID riid,
+            /* [annotation][iid_is][out] */ 
+            __RPC__deref_out  void **ppvObject);
+        
+        END_INTERFACE
+    } ID3D11DeviceChildVtbl;`,
+		// BEGIN_INTERFACE marks the struct as a vtbl, see parseStruct
+		Fields: []string{"BEGIN_INTERFACE", "QueryInterface"},
+	},
+}
+
+func TestParseStruct(t *testing.T) {
+	for _, test := range structTestData {
+		p := &parser{}
+		p.Init(strings.NewReader(test.In))
+		p.Filename = "Test"
+		p.Mode = scanner.GoTokens
+		fields := p.parseStructFields()
+		for _, d := range p.diagnostics {
+			t.Error(d)
+		}
+		var names []string
+		for _, field := range fields {
+			names = append(names, field.Name)
+		}
+		if !reflect.DeepEqual(names, test.Fields) {
+			t.Errorf("expected fields %v, got %v", test.Fields, names)
+		}
+	}
+}
+
+func TestParseRecoversFromErrors(t *testing.T) {
+	file, diagnostics := parse("Test", []byte(`
+typedef struct BROKEN
+    {
+    UINT left
+    UINT top;
+    } 	BROKEN;
+
+typedef struct D3D11_BOX
+    {
+    UINT left;
+    UINT right;
+    } 	D3D11_BOX;
+`), newPreprocessor(newSymbolTable(Config{})))
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %d: %v", len(diagnostics), diagnostics)
+	}
+	if d := diagnostics[0]; d.Severity != SeverityError ||
+		d.Decl != "typedef struct BROKEN" ||
+		d.Pos.Line != 5 {
+		t.Errorf("unexpected diagnostic: %v", d)
+	}
+	if len(file.Structs) != 1 || file.Structs[0].Ident != "D3D11_BOX" {
+		t.Errorf("expected D3D11_BOX to be parsed after error, got: %v", file.Structs)
+	}
+}
+
+func TestParseTypeAliases(t *testing.T) {
+	file, diagnostics := parse("Test", []byte(`
+typedef UINT D3D11_UINT;
+typedef float D3DVALUE, *LPD3DVALUE;
+typedef WAVEFORMATEX *PWAVEFORMATEX, *LPWAVEFORMATEX;
+typedef const WAVEFORMATEX *PCWAVEFORMATEX;
+typedef CONST void *LPCVOID;
+typedef unsigned long ULONG;
+`), newPreprocessor(newSymbolTable(Config{})))
+	for _, d := range diagnostics {
+		t.Error(d)
+	}
+	expected := []types.TypeAlias{
+		{Ident: "D3D11_UINT", Alias: "uint32"},
+		{Ident: "D3DVALUE", Alias: "float"},
+		{Ident: "LPD3DVALUE", Alias: "*float"},
+		{Ident: "PWAVEFORMATEX", Alias: "*WAVEFORMATEX"},
+		{Ident: "LPWAVEFORMATEX", Alias: "*WAVEFORMATEX"},
+		// Go has no const
+		{Ident: "PCWAVEFORMATEX", Alias: "*WAVEFORMATEX"},
+		{Ident: "LPCVOID", Alias: "*void"},
+		// Types of more than one word aren't aliased
+	}
+	if len(file.TypeAliases) != len(expected) {
+		t.Fatalf("expected %d type aliases, got: %v", len(expected), file.TypeAliases)
+	}
+	for i, typeAlias := range file.TypeAliases {
+		if typeAlias.Ident != expected[i].Ident || typeAlias.Alias != expected[i].Alias {
+			t.Errorf("expected %s %s, got %s %s", expected[i].Ident, expected[i].Alias, typeAlias.Ident, typeAlias.Alias)
+		}
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	file, diagnostics := parse("Test", []byte(`
+#define D3D11_SDK_VERSION 7
+
+typedef enum D3D11_CULL_MODE
+    {
+        D3D11_CULL_NONE = 1,
+        D3D11_CULL_FRONT = 2
+    } 	D3D11_CULL_MODE;
+
+typedef struct _D3D11_SHADER_DESC
+    {
+    UINT Version;
+    } 	D3D11_SHADER_DESC;
+
+HRESULT WINAPI D3D11CreateDevice(
+    UINT Flags);
+`), newPreprocessor(newSymbolTable(Config{})))
+	for _, d := range diagnostics {
+		t.Error(d)
+	}
+	if len(file.Macros) != 1 || len(file.Enums) != 1 || len(file.Structs) != 1 || len(file.Functions) != 1 {
+		t.Fatalf("expected a macro, enum, struct and function, got: %v", file)
+	}
+	tests := []struct {
+		source types.Source
+		cIdent string
+		line   int
+	}{
+		{file.Macros[0].Source, "D3D11_SDK_VERSION", 2},
+		{file.Enums[0].Source, "D3D11_CULL_MODE", 4},
+		{file.Enums[0].Fields[1].Source, "D3D11_CULL_FRONT", 7},
+		// The typedef name rather than the tag
+		{file.Structs[0].Source, "D3D11_SHADER_DESC", 10},
+		{file.Functions[0].Source, "D3D11CreateDevice", 15},
+	}
+	for _, test := range tests {
+		if test.source.CIdent != test.cIdent || test.source.Line != test.line {
+			t.Errorf("expected %s on line %d, got %s on line %d", test.cIdent, test.line, test.source.CIdent, test.source.Line)
+		}
+	}
+}
+
+func TestPreprocess(t *testing.T) {
+	pp := newPreprocessor(newSymbolTable(Config{
+		Defines: map[string]string{
+			"D3D11_NO_HELPERS": "",
+			"_MSC_VER":         "1600",
+		},
+		Undefines: []string{"COBJMACROS"},
+	}))
+	out := pp.preprocess("Test", []byte(`#ifdef COBJMACROS
+removed
+#endif
+#if !defined( D3D11_NO_HELPERS ) && defined( __cplusplus )
+removed
+#endif
+#if defined(_MSC_VER) && (_MSC_VER >= 1020)
+kept
+#else
+removed
+#endif
+#if defined(__cplusplus) && !defined(CINTERFACE)
+kept
+#else /* C style interface */
+kept
+#endif
+#ifndef __GUARD__
+#define __GUARD__
+#endif
+#ifndef __GUARD__
+removed
+#endif`))
+	for _, d := range pp.diagnostics {
+		t.Error(d)
+	}
+	lines := strings.Split(string(out), "\n")
+	if len(lines) != 22 {
+		t.Fatalf("expected line count to be preserved, got %d lines", len(lines))
+	}
+	for i, line := range lines {
+		if strings.Contains(line, "removed") {
+			t.Errorf("line %d should be removed", i+1)
+		}
+	}
+	if got := strings.Count(string(out), "kept"); got != 3 {
+		t.Errorf("expected 3 kept lines, got %d:\n%s", got, out)
+	}
+	if line := lines[17]; line != "#define __GUARD__" {
+		t.Errorf("expected #define to be kept, got %q", line)
+	}
+}
+
+func TestParseFilesFollowsIncludes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "directx-bind-gen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"main.h": `#include "common.h"
+#include "COMMON.H"
+#include <missing.h>
+#define MAIN_VALUE (COMMON_VALUE + 1)
+`,
+		"Common.h": `#ifndef __common_h__
+#define __common_h__
+#define COMMON_VALUE 41
+#endif
+`,
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	project, diagnostics, err := ParseFiles([]string{filepath.Join(dir, "main.h")}, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diagnostics) != 1 || diagnostics[0].Severity != SeverityWarning {
+		t.Errorf("expected 1 warning for missing.h, got: %v", diagnostics)
+	}
+	if len(project.Files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(project.Files))
+	}
+	if got := filepath.Base(project.Files[1].Filename); got != "Common.h" {
+		t.Errorf("expected included file to be Common.h, got %s", got)
+	}
+	macros := project.Files[0].Macros
+	if len(macros) != 1 || macros[0].StringValue == nil || *macros[0].StringValue != "42" {
+		t.Errorf("expected MAIN_VALUE to be 42, got: %v", macros)
+	}
+
+	// ParseFile only returns the declarations of the header itself
+	file, _, err := ParseFile(filepath.Join(dir, "main.h"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Macros) != 1 || file.Macros[0].Ident != "MAIN_VALUE" {
+		t.Errorf("expected ParseFile to return MAIN_VALUE, got: %v", file.Macros)
+	}
+}
+
+func TestParseDeclareInterface(t *testing.T) {
+	file, diagnostics := parse("Test", []byte(`
+DECLARE_INTERFACE(IXAudio2Voice)
+{
+    STDMETHOD_(void, GetVoiceDetails) (THIS_ __out XAUDIO2_VOICE_DETAILS* pVoiceDetails) PURE;
+};
+
+DECLARE_INTERFACE_(IXAudio2SourceVoice, IXAudio2Voice)
+{
+    STDMETHOD(Start) (THIS_ UINT32 Flags X2DEFAULT(0), UINT32 OperationSet X2DEFAULT(XAUDIO2_COMMIT_NOW)) PURE;
+};
+`), newPreprocessor(newSymbolTable(Config{})))
+	for _, d := range diagnostics {
+		t.Error(d)
+	}
+	if len(file.Structs) != 2 {
+		t.Fatalf("expected 2 interfaces, got %d", len(file.Structs))
+	}
+	record := file.Structs[1]
+	if record.Ident != "IXAudio2SourceVoice" || record.VtblStruct == nil {
+		t.Fatalf("expected IXAudio2SourceVoice with vtbl, got: %v", record)
+	}
+	if record.Base != "IXAudio2Voice" {
+		t.Errorf("expected base to be IXAudio2Voice, got: %s", record.Base)
+	}
+	methods := record.VtblStruct.Fields
+	if len(methods) != 2 || methods[0].Name != "GetVoiceDetails" || methods[1].Name != "Start" {
+		t.Fatalf("expected inherited GetVoiceDetails then Start, got: %v", methods)
+	}
+	params := methods[0].TypeInfo.Type.(*types.FunctionPointer).Parameters
+	if len(params) != 2 || params[0].Name != "This" || params[0].TypeInfo.Ident != "IXAudio2SourceVoice" {
+		t.Errorf("expected inherited method to take IXAudio2SourceVoice as This, got: %v", params)
+	}
+	params = methods[1].TypeInfo.Type.(*types.FunctionPointer).Parameters
+	if len(params) != 3 || params[1].Name != "Flags" || params[2].Name != "OperationSet" {
+		t.Errorf("unexpected parameters for Start: %v", params)
+	}
+}
+
+func TestParseDeclareInterfaceMethodMacro(t *testing.T) {
+	// The methods of IXAudio2Voice are declared in a macro so that
+	// the voices that inherit from it can redeclare them, see XAudio2.h
+	file, diagnostics := parse("Test", []byte(`
+#ifdef __cplusplus
+    #define X2DEFAULT(x) =x
+#else
+    #define X2DEFAULT(x)
+#endif
+
+#undef INTERFACE
+#define INTERFACE IXAudio2Voice
+
+DECLARE_INTERFACE(IXAudio2Voice)
+{
+    #define Declare_IXAudio2Voice_Methods() \
+    \
+    /* NAME: IXAudio2Voice::GetVoiceDetails
+    // DESCRIPTION: Returns the basic characteristics of this voice.
+    */\
+    STDMETHOD_(void, GetVoiceDetails) (THIS_ __out XAUDIO2_VOICE_DETAILS* pVoiceDetails) PURE; \
+    \
+    /* NAME: IXAudio2Voice::SetVolume
+    // DESCRIPTION: Sets the overall volume level for the voice.
+    */\
+    STDMETHOD(SetVolume) (THIS_ float Volume, \
+                          UINT32 OperationSet X2DEFAULT(XAUDIO2_COMMIT_NOW)) PURE; \
+    \
+    STDMETHOD_(void, DestroyVoice) (THIS) PURE
+
+    Declare_IXAudio2Voice_Methods();
+};
+
+#undef INTERFACE
+#define INTERFACE IXAudio2SourceVoice
+
+DECLARE_INTERFACE_(IXAudio2SourceVoice, IXAudio2Voice)
+{
+    // Methods from IXAudio2Voice
+    Declare_IXAudio2Voice_Methods();
+
+    // NAME: IXAudio2SourceVoice::Start
+    STDMETHOD(Start) (THIS_ UINT32 Flags X2DEFAULT(0), UINT32 OperationSet X2DEFAULT(XAUDIO2_COMMIT_NOW)) PURE;
+};
+`), newPreprocessor(newSymbolTable(Config{Undefines: []string{"__cplusplus"}})))
+	for _, d := range diagnostics {
+		t.Error(d)
+	}
+	if len(file.Structs) != 2 {
+		t.Fatalf("expected 2 interfaces, got %d", len(file.Structs))
+	}
+	tests := []struct {
+		ident   string
+		methods []string
+	}{
+		{"IXAudio2Voice", []string{"GetVoiceDetails", "SetVolume", "DestroyVoice"}},
+		{"IXAudio2SourceVoice", []string{"GetVoiceDetails", "SetVolume", "DestroyVoice", "Start"}},
+	}
+	for i, test := range tests {
+		record := file.Structs[i]
+		if record.Ident != test.ident || record.VtblStruct == nil {
+			t.Fatalf("expected %s with vtbl, got: %v", test.ident, record)
+		}
+		var methods []string
+		for _, method := range record.VtblStruct.Fields {
+			methods = append(methods, method.Name)
+		}
+		if !reflect.DeepEqual(methods, test.methods) {
+			t.Errorf("%s: expected methods %v, got %v", test.ident, test.methods, methods)
+		}
+	}
+	params := file.Structs[0].VtblStruct.Fields[1].TypeInfo.Type.(*types.FunctionPointer).Parameters
+	if len(params) != 3 || params[1].Name != "Volume" || params[2].Name != "OperationSet" {
+		t.Errorf("unexpected parameters for SetVolume: %v", params)
+	}
+}
+
+func TestParseDefineGuid(t *testing.T) {
+	file, diagnostics := parse("Test", []byte(`
+DEFINE_GUID(IID_ID3D11ShaderReflection, 0x0a233719, 0x3960, 0x4578, 0x9d, 0x7c, 0x20, 0x3b, 0x8b, 0x1d, 0x9c, 0xc1);
+DEFINE_IID(IXAPO, A90BC001, E897, E897, 55, E4, 9E, 47, 00, 00, 00, 09);
+`), newPreprocessor(newSymbolTable(Config{})))
+	for _, d := range diagnostics {
+		t.Error(d)
+	}
+	expected := []types.Guid{
+		{Ident: "IID_ID3D11ShaderReflection", GUID: "0a233719-3960-4578-9d7c-203b8b1d9cc1"},
+		{Ident: "IID_IXAPO", GUID: "a90bc001-e897-e897-55e4-9e4700000009"},
+	}
+	if len(file.Guids) != len(expected) {
+		t.Fatalf("expected %d GUIDs, got: %v", len(expected), file.Guids)
+	}
+	for i, guid := range file.Guids {
+		if guid.Ident != expected[i].Ident || guid.GUID != expected[i].GUID {
+			t.Errorf("expected %s %s, got %s %s", expected[i].Ident, expected[i].GUID, guid.Ident, guid.GUID)
+		}
+	}
+}
+
+func TestParseHRESULT(t *testing.T) {
+	file, diagnostics := parse("Test", []byte(`
+#define _FACDXGI    0x87a
+#define MAKE_DXGI_HRESULT(code) MAKE_HRESULT(1, _FACDXGI, code)
+#define MAKE_DXGI_STATUS(code)  MAKE_HRESULT(0, _FACDXGI, code)
+#define DXGI_STATUS_OCCLUDED MAKE_DXGI_STATUS(1)
+#define DXGI_ERROR_DEVICE_REMOVED MAKE_DXGI_HRESULT(5)
+#define DXGI_ERROR_REMOVED DXGI_ERROR_DEVICE_REMOVED
+`), newPreprocessor(newSymbolTable(Config{})))
+	for _, d := range diagnostics {
+		t.Error(d)
+	}
+	expected := []types.Macro{
+		{Ident: "_FACDXGI", Value: types.Value{RawValue: "0x87a"}},
+		{Ident: "DXGI_STATUS_OCCLUDED", Value: types.Value{RawValue: "142213121"}, HRESULT: true},
+		{Ident: "DXGI_ERROR_DEVICE_REMOVED", Value: types.Value{RawValue: "-2005270523"}, HRESULT: true},
+		{Ident: "DXGI_ERROR_REMOVED", Value: types.Value{RawValue: "-2005270523"}, HRESULT: true},
+	}
+	if len(file.Macros) != len(expected) {
+		t.Fatalf("expected %d macros, got: %v", len(expected), file.Macros)
+	}
+	for i, macro := range file.Macros {
+		if macro.Ident != expected[i].Ident || macro.String() != expected[i].String() || macro.HRESULT != expected[i].HRESULT {
+			t.Errorf("expected %s = %s (HRESULT: %v), got %s = %s (HRESULT: %v)", expected[i].Ident, expected[i].String(), expected[i].HRESULT, macro.Ident, macro.String(), macro.HRESULT)
+		}
+	}
+}
+
+func TestParseTypedMacros(t *testing.T) {
+	file, diagnostics := parse("Test", []byte(`
+#define D3D11_FLOAT32_MAX	( 3.402823466e+38f )
+#define D3D11_DEFAULT_MIP_LOD_BIAS	( 0.0f )
+#define D3D11_FLOAT_TO_SRGB_OFFSET	( 0.055 )
+#define D3DCOMPILER_DLL_W L"d3dcompiler_43.dll"
+#define D3DCOMPILER_DLL_A "d3dcompiler_43.dll"
+#define D3DCOMPILER_DLL D3DCOMPILER_DLL_A
+#define D3D11_REGKEY_PATH __TEXT("Software\\Microsoft\\Direct3D")
+`), newPreprocessor(newSymbolTable(Config{})))
+	for _, d := range diagnostics {
+		t.Error(d)
+	}
+	expected := []types.Const{
+		{Kind: types.ConstFloat32, Float64: float64(float32(3.402823466e+38))},
+		{Kind: types.ConstFloat32, Float64: 0},
+		{Kind: types.ConstFloat64, Float64: 0.055},
+		{Kind: types.ConstWideString, Str: "d3dcompiler_43.dll"},
+		{Kind: types.ConstString, Str: "d3dcompiler_43.dll"},
+		{Kind: types.ConstString, Str: "d3dcompiler_43.dll"},
+		{Kind: types.ConstString, Str: `Software\Microsoft\Direct3D`},
+	}
+	if len(file.Macros) != len(expected) {
+		t.Fatalf("expected %d macros, got: %v", len(expected), file.Macros)
+	}
+	for i, macro := range file.Macros {
+		if macro.Const == nil || *macro.Const != expected[i] {
+			t.Errorf("%s: expected %v, got %v", macro.Ident, expected[i], macro.Const)
+		}
+	}
+}
+
+func TestExpandFunctionMacros(t *testing.T) {
+	file, diagnostics := parse("Test", []byte(`
+#define _FACDD  0x876
+#define MAKE_DDHRESULT( code )  MAKE_HRESULT( 1, _FACDD, code )
+#define PASTE(a, b) a ## b
+#define VALUE_1 42
+#define PASTED PASTE(VALUE_, 1)
+
+typedef enum D3DX11_ERR {
+    D3DX11_ERR_CANNOT_MODIFY_INDEX_BUFFER = MAKE_DDHRESULT(2900),
+    D3DX11_ERR_PASTED = PASTE(1, 6),
+} D3DX11_ERR;
+`), newPreprocessor(newSymbolTable(Config{})))
+	for _, d := range diagnostics {
+		t.Error(d)
+	}
+	if len(file.Macros) != 3 || file.Macros[2].Ident != "PASTED" || file.Macros[2].String() != "42" {
+		t.Errorf("expected PASTED = 42, got: %v", file.Macros)
+	}
+	if len(file.Enums) != 1 || len(file.Enums[0].Fields) != 2 {
+		t.Fatalf("expected enum with 2 fields, got: %v", file.Enums)
+	}
+	for i, expected := range []uint32{0x88760B54, 16} {
+		field := file.Enums[0].Fields[i]
+		if field.UInt32Value == nil || *field.UInt32Value != expected {
+			t.Errorf("expected %s to be %d, got: %s", field.Ident, expected, field.String())
+		}
+	}
+}
+
+func TestParseEnumValues(t *testing.T) {
+	file, diagnostics := parse("Test", []byte(`
+#define D3D11_SHADER_BASE 2
+
+typedef enum D3D11_COLOR_WRITE_ENABLE {
+    D3D11_COLOR_WRITE_ENABLE_RED = 1,
+    D3D11_COLOR_WRITE_ENABLE_GREEN = 2,
+    D3D11_COLOR_WRITE_ENABLE_BLUE = 4,
+    D3D11_COLOR_WRITE_ENABLE_ALL = ( ( D3D11_COLOR_WRITE_ENABLE_RED | D3D11_COLOR_WRITE_ENABLE_GREEN ) | D3D11_COLOR_WRITE_ENABLE_BLUE )
+} D3D11_COLOR_WRITE_ENABLE;
+
+typedef enum _D3D_BLOB_PART {
+    D3D_BLOB_INPUT_SIGNATURE_BLOB,
+    D3D_BLOB_OUTPUT_SIGNATURE_BLOB,
+    D3D_BLOB_TEST_ALTERNATE_SHADER = 0x8000,
+    D3D_BLOB_TEST_COMPILE_DETAILS,
+    D3D_BLOB_NEGATIVE = -1,
+    D3D_BLOB_ZERO,
+    D3D_BLOB_SHADER = D3D11_SHADER_BASE + D3D_BLOB_TEST_ALTERNATE_SHADER,
+} D3D_BLOB_PART;
+
+enum {
+    DSBCAPS_ALL = 0x1 << 4
+};
+`), newPreprocessor(newSymbolTable(Config{})))
+	for _, d := range diagnostics {
+		t.Error(d)
+	}
+	expected := [][]uint32{
+		{1, 2, 4, 7},
+		{0, 1, 0x8000, 0x8001, 0xFFFFFFFF, 0, 0x8002},
+	}
+	if len(file.Enums) != len(expected) {
+		t.Fatalf("expected %d enums, got: %v", len(expected), file.Enums)
+	}
+	for i, enum := range file.Enums {
+		if len(enum.Fields) != len(expected[i]) {
+			t.Fatalf("expected %s to have %d fields, got: %v", enum.Ident, len(expected[i]), enum.Fields)
+		}
+		for j, field := range enum.Fields {
+			if field.UInt32Value == nil || *field.UInt32Value != expected[i][j] {
+				t.Errorf("expected %s to be %d, got: %s", field.Ident, expected[i][j], field.String())
+			}
+		}
+	}
+	if negative := file.Enums[1].Fields[4]; negative.Const == nil || negative.Const.Int64 != -1 {
+		t.Errorf("expected D3D_BLOB_NEGATIVE to be -1, got: %v", negative.Const)
+	}
+	if len(file.Macros) != 2 || file.Macros[1].Ident != "DSBCAPS_ALL" || file.Macros[1].String() != "16" {
+		t.Errorf("expected DSBCAPS_ALL = 16, got: %v", file.Macros)
+	}
+}
+
+func TestParseDoc(t *testing.T) {
+	file, diagnostics := parse("Test", []byte(`
+// Returned by IXAudio2::GetDeviceDetails
+typedef struct XAUDIO2_DEVICE_DETAILS
+{
+    WCHAR DeviceID[256];    // String identifier for the audio device.
+    UINT Role;              // Roles that the device should be used for,
+                            // ie. GlobalDefaultDevice
+} XAUDIO2_DEVICE_DETAILS;
+
+#define D3D11_SDK_VERSION ( 7 ) // Use with D3D11CreateDevice
+
+typedef enum D3D11_SHADER_VERSION_TYPE
+{
+    D3D11_SHVER_PIXEL_SHADER = 0,
+
+    // D3D11 Shaders
+    D3D11_SHVER_HULL_SHADER = 3
+} D3D11_SHADER_VERSION_TYPE; /* [local] */
+
+HRESULT WINAPI D3D11CreateDevice(
+    /* [annotation] */
+    __in_opt IDXGIAdapter* pAdapter);
+`), newPreprocessor(newSymbolTable(Config{})))
+	for _, d := range diagnostics {
+		t.Error(d)
+	}
+	if len(file.Structs) != 1 || len(file.Macros) != 1 || len(file.Enums) != 1 || len(file.Functions) != 1 {
+		t.Fatalf("expected a struct, macro, enum and function, got: %+v", file)
+	}
+	record := file.Structs[0]
+	tests := []struct {
+		decl     string
+		doc      string
+		expected string
+	}{
+		{"struct", record.Doc, "Returned by IXAudio2::GetDeviceDetails"},
+		{"DeviceID", record.Fields[0].Doc, "String identifier for the audio device."},
+		{"Role", record.Fields[1].Doc, "Roles that the device should be used for,\nie. GlobalDefaultDevice"},
+		{"macro", file.Macros[0].Doc, "Use with D3D11CreateDevice"},
+		{"enum", file.Enums[0].Doc, "[local]"},
+		{"PIXEL_SHADER", file.Enums[0].Fields[0].Doc, ""},
+		{"HULL_SHADER", file.Enums[0].Fields[1].Doc, "D3D11 Shaders"},
+		{"pAdapter", file.Functions[0].Parameters[0].Doc, "[annotation]"},
+	}
+	for _, test := range tests {
+		if test.doc != test.expected {
+			t.Errorf("%s: expected doc %q, got %q", test.decl, test.expected, test.doc)
+		}
+	}
+}
+
+func TestParseAnnotations(t *testing.T) {
+	file, diagnostics := parse("Test", []byte(`
+HRESULT WINAPI Test(
+    __in_range( 0, D3D11_SO_BUFFER_SLOT_COUNT - 1 ) UINT StartSlot,
+    __in UINT NumViews,
+    __in_ecount_opt(NumViews) ID3D11ShaderResourceView *const *ppShaderResourceViews,
+    __inout UINT *pDataSize,
+    __out_bcount_opt( *pDataSize ) void *pData,
+    __RPC__deref_out void **ppvObject,
+    __in_opt __reserved void* pReserved,
+    __out_ecount_part_opt(NumElements, *pNumElements) D3D11_SO_DECLARATION_ENTRY* pElements);
+`), newPreprocessor(newSymbolTable(Config{})))
+	for _, d := range diagnostics {
+		t.Error(d)
+	}
+	if len(file.Functions) != 1 {
+		t.Fatalf("expected 1 function, got: %v", file.Functions)
+	}
+	expected := []types.Annotation{
+		{
+			SAL:       []string{"__in_range(0,D3D11_SO_BUFFER_SLOT_COUNT-1)"},
+			Direction: types.DirectionIn,
+			RangeMin:  "0",
+			RangeMax:  "D3D11_SO_BUFFER_SLOT_COUNT-1",
+		},
+		{
+			SAL:       []string{"__in"},
+			Direction: types.DirectionIn,
+		},
+		{
+			SAL:        []string{"__in_ecount_opt(NumViews)"},
+			Direction:  types.DirectionIn,
+			Optional:   true,
+			CountKind:  types.CountElements,
+			Count:      "NumViews",
+			CountParam: "NumViews",
+		},
+		{
+			SAL:       []string{"__inout"},
+			Direction: types.DirectionInOut,
+		},
+		{
+			SAL:        []string{"__out_bcount_opt(*pDataSize)"},
+			Direction:  types.DirectionOut,
+			Optional:   true,
+			CountKind:  types.CountBytes,
+			Count:      "*pDataSize",
+			CountParam: "pDataSize",
+		},
+		{
+			SAL:       []string{"__RPC__deref_out"},
+			Direction: types.DirectionOut,
+			Deref:     1,
+		},
+		{
+			SAL:       []string{"__in_opt", "__reserved"},
+			Direction: types.DirectionIn,
+			Optional:  true,
+			Reserved:  true,
+		},
+		{
+			SAL:       []string{"__out_ecount_part_opt(NumElements,*pNumElements)"},
+			Direction: types.DirectionOut,
+			Optional:  true,
+			CountKind: types.CountElements,
+			Count:     "NumElements",
+			Length:    "*pNumElements",
+		},
+	}
+	params := file.Functions[0].Parameters
+	if len(params) != len(expected) {
+		t.Fatalf("expected %d parameters, got: %v", len(expected), params)
+	}
+	for i, param := range params {
+		if !reflect.DeepEqual(param.Annotation, expected[i]) {
+			t.Errorf("%s: expected %+v, got %+v", param.Name, expected[i], param.Annotation)
+		}
+	}
+}
+
+func TestEvaluateExpr(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"( 1L << (0 + 4) )", "16"},
+		{"0xFFFFFFFF", "0xFFFFFFFF"},
+		{"0xFFFFFFFF + 1", "0"},
+		{"0xFFFFFFFFull + 1", "4294967296"},
+		// MSVC: decimal constants that don't fit int are unsigned long
+		{"4294967295 + 1", "0"},
+		{"2147483648 >> 31", "1"},
+		{"0x1F4UL | 0x800", "2548"},
+		{"010 + 0", "8"},
+		{"-1 >> 1", "-1"},
+		{"0xFFFFFFFF >> 1", "2147483647"},
+		{"(UINT)-1", "4294967295"},
+		{"(unsigned long)(1) << 31", "2147483648"},
+		{"(HRESULT)0x80004005", "-2147467259"},
+		{"(BYTE)0x1FF", "255"},
+		{"~0u", "4294967295"},
+		{"-1 < 1u", "0"},
+		{"7 / 2 % 3 ^ 6 & 3", "2"},
+		{"1 ? 2 : 3", "2"},
+		{"0 ? 2 : 1 ? 3 : 4", "3"},
+		{"!0 && (2 >= 2) || 0", "1"},
+		{"1.5f * 2", "3.0"},
+		{"-0.5f", "-0.5"},
+		{"1.0f / 3", "0.33333334"},
+		{"1.0f / 3.0", "0.3333333333333333"},
+		{"(float)1 / 4", "0.25"},
+		{`"a" L"b"`, `"ab"`},
+		{"'A'", "65"},
+		{"VALUE * 2", "84"},
+	}
+	lookup := func(ident string) (constant, bool) {
+		if ident == "VALUE" {
+			return intConstant(kindInt, 42), true
+		}
+		return constant{}, false
+	}
+	for _, test := range tests {
+		value, err := evaluateExpr(tokenize(test.expr), lookup)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if value.String() != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.expr, test.expected, value.String())
+		}
+	}
+}
+
+func TestParseNumberKinds(t *testing.T) {
+	tests := []struct {
+		text   string
+		suffix string
+		kind   constKind
+	}{
+		{"2147483647", "", kindInt},
+		// Between 2^31 and 2^32, MSVC's long is 32-bit
+		{"2147483648", "", kindUint},
+		{"4294967295", "", kindUint},
+		{"3000000000", "L", kindUint},
+		{"4294967296", "", kindUint64},
+		{"0x7FFFFFFF", "", kindInt},
+		{"0xFFFFFFFF", "", kindUint},
+		{"4294967295", "ll", kindInt64},
+		{"1", "u", kindUint},
+	}
+	for _, test := range tests {
+		value, err := parseNumber(test.text, test.suffix)
+		if err != nil {
+			t.Errorf("%s%s: %v", test.text, test.suffix, err)
+			continue
+		}
+		if value.kind != test.kind {
+			t.Errorf("%s%s: expected kind %v, got %v", test.text, test.suffix, test.kind, value.kind)
+		}
+	}
+}
@@ -0,0 +1,486 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/scanner"
+)
+
+// maxUnknownDefined is the most defined(X) checks on macros that are
+// neither defined nor undefined that a condition can have before
+// it's considered unknown.
+const maxUnknownDefined = 4
+
+// preprocessor evaluates conditional compilation directives.
+//
+// Macros are tri-state, they are either defined, undefined or unknown.
+// If a condition depends on an unknown macro, all of its branches are
+// kept so that the parser can see declarations from both sides of
+// conditions like "#if defined(__cplusplus) && !defined(CINTERFACE)".
+type preprocessor struct {
+	symbols *symbolTable
+	// file is updated with the #pragma once and include guard
+	// information of the file being preprocessed
+	file *includedFile
+	// include is called for each #include in an active branch,
+	// if it's nil, #include directives are ignored.
+	include func(pos scanner.Position, decl string, name string, isSystem bool)
+
+	diagnostics []Diagnostic
+}
+
+// conditional is an #if, #ifdef or #ifndef block
+type conditional struct {
+	// parentActive is true if the block containing this one is active
+	parentActive bool
+	// taken is true if a previous branch was definitely used
+	taken bool
+	// active is true if lines in the current branch are kept
+	active  bool
+	hasElse bool
+}
+
+func newPreprocessor(symbols *symbolTable) *preprocessor {
+	return &preprocessor{
+		symbols: symbols,
+		file:    &includedFile{},
+	}
+}
+
+// preprocess blanks out lines in inactive conditional branches and the
+// conditional directives themselves. Line numbers are preserved so that
+// positions still point at the original header.
+func (pp *preprocessor) preprocess(filename string, src []byte) []byte {
+	lines := bytes.Split(src, []byte("\n"))
+	var stack []conditional
+	isActive := func() bool {
+		return len(stack) == 0 || stack[len(stack)-1].active
+	}
+	inComment := false
+	directiveCount := 0
+	guard := ""
+	guardClosed := false
+	for i := 0; i < len(lines); i++ {
+		lineNumber := i + 1
+		line := string(lines[i])
+		startsInComment := inComment
+		inComment = updateCommentState(line, inComment)
+		directive, rest := "", ""
+		if !startsInComment {
+			directive, rest = parseDirective(line)
+		}
+		if directive == "" {
+			if !isActive() {
+				lines[i] = nil
+			}
+			continue
+		}
+
+		// Join lines ending with \ to the directive
+		for strings.HasSuffix(strings.TrimRight(line, " \t\r"), "\\") && i+1 < len(lines) {
+			if !isActive() || isConditionalDirective(directive) {
+				lines[i] = nil
+			}
+			i++
+			line = string(lines[i])
+			inComment = updateCommentState(line, inComment)
+			rest = strings.TrimSuffix(strings.TrimRight(rest, " \t\r"), "\\") + " " + line
+		}
+		if !isActive() || isConditionalDirective(directive) {
+			lines[i] = nil
+		}
+
+		pos := scanner.Position{
+			Filename: filename,
+			Line:     lineNumber,
+			Column:   1,
+		}
+
+		// Detect include guards, ie.
+		// #ifndef __d3d11_h__
+		// #define __d3d11_h__
+		// ...
+		// #endif
+		if directive != "pragma" {
+			directiveCount++
+			switch {
+			case directiveCount == 1 && directive == "ifndef":
+				if tokens := tokenize(rest); len(tokens) > 0 {
+					guard = tokens[0]
+				}
+			case directiveCount == 2 && directive == "define":
+				if tokens := tokenize(rest); len(tokens) == 0 || tokens[0] != guard {
+					guard = ""
+				}
+			case directiveCount == 2,
+				guardClosed:
+				// Not an include guard if it's not defined straight away
+				// or if there are directives after its #endif
+				guard = ""
+			}
+		}
+
+		switch directive {
+		case "if", "ifdef", "ifndef":
+			c := conditional{
+				parentActive: isActive(),
+			}
+			value, known := false, false
+			if c.parentActive {
+				var err error
+				value, known, err = pp.evaluateCondition(directive, rest)
+				if err != nil {
+					pp.errorf(pos, directive, rest, "%s", err)
+				}
+			}
+			c.enterBranch(value, known)
+			stack = append(stack, c)
+		case "elif", "else":
+			if len(stack) == 0 {
+				pp.errorf(pos, directive, rest, "#%s without #if", directive)
+				continue
+			}
+			c := &stack[len(stack)-1]
+			if c.hasElse {
+				pp.errorf(pos, directive, rest, "#%s after #else", directive)
+				continue
+			}
+			if directive == "else" {
+				c.hasElse = true
+				c.enterBranch(true, true)
+				continue
+			}
+			value, known := false, false
+			if c.parentActive && !c.taken {
+				var err error
+				value, known, err = pp.evaluateCondition(directive, rest)
+				if err != nil {
+					pp.errorf(pos, directive, rest, "%s", err)
+				}
+			}
+			c.enterBranch(value, known)
+		case "endif":
+			if len(stack) == 0 {
+				pp.errorf(pos, directive, rest, "#endif without #if")
+				continue
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				guardClosed = true
+			}
+		case "define":
+			if isActive() {
+				pp.define(rest)
+			}
+		case "undef":
+			if isActive() {
+				pp.undef(rest)
+			}
+		case "pragma":
+			if tokens := tokenize(rest); isActive() && len(tokens) > 0 && tokens[0] == "once" {
+				pp.file.once = true
+			}
+		case "include":
+			if !isActive() || pp.include == nil {
+				continue
+			}
+			name, isSystem, ok := parseIncludeName(rest)
+			if !ok {
+				pp.diagnosticf(pos, SeverityError, directive, rest, "expected \"filename\" or <filename>")
+				continue
+			}
+			pp.include(pos, directiveDecl(directive, rest), name, isSystem)
+		}
+	}
+	if len(stack) > 0 {
+		pp.errorf(scanner.Position{Filename: filename, Line: len(lines)}, "", "", "missing #endif for %d conditional block(s)", len(stack))
+	}
+	if guardClosed {
+		pp.file.guard = guard
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// enterBranch updates the conditional for the next branch of an #if, #elif
+// or #else. Unknown conditions keep the branch active.
+func (c *conditional) enterBranch(value bool, known bool) {
+	if !c.parentActive || c.taken {
+		c.active = false
+		return
+	}
+	if !known {
+		c.active = true
+		return
+	}
+	c.active = value
+	if value {
+		// Any branch after this one is never used
+		c.taken = true
+	}
+}
+
+func (pp *preprocessor) errorf(pos scanner.Position, directive string, rest string, format string, args ...interface{}) {
+	pp.diagnosticf(pos, SeverityError, directive, rest, format, args...)
+}
+
+func (pp *preprocessor) diagnosticf(pos scanner.Position, severity Severity, directive string, rest string, format string, args ...interface{}) {
+	decl := ""
+	if directive != "" {
+		decl = directiveDecl(directive, rest)
+	}
+	pp.diagnostics = append(pp.diagnostics, Diagnostic{
+		Pos:      pos,
+		Severity: severity,
+		Decl:     decl,
+		Msg:      fmt.Sprintf(format, args...),
+	})
+}
+
+// directiveDecl returns the directive as it's shown in diagnostics
+func directiveDecl(directive string, rest string) string {
+	return strings.TrimSpace("#" + directive + " " + strings.Join(strings.Fields(rest), " "))
+}
+
+// evaluateCondition evaluates the expression of an #if, #elif, #ifdef
+// or #ifndef directive. If known is false, the result depends on
+// macros that are neither defined nor undefined.
+func (pp *preprocessor) evaluateCondition(directive string, rest string) (value bool, known bool, err error) {
+	tokens := tokenize(rest)
+	switch directive {
+	case "ifdef", "ifndef":
+		if len(tokens) == 0 {
+			return false, false, errors.New("missing macro name")
+		}
+		ident := tokens[0]
+		isDefined := false
+		switch {
+		case pp.isDefined(ident):
+			isDefined = true
+		case pp.symbols.undefines[ident]:
+			isDefined = false
+		default:
+			return false, false, nil
+		}
+		return isDefined == (directive == "ifdef"), true, nil
+	}
+	if len(tokens) == 0 {
+		return false, false, errors.New("missing expression")
+	}
+
+	// Replace defined(X) with a placeholder if X is unknown, each
+	// combination of values is tried below.
+	var placeholders []string
+	{
+		var r []string
+		for i := 0; i < len(tokens); i++ {
+			if tokens[i] != "defined" {
+				r = append(r, tokens[i])
+				continue
+			}
+			ident := ""
+			if i+3 < len(tokens) && tokens[i+1] == "(" && tokens[i+3] == ")" {
+				ident = tokens[i+2]
+				i += 3
+			} else if i+1 < len(tokens) {
+				ident = tokens[i+1]
+				i++
+			} else {
+				return false, false, errors.New("missing macro name after defined")
+			}
+			switch {
+			case pp.isDefined(ident):
+				r = append(r, "1")
+			case pp.symbols.undefines[ident]:
+				r = append(r, "0")
+			default:
+				placeholder := "defined(" + ident + ")"
+				r = append(r, placeholder)
+				placeholders = append(placeholders, placeholder)
+			}
+		}
+		tokens = r
+	}
+	if len(placeholders) > maxUnknownDefined {
+		return false, false, nil
+	}
+	var result constant
+	for combination := 0; combination < 1<<uint(len(placeholders)); combination++ {
+		hasUnknownIdent := false
+		var lookup func(ident string) (constant, bool)
+		expanding := make(map[string]bool)
+		lookup = func(ident string) (constant, bool) {
+			for i, placeholder := range placeholders {
+				if ident == placeholder {
+					return boolConstant(combination&(1<<uint(i)) != 0), true
+				}
+			}
+			if pp.symbols.undefines[ident] {
+				// Undefined macros are 0 in #if expressions
+				return boolConstant(false), true
+			}
+			valueTokens, ok := pp.symbols.defines[ident]
+			if !ok || len(valueTokens) == 0 || expanding[ident] {
+				hasUnknownIdent = true
+				return boolConstant(false), true
+			}
+			expanding[ident] = true
+			defer delete(expanding, ident)
+			value, err := evaluateExpr(valueTokens, lookup)
+			if err != nil {
+				hasUnknownIdent = true
+				return boolConstant(false), true
+			}
+			return value, true
+		}
+		value, err := evaluateExpr(tokens, lookup)
+		if err != nil {
+			return false, false, err
+		}
+		if hasUnknownIdent {
+			return false, false, nil
+		}
+		if combination > 0 && value.isZero() != result.isZero() {
+			// Result depends on an unknown macro
+			return false, false, nil
+		}
+		result = value
+	}
+	return !result.isZero(), true, nil
+}
+
+func (pp *preprocessor) isDefined(ident string) bool {
+	return pp.symbols.isDefined(ident)
+}
+
+// define records a macro from the rest of a #define directive
+func (pp *preprocessor) define(rest string) {
+	rest = strings.TrimLeft(rest, " \t")
+	end := 0
+	for end < len(rest) && isIdentChar(rest[end]) {
+		end++
+	}
+	if end == 0 {
+		return
+	}
+	ident := rest[:end]
+	delete(pp.symbols.undefines, ident)
+	if end < len(rest) && rest[end] == '(' {
+		// Function-like macros can't be evaluated, only checked
+		// with defined(X)
+		pp.symbols.defines[ident] = nil
+		return
+	}
+	pp.symbols.defines[ident] = tokenize(rest[end:])
+}
+
+// undef records that a macro is undefined from the rest of an #undef directive
+func (pp *preprocessor) undef(rest string) {
+	tokens := tokenize(rest)
+	if len(tokens) == 0 {
+		return
+	}
+	ident := tokens[0]
+	delete(pp.symbols.defines, ident)
+	pp.symbols.undefines[ident] = true
+}
+
+// parseIncludeName returns the filename from the rest of an #include
+// directive, isSystem is true for <filename> and false for "filename"
+func parseIncludeName(rest string) (name string, isSystem bool, ok bool) {
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return "", false, false
+	}
+	end := byte('"')
+	if rest[0] == '<' {
+		end = '>'
+		isSystem = true
+	} else if rest[0] != '"' {
+		return "", false, false
+	}
+	i := strings.IndexByte(rest[1:], end)
+	if i <= 0 {
+		return "", false, false
+	}
+	return rest[1 : i+1], isSystem, true
+}
+
+func isConditionalDirective(directive string) bool {
+	switch directive {
+	case "if", "ifdef", "ifndef", "elif", "else", "endif":
+		return true
+	}
+	return false
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' ||
+		(c >= 'a' && c <= 'z') ||
+		(c >= 'A' && c <= 'Z') ||
+		(c >= '0' && c <= '9')
+}
+
+// parseDirective returns the name of the directive on the line and
+// the text after it, ie. "#ifdef COBJMACROS" returns "ifdef", " COBJMACROS"
+func parseDirective(line string) (string, string) {
+	line = strings.TrimLeft(line, " \t")
+	if !strings.HasPrefix(line, "#") {
+		return "", ""
+	}
+	line = strings.TrimLeft(line[1:], " \t")
+	end := 0
+	for end < len(line) && isIdentChar(line[end]) {
+		end++
+	}
+	return line[:end], line[end:]
+}
+
+// updateCommentState returns true if the line ends inside of
+// a /* block comment */
+func updateCommentState(line string, inComment bool) bool {
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if inComment {
+			if c == '*' && i+1 < len(line) && line[i+1] == '/' {
+				inComment = false
+				i++
+			}
+			continue
+		}
+		switch c {
+		case '/':
+			if i+1 < len(line) {
+				switch line[i+1] {
+				case '/':
+					return false
+				case '*':
+					inComment = true
+					i++
+				}
+			}
+		case '"', '\'':
+			// Skip string and character literals
+			for i++; i < len(line) && line[i] != c; i++ {
+				if line[i] == '\\' {
+					i++
+				}
+			}
+		}
+	}
+	return inComment
+}
+
+// tokenize splits C code into tokens, comments are skipped
+func tokenize(src string) []string {
+	var tokens []string
+	var s scanner.Scanner
+	s.Init(strings.NewReader(src))
+	s.Mode = scanner.GoTokens
+	s.Error = func(s *scanner.Scanner, msg string) {}
+	for tok := s.Scan(); tok != scanner.EOF; tok = s.Scan() {
+		tokens = append(tokens, s.TokenText())
+	}
+	return tokens
+}
@@ -0,0 +1,230 @@
+package parser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/scanner"
+
+	"github.com/silbinarywolf/directx-bind-gen/internal/types"
+)
+
+// symbolTable is shared between all files of a project so that
+// headers can use macros from the headers they include
+type symbolTable struct {
+	// defines are the macros that are defined and their value tokens
+	defines map[string][]string
+	// undefines are the macros that are known to be undefined
+	undefines map[string]bool
+	// values are the evaluated values of #define constants
+	values map[string]constant
+	// enumerators are the values of enum fields
+	enumerators map[string]constant
+	// functionMacros are the function-like macros that are expanded
+	// in the values of #define constants and the bodies of interfaces
+	functionMacros map[string]functionMacro
+	// hresults are the #define constants that are error or status codes
+	hresults map[string]bool
+	// interfaces are the vtbls of COM interfaces so that
+	// derived interfaces can inherit their methods
+	interfaces map[string]*types.Struct
+}
+
+// iunknownSrc declares IUnknown, which is the base of all COM interfaces
+// but is declared in a header that isn't part of the DirectX SDK
+const iunknownSrc = `DECLARE_INTERFACE(IUnknown)
+{
+    STDMETHOD(QueryInterface)(THIS_ REFIID riid, __deref_out void** ppvObject) PURE;
+    STDMETHOD_(ULONG, AddRef)(THIS) PURE;
+    STDMETHOD_(ULONG, Release)(THIS) PURE;
+};`
+
+func newSymbolTable(config Config) *symbolTable {
+	symbols := &symbolTable{
+		defines:     make(map[string][]string),
+		undefines:   make(map[string]bool),
+		values:      make(map[string]constant),
+		enumerators: make(map[string]constant),
+		interfaces:  make(map[string]*types.Struct),
+
+		functionMacros: make(map[string]functionMacro),
+		hresults:       make(map[string]bool),
+	}
+	for ident, value := range config.Defines {
+		symbols.defines[ident] = tokenize(value)
+	}
+	for _, ident := range config.Undefines {
+		symbols.undefines[ident] = true
+	}
+	parse("IUnknown", []byte(iunknownSrc), newPreprocessor(symbols))
+	parse("MAKE_HRESULT", []byte(hresultSrc), newPreprocessor(symbols))
+	parse("TEXT", []byte(textSrc), newPreprocessor(symbols))
+	return symbols
+}
+
+// lookupValue returns the value of the #define constant
+func (symbols *symbolTable) lookupValue(ident string) (constant, bool) {
+	v, ok := symbols.values[ident]
+	return v, ok
+}
+
+// lookupEnumValue returns the value of the enumerator or
+// #define constant, enumerators hide constants as in C
+func (symbols *symbolTable) lookupEnumValue(ident string) (constant, bool) {
+	if v, ok := symbols.enumerators[ident]; ok {
+		return v, true
+	}
+	return symbols.lookupValue(ident)
+}
+
+func (symbols *symbolTable) isDefined(ident string) bool {
+	_, ok := symbols.defines[ident]
+	return ok
+}
+
+// includedFile is a file that has been parsed as part of a project
+type includedFile struct {
+	// once is true if the file has #pragma once
+	once bool
+	// guard is the include guard macro, ie. __d3d11_h__
+	guard string
+}
+
+type projectParser struct {
+	config  Config
+	symbols *symbolTable
+	project types.Project
+	// files are the files that have been parsed, keyed by path
+	files       map[string]*includedFile
+	diagnostics []Diagnostic
+}
+
+// ParseFile parses a DirectX header file. The headers it #includes are
+// parsed for their macros, see ParseFiles, but only the declarations
+// of the file are returned.
+//
+// Declarations that can't be parsed are skipped and reported as
+// diagnostics. The error is only non-nil if the file could not be read.
+func ParseFile(filename string) (types.File, []Diagnostic, error) {
+	project, diagnostics, err := ParseFiles([]string{filename}, Config{})
+	if err != nil {
+		return types.File{}, diagnostics, err
+	}
+	return project.Files[0], diagnostics, nil
+}
+
+// ParseFiles parses the header files and the headers they #include
+// into a project. Each file is parsed once and the macros defined in
+// a header can be used by any header parsed after it.
+//
+// Included headers are searched for in the folder of the header
+// including them and then in the include paths of the config.
+// The error is only non-nil if one of the given files could not be read.
+func ParseFiles(filenames []string, config Config) (types.Project, []Diagnostic, error) {
+	pr := &projectParser{
+		config:  config,
+		symbols: newSymbolTable(config),
+		files:   make(map[string]*includedFile),
+	}
+	for _, filename := range filenames {
+		if err := pr.parseFile(filename); err != nil {
+			return types.Project{}, pr.diagnostics, err
+		}
+	}
+	return pr.project, pr.diagnostics, nil
+}
+
+// parseFile parses the file and the headers it includes. Included
+// headers are added to the project after the file including them.
+func (pr *projectParser) parseFile(filename string) error {
+	key := filepath.Clean(filename)
+	if _, ok := pr.files[key]; ok {
+		return nil
+	}
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	pp := newPreprocessor(pr.symbols)
+	pr.files[key] = pp.file
+	pp.include = func(pos scanner.Position, decl string, name string, isSystem bool) {
+		pr.include(filename, pos, decl, name, isSystem)
+	}
+
+	// Reserve the position of the file so that it's before
+	// the headers it includes
+	index := len(pr.project.Files)
+	pr.project.Files = append(pr.project.Files, types.File{})
+	file, diagnostics := parse(filename, src, pp)
+	pr.project.Files[index] = file
+	pr.diagnostics = append(pr.diagnostics, diagnostics...)
+	return nil
+}
+
+func (pr *projectParser) include(from string, pos scanner.Position, decl string, name string, isSystem bool) {
+	for _, skip := range pr.config.SkipIncludes {
+		if strings.EqualFold(filepath.Base(name), skip) {
+			return
+		}
+	}
+	var dirs []string
+	if !isSystem {
+		dirs = append(dirs, filepath.Dir(from))
+	}
+	dirs = append(dirs, pr.config.IncludePaths...)
+	filename, ok := findFile(dirs, name)
+	if !ok {
+		pr.diagnostics = append(pr.diagnostics, Diagnostic{
+			Pos:      pos,
+			Severity: SeverityWarning,
+			Decl:     decl,
+			Msg:      "cannot find include file: " + name,
+		})
+		return
+	}
+	if file, ok := pr.files[filepath.Clean(filename)]; ok {
+		if file.once ||
+			(file.guard != "" && pr.symbols.isDefined(file.guard)) {
+			return
+		}
+		pr.diagnostics = append(pr.diagnostics, Diagnostic{
+			Pos:      pos,
+			Severity: SeverityWarning,
+			Decl:     decl,
+			Msg:      "file has no include guard or #pragma once, it's only parsed the first time it's included: " + name,
+		})
+		return
+	}
+	if err := pr.parseFile(filename); err != nil {
+		pr.diagnostics = append(pr.diagnostics, Diagnostic{
+			Pos:      pos,
+			Severity: SeverityError,
+			Decl:     decl,
+			Msg:      err.Error(),
+		})
+	}
+}
+
+// findFile returns the path of the first file with the name in the
+// given folders. Like on Windows, names are case-insensitive, ie.
+// "dxgi.h" finds "DXGI.h".
+func findFile(dirs []string, name string) (string, bool) {
+	for _, dir := range dirs {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if info, err := os.Stat(filename); err == nil && !info.IsDir() {
+			return filename, true
+		}
+		dir, base := filepath.Split(filename)
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, info := range infos {
+			if !info.IsDir() && strings.EqualFold(info.Name(), base) {
+				return filepath.Join(dir, info.Name()), true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,214 @@
+package printer
+
+import (
+	"bytes"
+
+	"github.com/silbinarywolf/directx-bind-gen/internal/types"
+	"github.com/silbinarywolf/directx-bind-gen/internal/typetrans"
+)
+
+// printEnumCommon prints the functions shared by the String, Parse and
+// Values functions of each enum, see printEnum
+func printEnumCommon(b *bytes.Buffer) {
+	goType := typetrans.EnumTypeTranslation().GoType
+	b.WriteString(`// enumName is the name of an enum constant
+type enumName struct {
+	value ` + goType + `
+	name  string
+}
+
+// enumString returns the name of the first constant with the value,
+// ie. "FORMAT_UNKNOWN", or the type and value if there's no constant
+func enumString(names []enumName, typeName string, value ` + goType + `) string {
+	for _, name := range names {
+		if name.value == value {
+			return name.name
+		}
+	}
+	return typeName + "(" + strconv.FormatUint(uint64(value), 10) + ")"
+}
+
+// parseEnum returns the value of the constant with the name
+func parseEnum(names []enumName, typeName string, s string) (` + goType + `, error) {
+	for _, name := range names {
+		if name.name == s {
+			return name.value, nil
+		}
+	}
+	return 0, errors.New("unknown " + typeName + " " + strconv.Quote(s))
+}
+
+// flagsString returns the names of the flags that are set in the value,
+// ie. "BIND_VERTEX_BUFFER|BIND_SHADER_RESOURCE", bits that aren't any of
+// the flags are written as a hexadecimal number
+func flagsString(names []enumName, value ` + goType + `) string {
+	for _, name := range names {
+		if name.value == value {
+			return name.name
+		}
+	}
+	s := ""
+	remaining := value
+	for _, name := range names {
+		if name.value == 0 || remaining&name.value != name.value {
+			continue
+		}
+		if s != "" {
+			s += "|"
+		}
+		s += name.name
+		remaining &^= name.value
+	}
+	if remaining != 0 || s == "" {
+		if s != "" {
+			s += "|"
+		}
+		s += "0x" + strconv.FormatUint(uint64(remaining), 16)
+	}
+	return s
+}
+
+// parseFlags returns the value of flags separated by "|", each flag is
+// the name of a constant or a number, see flagsString
+func parseFlags(names []enumName, typeName string, s string) (` + goType + `, error) {
+	var value ` + goType + `
+	for _, part := range strings.Split(s, "|") {
+		part = strings.TrimSpace(part)
+		flag, err := parseEnum(names, typeName, part)
+		if err != nil {
+			n, numErr := strconv.ParseUint(part, 0, 32)
+			if numErr != nil {
+				return 0, err
+			}
+			flag = ` + goType + `(n)
+		}
+		value |= flag
+	}
+	return value, nil
+}
+
+// enumValues returns the distinct values of the constants in the
+// order they're declared
+func enumValues(names []enumName) []` + goType + ` {
+	values := make([]` + goType + `, 0, len(names))
+next:
+	for i, name := range names {
+		for _, other := range names[:i] {
+			if other.value == name.value {
+				continue next
+			}
+		}
+		values = append(values, name.value)
+	}
+	return values
+}
+
+`)
+}
+
+// printEnum prints the enum type, its constants and a table of their
+// names that String, Parse<Enum> and <Enum>Values use.
+//
+// Constants that have the same value as an earlier one are aliases,
+// String returns the name of the first constant declared.
+func (p *printer) printEnum(b *bytes.Buffer, record *types.Enum) {
+	ident := record.Ident
+	goType := typetrans.EnumTypeTranslation().GoType
+	var fields []types.EnumField
+	for _, field := range record.Fields {
+		if field.Ident == field.Value.String() {
+			// ignore referencing self duplicates
+			continue
+		}
+		fields = append(fields, field)
+	}
+	printDoc(b, "", record.Doc)
+	b.WriteString("type " + ident + " " + goType + "\n")
+	b.WriteString("const (\n")
+	for _, field := range fields {
+		printDoc(b, "\t", field.Doc)
+		b.WriteString("\t" + field.Ident + " " + ident + " = " + p.qualify(field.Value.String()) + "\n")
+	}
+	b.WriteString(")\n\n")
+
+	namesIdent := "names" + ident
+	b.WriteString("var " + namesIdent + " = []enumName{\n")
+	for _, field := range fields {
+		b.WriteString("\t{" + goType + "(" + field.Ident + "), \"" + field.Ident + "\"},\n")
+	}
+	b.WriteString("}\n\n")
+
+	if record.Flags {
+		p.printFlags(b, record, fields)
+	} else {
+		b.WriteString("func (v " + ident + ") String() string {\n")
+		b.WriteString("\treturn enumString(" + namesIdent + ", \"" + ident + "\", " + goType + "(v))\n")
+		b.WriteString("}\n\n")
+
+		b.WriteString("// Parse" + ident + " returns the " + ident + " constant with the name")
+		if len(fields) > 0 {
+			b.WriteString(", ie. \"" + fields[0].Ident + "\"")
+		}
+		b.WriteString("\n")
+		b.WriteString("func Parse" + ident + "(s string) (" + ident + ", error) {\n")
+		b.WriteString("\tv, err := parseEnum(" + namesIdent + ", \"" + ident + "\", s)\n")
+		b.WriteString("\treturn " + ident + "(v), err\n")
+		b.WriteString("}\n\n")
+	}
+
+	b.WriteString("// " + ident + "Values returns the distinct values of the " + ident + " constants\n")
+	b.WriteString("func " + ident + "Values() []" + ident + " {\n")
+	b.WriteString("\tvalues := enumValues(" + namesIdent + ")\n")
+	b.WriteString("\tr := make([]" + ident + ", len(values))\n")
+	b.WriteString("\tfor i, v := range values {\n")
+	b.WriteString("\t\tr[i] = " + ident + "(v)\n")
+	b.WriteString("\t}\n")
+	b.WriteString("\treturn r\n")
+	b.WriteString("}\n\n")
+}
+
+// printFlags prints the String and Parse<Enum> functions of an enum of
+// bit flags, and methods to test, set and clear flags
+func (p *printer) printFlags(b *bytes.Buffer, record *types.Enum, fields []types.EnumField) {
+	ident := record.Ident
+	namesIdent := "names" + ident
+	goType := typetrans.EnumTypeTranslation().GoType
+	example := ""
+	if len(fields) >= 2 {
+		example = fields[0].Ident + "|" + fields[1].Ident
+	}
+
+	b.WriteString("// String returns the names of the flags that are set")
+	if example != "" {
+		b.WriteString(", ie. \"" + example + "\"")
+	}
+	b.WriteString("\n")
+	b.WriteString("func (v " + ident + ") String() string {\n")
+	b.WriteString("\treturn flagsString(" + namesIdent + ", " + goType + "(v))\n")
+	b.WriteString("}\n\n")
+
+	b.WriteString("// Has returns true if all of the bits of flag are set\n")
+	b.WriteString("func (v " + ident + ") Has(flag " + ident + ") bool {\n")
+	b.WriteString("\treturn v&flag == flag\n")
+	b.WriteString("}\n\n")
+
+	b.WriteString("// Set returns v with the bits of flag set\n")
+	b.WriteString("func (v " + ident + ") Set(flag " + ident + ") " + ident + " {\n")
+	b.WriteString("\treturn v | flag\n")
+	b.WriteString("}\n\n")
+
+	b.WriteString("// Clear returns v with the bits of flag cleared\n")
+	b.WriteString("func (v " + ident + ") Clear(flag " + ident + ") " + ident + " {\n")
+	b.WriteString("\treturn v &^ flag\n")
+	b.WriteString("}\n\n")
+
+	b.WriteString("// Parse" + ident + " returns the " + ident + " flags with the names separated by \"|\"")
+	if example != "" {
+		b.WriteString(", ie. \"" + example + "\"")
+	}
+	b.WriteString("\n")
+	b.WriteString("func Parse" + ident + "(s string) (" + ident + ", error) {\n")
+	b.WriteString("\tv, err := parseFlags(" + namesIdent + ", \"" + ident + "\", s)\n")
+	b.WriteString("\treturn " + ident + "(v), err\n")
+	b.WriteString("}\n\n")
+}
@@ -0,0 +1,114 @@
+package printer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/silbinarywolf/directx-bind-gen/internal/config"
+	"github.com/silbinarywolf/directx-bind-gen/internal/types"
+)
+
+func TestPrintEnum(t *testing.T) {
+	record := &types.Enum{
+		Ident: "FILL_MODE",
+		Fields: []types.EnumField{
+			enumField("FILL_WIREFRAME", 2),
+			enumField("FILL_SOLID", 3),
+			// Aliases have the value of an earlier constant
+			enumField("FILL_DEFAULT", 3),
+		},
+	}
+	p := &printer{config: &config.Config{}}
+	var b bytes.Buffer
+	p.printEnum(&b, record)
+	tests := []struct {
+		decl     string
+		expected bool
+	}{
+		{"\tFILL_WIREFRAME FILL_MODE = 2\n", true},
+		{"\tFILL_DEFAULT FILL_MODE = 3\n", true},
+		// Constants are named in the order they're declared, so
+		// aliases are named by the first constant
+		{"var namesFILL_MODE = []enumName{\n\t{uint32(FILL_WIREFRAME), \"FILL_WIREFRAME\"},\n\t{uint32(FILL_SOLID), \"FILL_SOLID\"},\n\t{uint32(FILL_DEFAULT), \"FILL_DEFAULT\"},\n}\n", true},
+		{"func (v FILL_MODE) String() string {\n\treturn enumString(namesFILL_MODE, \"FILL_MODE\", uint32(v))\n}\n", true},
+		{"// ParseFILL_MODE returns the FILL_MODE constant with the name, ie. \"FILL_WIREFRAME\"\n", true},
+		{"func ParseFILL_MODE(s string) (FILL_MODE, error) {\n\tv, err := parseEnum(namesFILL_MODE, \"FILL_MODE\", s)\n", true},
+		{"func FILL_MODEValues() []FILL_MODE {\n\tvalues := enumValues(namesFILL_MODE)\n", true},
+		// Only flags have Has, Set and Clear
+		{"func (v FILL_MODE) Has(", false},
+	}
+	for _, test := range tests {
+		if found := strings.Contains(b.String(), test.decl); found != test.expected {
+			t.Errorf("%q: expected found to be %v, got %v in:\n%s", test.decl, test.expected, found, b.String())
+		}
+	}
+}
+
+func TestPrintEnumCommon(t *testing.T) {
+	var b bytes.Buffer
+	printEnumCommon(&b)
+	for _, expected := range []string{
+		// The name of the first constant with the value is returned
+		"\tfor _, name := range names {\n\t\tif name.value == value {\n\t\t\treturn name.name\n\t\t}\n\t}\n\treturn typeName + \"(\" + strconv.FormatUint(uint64(value), 10) + \")\"\n",
+		"\treturn 0, errors.New(\"unknown \" + typeName + \" \" + strconv.Quote(s))\n",
+		// Aliases aren't in the values
+		"\t\tfor _, other := range names[:i] {\n\t\t\tif other.value == name.value {\n\t\t\t\tcontinue next\n",
+	} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("expected %q in:\n%s", expected, b.String())
+		}
+	}
+}
+
+func TestPrintFlags(t *testing.T) {
+	record := &types.Enum{
+		Ident: "COLOR_WRITE_ENABLE",
+		Flags: true,
+		Fields: []types.EnumField{
+			enumField("COLOR_WRITE_ENABLE_RED", 1),
+			enumField("COLOR_WRITE_ENABLE_GREEN", 2),
+			enumField("COLOR_WRITE_ENABLE_ALL", 3),
+		},
+	}
+	p := &printer{config: &config.Config{}}
+	var b bytes.Buffer
+	p.printEnum(&b, record)
+	tests := []struct {
+		decl     string
+		expected bool
+	}{
+		{"// String returns the names of the flags that are set, ie. \"COLOR_WRITE_ENABLE_RED|COLOR_WRITE_ENABLE_GREEN\"\n", true},
+		{"func (v COLOR_WRITE_ENABLE) String() string {\n\treturn flagsString(namesCOLOR_WRITE_ENABLE, uint32(v))\n}\n", true},
+		{"func (v COLOR_WRITE_ENABLE) Has(flag COLOR_WRITE_ENABLE) bool {\n\treturn v&flag == flag\n}\n", true},
+		{"func (v COLOR_WRITE_ENABLE) Set(flag COLOR_WRITE_ENABLE) COLOR_WRITE_ENABLE {\n\treturn v | flag\n}\n", true},
+		{"func (v COLOR_WRITE_ENABLE) Clear(flag COLOR_WRITE_ENABLE) COLOR_WRITE_ENABLE {\n\treturn v &^ flag\n}\n", true},
+		{"func ParseCOLOR_WRITE_ENABLE(s string) (COLOR_WRITE_ENABLE, error) {\n\tv, err := parseFlags(namesCOLOR_WRITE_ENABLE, \"COLOR_WRITE_ENABLE\", s)\n", true},
+		{"func COLOR_WRITE_ENABLEValues() []COLOR_WRITE_ENABLE {", true},
+		// Flags aren't printed with enumString
+		{"enumString(namesCOLOR_WRITE_ENABLE", false},
+	}
+	for _, test := range tests {
+		if found := strings.Contains(b.String(), test.decl); found != test.expected {
+			t.Errorf("%q: expected found to be %v, got %v in:\n%s", test.decl, test.expected, found, b.String())
+		}
+	}
+}
+
+func TestPrintFlagsCommon(t *testing.T) {
+	var b bytes.Buffer
+	printEnumCommon(&b)
+	for _, expected := range []string{
+		// Combinations with a name are printed by it
+		"func flagsString(names []enumName, value uint32) string {\n\tfor _, name := range names {\n\t\tif name.value == value {\n\t\t\treturn name.name\n",
+		// Unknown bits are printed as a hexadecimal number
+		"\t\ts += \"0x\" + strconv.FormatUint(uint64(remaining), 16)\n",
+		// Flags are parsed by name or as a number
+		"\tfor _, part := range strings.Split(s, \"|\") {\n\t\tpart = strings.TrimSpace(part)\n",
+		"\t\t\tn, numErr := strconv.ParseUint(part, 0, 32)\n",
+	} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("expected %q in:\n%s", expected, b.String())
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package printer
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/silbinarywolf/directx-bind-gen/internal/types"
+)
+
+// hresultValue returns the value of the error or status code as the
+// signed 32-bit integer that functions return, ie. 0x887A0005 is -2005270523
+func hresultValue(record types.Macro) (int32, bool) {
+	value, err := strconv.ParseInt(record.Value.String(), 0, 64)
+	if err != nil || value < -1<<31 || value > 1<<32-1 {
+		return 0, false
+	}
+	return int32(uint32(value)), true
+}
+
+// printErrors prints the error and status codes of the file as
+// ErrorValue constants so they can be compared to returned errors
+func (p *printer) printErrors(b *bytes.Buffer, file *types.File) {
+	hasError := false
+	for _, record := range file.Macros {
+		if !record.HRESULT || p.constantAlreadyDefinedMap[record.Ident] {
+			continue
+		}
+		value, ok := hresultValue(record)
+		if !ok {
+			continue
+		}
+		if !hasError {
+			b.WriteString("// Errors\n")
+			b.WriteString("const (\n")
+			hasError = true
+		}
+		printDoc(b, "\t", record.Doc)
+		b.WriteString("\t" + record.Ident + " ErrorValue = " + strconv.FormatInt(int64(value), 10) + " // " + fmt.Sprintf("0x%08X", uint32(value)) + "\n")
+		p.constantAlreadyDefinedMap[record.Ident] = true
+	}
+	if hasError {
+		b.WriteString(")\n\n")
+	}
+}
+
+// printErrorNames prints the C names and messages of the error and status
+// codes of the whole project so that errors from other packages have names
+// too. Codes with the same value as an earlier one are aliases and skipped.
+func (p *printer) printErrorNames(b *bytes.Buffer) {
+	var values []int32
+	names := make(map[int32]string)
+	for _, record := range p.hresults {
+		value, ok := hresultValue(record)
+		if _, exists := names[value]; !ok || exists {
+			continue
+		}
+		values = append(values, value)
+		// ie. "D3D11_ERROR_FILE_NOT_FOUND" rather than "ERROR_FILE_NOT_FOUND"
+		names[value] = record.CIdent
+		if names[value] == "" {
+			names[value] = record.Ident
+		}
+	}
+	b.WriteString("// errorNames are the names of error and status codes\n")
+	b.WriteString("var errorNames = map[ErrorValue]string{\n")
+	for _, value := range values {
+		b.WriteString("\t" + strconv.FormatInt(int64(value), 10) + ": " + strconv.Quote(names[value]) + ",\n")
+	}
+	b.WriteString("}\n\n")
+	b.WriteString("// errorMessages are the messages of error and status codes\n")
+	b.WriteString("var errorMessages = map[ErrorValue]string{\n")
+	for _, value := range values {
+		if message, ok := p.config.ErrorMessages[names[value]]; ok {
+			b.WriteString("\t" + strconv.FormatInt(int64(value), 10) + ": " + strconv.Quote(message) + ",\n")
+		}
+	}
+	b.WriteString("}\n\n")
+}
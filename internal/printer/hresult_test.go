@@ -0,0 +1,74 @@
+package printer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/silbinarywolf/directx-bind-gen/internal/config"
+	"github.com/silbinarywolf/directx-bind-gen/internal/types"
+)
+
+func hresult(ident, cIdent, value string) types.Macro {
+	return types.Macro{
+		Ident:   ident,
+		Source:  types.Source{CIdent: cIdent},
+		Value:   types.Value{RawValue: value},
+		HRESULT: true,
+	}
+}
+
+func TestHresultValue(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected int32
+		ok       bool
+	}{
+		{"0", 0, true},
+		{"142213121", 142213121, true},
+		{"-2005270523", -2005270523, true},
+		// Unsigned values are the same code as a signed 32-bit integer
+		{"0x887A0005", -2005270523, true},
+		{"0x100000000", 0, false},
+		{"MAKE_DXGI_HRESULT(5)", 0, false},
+	}
+	for _, test := range tests {
+		value, ok := hresultValue(hresult("CODE", "", test.value))
+		if value != test.expected || ok != test.ok {
+			t.Errorf("%s: expected %d and %v, got %d and %v", test.value, test.expected, test.ok, value, ok)
+		}
+	}
+}
+
+func TestPrintErrorNames(t *testing.T) {
+	p := &printer{
+		config: &config.Config{
+			ErrorMessages: map[string]string{
+				"D3D11_ERROR_FILE_NOT_FOUND": "The file was not found.",
+				"ERROR_FILE_NOT_FOUND":       "Not the C name.",
+			},
+		},
+		hresults: []types.Macro{
+			// ie. D3D11_ERROR_FILE_NOT_FOUND with its prefix stripped
+			hresult("ERROR_FILE_NOT_FOUND", "D3D11_ERROR_FILE_NOT_FOUND", "0x887C0002"),
+			// Codes without a C name are named by their identifier
+			hresult("S_FALSE", "", "1"),
+			// Aliases have the name of the earlier code
+			hresult("ALIAS", "D3D11_ALIAS", "1"),
+			hresult("UNKNOWN", "D3D11_UNKNOWN", "MAKE_D3D11_HRESULT(5)"),
+		},
+	}
+	var b bytes.Buffer
+	p.printErrorNames(&b)
+	expected := "// errorNames are the names of error and status codes\n" +
+		"var errorNames = map[ErrorValue]string{\n" +
+		"\t-2005139454: \"D3D11_ERROR_FILE_NOT_FOUND\",\n" +
+		"\t1: \"S_FALSE\",\n" +
+		"}\n\n" +
+		"// errorMessages are the messages of error and status codes\n" +
+		"var errorMessages = map[ErrorValue]string{\n" +
+		"\t-2005139454: \"The file was not found.\",\n" +
+		"}\n\n"
+	if b.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, b.String())
+	}
+}
@@ -0,0 +1,372 @@
+package printer
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+
+	"github.com/silbinarywolf/directx-bind-gen/internal/types"
+	"github.com/silbinarywolf/directx-bind-gen/internal/typetrans"
+)
+
+// goArch is an architecture that Go struct layouts are computed for
+type goArch struct {
+	// ptrSize is the size of pointers in bytes
+	ptrSize int
+	// maxAlign is the largest alignment of a type, 64-bit types
+	// are only aligned to 4 bytes on 386
+	maxAlign int
+}
+
+var (
+	goArch386   = goArch{ptrSize: 4, maxAlign: 4}
+	goArchAMD64 = goArch{ptrSize: 8, maxAlign: 8}
+)
+
+// goBasicTypes are the sizes of Go's basic types, 0 is the pointer size
+var goBasicTypes = map[string]int{
+	"bool":    1,
+	"int8":    1,
+	"uint8":   1,
+	"byte":    1,
+	"int16":   2,
+	"uint16":  2,
+	"int32":   4,
+	"uint32":  4,
+	"float32": 4,
+	"rune":    4,
+	"int64":   8,
+	"uint64":  8,
+	"float64": 8,
+	"int":     0,
+	"uint":    0,
+	"uintptr": 0,
+}
+
+// goTypeLayout is the size and alignment of a Go type in bytes
+type goTypeLayout struct {
+	size  int
+	align int
+}
+
+// padding is the padding to insert before a struct field, or after
+// the last field, so that the Go struct has the same layout as in C
+type padding struct {
+	x86 int
+	x64 int
+}
+
+func (pad padding) isZero() bool {
+	return pad.x86 == 0 && pad.x64 == 0
+}
+
+// goType returns the Go type of the padding
+func (pad padding) goType() (string, bool) {
+	return byteArrayType(pad.x86, pad.x64)
+}
+
+// byteArrayType returns the type of a byte array with the length on
+// each architecture. If the lengths are different, the length is
+// computed from the size of a pointer.
+func byteArrayType(x86, x64 int) (string, bool) {
+	if x86 == x64 {
+		return "[" + strconv.Itoa(x86) + "]byte", true
+	}
+	// Solve len = a + b*ptrSize for 4-byte and 8-byte pointers
+	if (x64-x86)%4 != 0 {
+		return "", false
+	}
+	const ptrSize = "unsafe.Sizeof(uintptr(0))"
+	b := (x64 - x86) / 4
+	a := x86 - b*4
+	term := ptrSize
+	if b != 1 && b != -1 {
+		term = strconv.Itoa(abs(b)) + "*" + ptrSize
+	}
+	switch {
+	case a == 0:
+		return "[" + term + "]byte", true
+	case b > 0 && a > 0:
+		return "[" + strconv.Itoa(a) + " + " + term + "]byte", true
+	case b > 0:
+		return "[" + term + " - " + strconv.Itoa(-a) + "]byte", true
+	default:
+		return "[" + strconv.Itoa(a) + " - " + term + "]byte", true
+	}
+}
+
+// structPadding returns the padding to insert before each field of the
+// struct and after the last field, so that fields are at the offsets
+// MSVC uses. ok is false if the struct has no layout or if Go aligns
+// a field past its offset in C.
+func (p *printer) structPadding(record *types.Struct) (fields []padding, trailing padding, ok bool) {
+	if record.Layout == nil {
+		return nil, padding{}, false
+	}
+	fields = make([]padding, len(record.Fields))
+	for _, arch := range []goArch{goArch386, goArchAMD64} {
+		layout := record.Layout.X86
+		if arch.ptrSize == 8 {
+			layout = record.Layout.X64
+		}
+		offset := 0
+		align := 1
+		for i, field := range record.Fields {
+			fieldLayout, ok := p.goFieldLayout(field, arch)
+			if !ok {
+				return nil, padding{}, false
+			}
+			offset = alignUp(offset, fieldLayout.align)
+			pad := layout.Offsets[i] - offset
+			if pad < 0 {
+				return nil, padding{}, false
+			}
+			if arch.ptrSize == 8 {
+				fields[i].x64 = pad
+			} else {
+				fields[i].x86 = pad
+			}
+			offset += pad + fieldLayout.size
+			if fieldLayout.align > align {
+				align = fieldLayout.align
+			}
+		}
+		if alignUp(offset, align) != layout.Size {
+			pad := layout.Size - offset
+			if pad < 0 || alignUp(layout.Size, align) != layout.Size {
+				return nil, padding{}, false
+			}
+			if arch.ptrSize == 8 {
+				trailing.x64 = pad
+			} else {
+				trailing.x86 = pad
+			}
+		}
+	}
+	return fields, trailing, true
+}
+
+// goStructLayout returns the layout of the struct as it's printed
+func (p *printer) goStructLayout(record *types.Struct, arch goArch) (goTypeLayout, bool) {
+	r := goTypeLayout{align: 1}
+	for _, field := range record.Fields {
+		fieldLayout, ok := p.goFieldLayout(field, arch)
+		if !ok {
+			return goTypeLayout{}, false
+		}
+		r.size = alignUp(r.size, fieldLayout.align) + fieldLayout.size
+		if fieldLayout.align > r.align {
+			r.align = fieldLayout.align
+		}
+	}
+	r.size = alignUp(r.size, r.align)
+	if _, _, ok := p.structPadding(record); ok {
+		// Structs are padded to their size in C
+		r.size = record.Layout.X86.Size
+		if arch.ptrSize == 8 {
+			r.size = record.Layout.X64.Size
+		}
+	}
+	return r, true
+}
+
+func (p *printer) goFieldLayout(field types.StructField, arch goArch) (goTypeLayout, bool) {
+	if union, ok := field.TypeInfo.Type.(*types.Union); ok {
+		if _, ok := unionType(union); !ok {
+			// The union is missing from the struct
+			return goTypeLayout{}, false
+		}
+		layout := union.Layout.X86
+		if arch.ptrSize == 8 {
+			layout = union.Layout.X64
+		}
+		// Unions are aligned with a zero length array, see printUnionField
+		align := layout.Align
+		if align > arch.maxAlign {
+			align = arch.maxAlign
+		}
+		return goTypeLayout{layout.Size, align}, true
+	}
+	expr, err := parser.ParseExpr(field.TypeInfo.GoType)
+	if err != nil {
+		return goTypeLayout{}, false
+	}
+	return p.goTypeLayout(expr, arch)
+}
+
+func (p *printer) goTypeLayout(expr ast.Expr, arch goArch) (goTypeLayout, bool) {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return goTypeLayout{arch.ptrSize, arch.ptrSize}, true
+	case *ast.ArrayType:
+		lit, ok := expr.Len.(*ast.BasicLit)
+		if !ok || lit.Kind != token.INT {
+			return goTypeLayout{}, false
+		}
+		n, err := strconv.Atoi(lit.Value)
+		if err != nil {
+			return goTypeLayout{}, false
+		}
+		elem, ok := p.goTypeLayout(expr.Elt, arch)
+		elem.size *= n
+		return elem, ok
+	case *ast.Ident:
+		return p.goIdentLayout(expr.Name, arch)
+	}
+	return goTypeLayout{}, false
+}
+
+func (p *printer) goIdentLayout(ident string, arch goArch) (goTypeLayout, bool) {
+	if size, ok := goBasicTypes[ident]; ok {
+		if size == 0 {
+			size = arch.ptrSize
+		}
+		align := size
+		if align > arch.maxAlign {
+			align = arch.maxAlign
+		}
+		return goTypeLayout{size, align}, true
+	}
+	if record, ok := p.structs[ident]; ok {
+		return p.goStructLayout(record, arch)
+	}
+	if p.enums[ident] {
+		return p.goIdentLayout(typetrans.EnumTypeTranslation().GoType, arch)
+	}
+	if alias, ok := p.aliases[ident]; ok && alias != ident {
+		expr, err := parser.ParseExpr(alias)
+		if err != nil {
+			return goTypeLayout{}, false
+		}
+		return p.goTypeLayout(expr, arch)
+	}
+	return goTypeLayout{}, false
+}
+
+func alignUp(offset int, align int) int {
+	return (offset + align - 1) / align * align
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// printLayoutTests prints a test case for each struct of the file that
+// has a layout, see printLayoutTest
+func (p *printer) printLayoutTests(b *bytes.Buffer, file *types.File) {
+	for i := 0; i < len(file.Structs); i++ {
+		record := &file.Structs[i]
+		if p.structs[record.Ident] != record {
+			// Duplicate declarations aren't tested
+			continue
+		}
+		printLayoutTestCase(b, record)
+		if record.VtblStruct != nil {
+			printLayoutTestCase(b, record.VtblStruct)
+		}
+	}
+}
+
+func printLayoutTestCase(b *bytes.Buffer, record *types.Struct) {
+	if record.Layout == nil {
+		return
+	}
+	var fields []string
+	var x86Offsets, x64Offsets []string
+	for i, field := range record.Fields {
+		name := field.Name
+		if union, ok := field.TypeInfo.Type.(*types.Union); ok {
+			if _, ok := unionType(union); !ok {
+				// The struct doesn't have the layout of C without the union
+				return
+			}
+			name = unionFieldName(record.Fields, i)
+		}
+		if name == "" {
+			continue
+		}
+		fields = append(fields, name)
+		x86Offsets = append(x86Offsets, strconv.Itoa(record.Layout.X86.Offsets[i]))
+		x64Offsets = append(x64Offsets, strconv.Itoa(record.Layout.X64.Offsets[i]))
+	}
+	value := record.Ident + "{}"
+	b.WriteString("\t\t{\n")
+	b.WriteString("\t\t\tname: " + strconv.Quote(record.Ident) + ",\n")
+	b.WriteString("\t\t\tfields: []string{")
+	for i, field := range fields {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(strconv.Quote(field))
+	}
+	b.WriteString("},\n")
+	b.WriteString("\t\t\tgot: structLayout{unsafe.Sizeof(" + value + "), unsafe.Alignof(" + value + "), []uintptr{")
+	for i, field := range fields {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("unsafe.Offsetof(" + value + "." + field + ")")
+	}
+	b.WriteString("}},\n")
+	// NOTE: Go doesn't align 64-bit types to 8 bytes on 386,
+	// so structs are at most 4-byte aligned
+	x86Align := record.Layout.X86.Align
+	if x86Align > goArch386.maxAlign {
+		x86Align = goArch386.maxAlign
+	}
+	b.WriteString("\t\t\tx86: structLayout{" + strconv.Itoa(record.Layout.X86.Size) + ", " + strconv.Itoa(x86Align) + ", []uintptr{" + strings.Join(x86Offsets, ", ") + "}},\n")
+	b.WriteString("\t\t\tx64: structLayout{" + strconv.Itoa(record.Layout.X64.Size) + ", " + strconv.Itoa(record.Layout.X64.Align) + ", []uintptr{" + strings.Join(x64Offsets, ", ") + "}},\n")
+	b.WriteString("\t\t},\n")
+}
+
+// printLayoutTest prints a test that asserts the size, alignment and field
+// offsets of the structs in the package are the same as in C
+func printLayoutTest(b *bytes.Buffer, testCases []byte) {
+	b.WriteString(`// structLayout is the size, alignment and field offsets of a struct
+type structLayout struct {
+	size    uintptr
+	align   uintptr
+	offsets []uintptr
+}
+
+// TestLayout tests that structs have the same layout as when they're
+// compiled with MSVC, so that they can be passed to DirectX.
+//
+// Go doesn't align 64-bit fields to 8 bytes on 386, so structs are
+// only expected to be 4-byte aligned, and padded to their size in C.
+func TestLayout(t *testing.T) {
+	tests := []struct {
+		name     string
+		fields   []string
+		got      structLayout
+		x86, x64 structLayout
+	}{
+`)
+	b.Write(testCases)
+	b.WriteString(`	}
+	for _, test := range tests {
+		want := test.x86
+		if unsafe.Sizeof(uintptr(0)) == 8 {
+			want = test.x64
+		}
+		if test.got.size != want.size {
+			t.Errorf("unsafe.Sizeof(%s{}) is %d, not %d", test.name, test.got.size, want.size)
+		}
+		if test.got.align != want.align {
+			t.Errorf("unsafe.Alignof(%s{}) is %d, not %d", test.name, test.got.align, want.align)
+		}
+		for i, field := range test.fields {
+			if test.got.offsets[i] != want.offsets[i] {
+				t.Errorf("unsafe.Offsetof(%s{}.%s) is %d, not %d", test.name, field, test.got.offsets[i], want.offsets[i])
+			}
+		}
+	}
+}
+`)
+}
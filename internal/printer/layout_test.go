@@ -0,0 +1,240 @@
+package printer
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/silbinarywolf/directx-bind-gen/internal/config"
+	"github.com/silbinarywolf/directx-bind-gen/internal/types"
+)
+
+func TestPrintLayoutTests(t *testing.T) {
+	project := &types.Project{
+		Files: []types.File{
+			{
+				Filename: "D3D11.h",
+				Structs: []types.Struct{
+					{
+						Ident: "BUFFER_DESC",
+						Fields: []types.StructField{
+							basicField("ByteWidth", "uint32"),
+							basicField("pSysMem", "uintptr"),
+						},
+						Layout: &types.Layout{
+							X86: types.StructLayout{Size: 8, Align: 4, Offsets: []int{0, 4}},
+							X64: types.StructLayout{Size: 16, Align: 8, Offsets: []int{0, 8}},
+						},
+					},
+					{
+						// Structs without a layout aren't tested
+						Ident:  "NO_LAYOUT",
+						Fields: []types.StructField{basicField("Value", "uint32")},
+					},
+				},
+			},
+		},
+	}
+	files := printProject(t, project, &config.Config{Package: "d3d11", LayoutTests: true})
+	src := outputFile(t, files, "layout_test.go")
+	for _, expected := range []string{
+		`name:   "BUFFER_DESC"`,
+		`fields: []string{"ByteWidth", "pSysMem"}`,
+		`x86:    structLayout{8, 4, []uintptr{0, 4}}`,
+		`x64:    structLayout{16, 8, []uintptr{0, 8}}`,
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected layout_test.go to contain %q:\n%s", expected, src)
+		}
+	}
+	if strings.Contains(src, "NO_LAYOUT") {
+		t.Errorf("expected NO_LAYOUT to not be tested:\n%s", src)
+	}
+
+	files = printProject(t, project, &config.Config{Package: "d3d11"})
+	for _, file := range files {
+		if file.Filename == "layout_test.go" {
+			t.Errorf("expected no layout_test.go without LayoutTests")
+		}
+	}
+}
+
+func TestPrintLayoutTestCase(t *testing.T) {
+	union := types.NewUnion(types.Union{
+		Layout: &types.Layout{
+			X86: types.StructLayout{Size: 8, Align: 8},
+			X64: types.StructLayout{Size: 8, Align: 8},
+		},
+	})
+	record := &types.Struct{
+		Ident: "VIEW_DESC",
+		Fields: []types.StructField{
+			basicField("Format", "uint32"),
+			{TypeInfo: union},
+		},
+		Layout: &types.Layout{
+			X86: types.StructLayout{Size: 16, Align: 8, Offsets: []int{0, 8}},
+			X64: types.StructLayout{Size: 16, Align: 8, Offsets: []int{0, 8}},
+		},
+	}
+	var b bytes.Buffer
+	printLayoutTestCase(&b, record)
+	expected := []string{
+		"\t\t{",
+		"\t\t\tname: \"VIEW_DESC\",",
+		// Anonymous unions are tested by the name of their field
+		"\t\t\tfields: []string{\"Format\", \"union0\"},",
+		"\t\t\tgot: structLayout{unsafe.Sizeof(VIEW_DESC{}), unsafe.Alignof(VIEW_DESC{}), []uintptr{unsafe.Offsetof(VIEW_DESC{}.Format), unsafe.Offsetof(VIEW_DESC{}.union0)}},",
+		// Go aligns 64-bit types to 4 bytes on 386
+		"\t\t\tx86: structLayout{16, 4, []uintptr{0, 8}},",
+		"\t\t\tx64: structLayout{16, 8, []uintptr{0, 8}},",
+		"\t\t},",
+		"",
+	}
+	if lines := strings.Split(b.String(), "\n"); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), b.String())
+	}
+}
+
+func TestPrintLayoutTestCaseMissingUnion(t *testing.T) {
+	// The union's size on x86 and x64 doesn't differ by pointers, so
+	// it's missing from the struct
+	union := types.NewUnion(types.Union{
+		Layout: &types.Layout{
+			X86: types.StructLayout{Size: 4, Align: 4},
+			X64: types.StructLayout{Size: 6, Align: 2},
+		},
+	})
+	record := &types.Struct{
+		Ident:  "VIEW_DESC",
+		Fields: []types.StructField{basicField("Format", "uint32"), {TypeInfo: union}},
+		Layout: &types.Layout{
+			X86: types.StructLayout{Size: 8, Align: 4, Offsets: []int{0, 4}},
+			X64: types.StructLayout{Size: 12, Align: 4, Offsets: []int{0, 4}},
+		},
+	}
+	var b bytes.Buffer
+	printLayoutTestCase(&b, record)
+	if b.Len() != 0 {
+		t.Errorf("expected no test case, got:\n%s", b.String())
+	}
+}
+
+func TestStructPadding(t *testing.T) {
+	layout := func(x86Size int, x86Offsets []int, x64Size int, x64Offsets []int) *types.Layout {
+		return &types.Layout{
+			X86: types.StructLayout{Size: x86Size, Offsets: x86Offsets},
+			X64: types.StructLayout{Size: x64Size, Offsets: x64Offsets},
+		}
+	}
+	tests := []struct {
+		name     string
+		fields   []types.StructField
+		layout   *types.Layout
+		paddings []padding
+		trailing padding
+		ok       bool
+	}{
+		{
+			name:     "no padding",
+			fields:   []types.StructField{basicField("Width", "uint32"), basicField("pData", "uintptr")},
+			layout:   layout(8, []int{0, 4}, 16, []int{0, 8}),
+			paddings: []padding{{}, {}},
+			ok:       true,
+		},
+		{
+			name:     "field padding",
+			fields:   []types.StructField{basicField("Width", "uint32"), basicField("Height", "uint32")},
+			layout:   layout(12, []int{0, 8}, 12, []int{0, 8}),
+			paddings: []padding{{}, {4, 4}},
+			ok:       true,
+		},
+		{
+			// Go only aligns uint64 to 4 bytes on 386
+			name:     "trailing padding",
+			fields:   []types.StructField{basicField("Value", "uint64"), basicField("Flags", "uint32")},
+			layout:   layout(16, []int{0, 8}, 16, []int{0, 8}),
+			paddings: []padding{{}, {}},
+			trailing: padding{4, 0},
+			ok:       true,
+		},
+		{
+			name:     "enum and alias",
+			fields:   []types.StructField{basicField("Usage", "USAGE"), basicField("Handle", "HANDLE")},
+			layout:   layout(8, []int{0, 4}, 16, []int{0, 8}),
+			paddings: []padding{{}, {}},
+			ok:       true,
+		},
+		{
+			name:   "packed",
+			fields: []types.StructField{basicField("Tag", "uint16"), basicField("Value", "uint32")},
+			layout: layout(6, []int{0, 2}, 6, []int{0, 2}),
+			ok:     false,
+		},
+		{
+			name: "missing union",
+			fields: []types.StructField{
+				basicField("Format", "uint32"),
+				{TypeInfo: types.NewUnion(types.Union{Layout: &types.Layout{
+					X86: types.StructLayout{Size: 4, Align: 4},
+					X64: types.StructLayout{Size: 6, Align: 2},
+				}})},
+			},
+			layout: layout(8, []int{0, 4}, 12, []int{0, 4}),
+			ok:     false,
+		},
+		{
+			name:   "no layout",
+			fields: []types.StructField{basicField("Width", "uint32")},
+			ok:     false,
+		},
+		{
+			name:   "unknown type",
+			fields: []types.StructField{basicField("Width", "UNKNOWN")},
+			layout: layout(4, []int{0}, 4, []int{0}),
+			ok:     false,
+		},
+	}
+	p := &printer{
+		config:  &config.Config{},
+		structs: make(map[string]*types.Struct),
+		enums:   map[string]bool{"USAGE": true},
+		aliases: map[string]string{"HANDLE": "uintptr"},
+	}
+	for _, test := range tests {
+		record := &types.Struct{Ident: "DESC", Fields: test.fields, Layout: test.layout}
+		paddings, trailing, ok := p.structPadding(record)
+		if ok != test.ok {
+			t.Errorf("%s: expected ok to be %v, got %v", test.name, test.ok, ok)
+			continue
+		}
+		if !reflect.DeepEqual(paddings, test.paddings) || trailing != test.trailing {
+			t.Errorf("%s: expected padding %v and %v, got %v and %v", test.name, test.paddings, test.trailing, paddings, trailing)
+		}
+	}
+}
+
+func TestByteArrayType(t *testing.T) {
+	tests := []struct {
+		x86, x64 int
+		goType   string
+		ok       bool
+	}{
+		{4, 4, "[4]byte", true},
+		{0, 0, "[0]byte", true},
+		{4, 8, "[unsafe.Sizeof(uintptr(0))]byte", true},
+		{8, 16, "[2*unsafe.Sizeof(uintptr(0))]byte", true},
+		{12, 16, "[8 + unsafe.Sizeof(uintptr(0))]byte", true},
+		{0, 4, "[unsafe.Sizeof(uintptr(0)) - 4]byte", true},
+		{8, 4, "[12 - unsafe.Sizeof(uintptr(0))]byte", true},
+		// The difference isn't a multiple of the pointer sizes
+		{4, 6, "", false},
+	}
+	for _, test := range tests {
+		goType, ok := byteArrayType(test.x86, test.x64)
+		if goType != test.goType || ok != test.ok {
+			t.Errorf("byteArrayType(%d, %d): expected %q, %v, got %q, %v", test.x86, test.x64, test.goType, test.ok, goType, ok)
+		}
+	}
+}
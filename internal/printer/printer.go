@@ -2,10 +2,19 @@ package printer
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"unicode/utf16"
 
+	"github.com/silbinarywolf/directx-bind-gen/internal/config"
 	"github.com/silbinarywolf/directx-bind-gen/internal/types"
 	"github.com/silbinarywolf/directx-bind-gen/internal/typetrans"
 )
@@ -14,22 +23,307 @@ import (
 // to pass in a pointer-pointer to methods accepting a GUID/output value
 const interfaceWithGuid = "interface{}"
 
-func PrintProject(project *types.Project) []byte {
-	enumTypeTranslation := typetrans.EnumTypeTranslation()
-	constantAlreadyDefinedMap := make(map[string]bool)
+// OutputFile is a Go file printed by PrintProject
+type OutputFile struct {
+	// Package is the name of the package that the file is in
+	Package string
+	// ImportPath is the import path of the package
+	ImportPath string
+	// Filename is the path of the file relative to the output folder,
+	// ie. "d3d11.go" or "dxgi/dxgi.go"
+	Filename string
+	Data     []byte
+}
+
+// generatedComment starts every file printed by PrintProject
+const generatedComment = "// Code generated by directx-bind-gen"
+
+// IsGenerated returns true if the Go file was printed by PrintProject
+func IsGenerated(src []byte) bool {
+	return bytes.HasPrefix(src, []byte(generatedComment))
+}
+
+// stdPackages are the standard library packages that the bindings can use
+var stdPackages = []string{"errors", "reflect", "strconv", "strings", "syscall", "testing", "unsafe"}
+
+type printer struct {
+	config *config.Config
+	// pkg is the name of the package being printed
+	pkg string
+	// packages are the names of the packages in the order they're printed
+	packages []string
+	// declPackages maps the Go identifiers declared by the project
+	// to the package they're declared in
+	declPackages map[string]string
+	// interfaces are the COM interfaces in the project so that methods
+	// to convert to the interfaces they inherit from can be generated
+	interfaces map[string]*types.Struct
+	// structs, enums and aliases are the types declared by the project
+	// so that the layout of structs can be computed
+	structs                   map[string]*types.Struct
+	enums                     map[string]bool
+	aliases                   map[string]string
+	constantAlreadyDefinedMap map[string]bool
+	// hresults are the error and status codes of the project
+	hresults []types.Macro
+}
+
+// PrintProject generates Golang bindings for the project with a file per
+// header. If the config has Packages, the declarations of their headers
+// are printed in a package of their own that is imported by the others.
+//
+// Files are formatted with gofmt, if a file can't be formatted, the
+// unformatted output is returned with the error.
+func PrintProject(project *types.Project, config *config.Config) ([]OutputFile, error) {
+	if len(config.Packages) > 0 && config.ImportPath == "" {
+		return nil, errors.New("ImportPath must be set to generate Packages")
+	}
+	p := &printer{
+		config:                    config,
+		declPackages:              make(map[string]string),
+		interfaces:                make(map[string]*types.Struct),
+		structs:                   make(map[string]*types.Struct),
+		enums:                     make(map[string]bool),
+		aliases:                   make(map[string]string),
+		constantAlreadyDefinedMap: make(map[string]bool),
+	}
+	for _, file := range project.Files {
+		pkg := config.FilePackage(file.Filename)
+		p.addPackage(pkg)
+		p.declare(&file, pkg)
+		for i := 0; i < len(file.Structs); i++ {
+			record := &file.Structs[i]
+			if _, ok := p.structs[record.Ident]; !ok {
+				p.structs[record.Ident] = record
+			}
+			if record.VtblStruct != nil {
+				p.interfaces[record.Ident] = record
+			}
+		}
+		for _, record := range file.Enums {
+			p.enums[record.Ident] = true
+		}
+		for _, record := range file.Macros {
+			if record.HRESULT {
+				p.hresults = append(p.hresults, record)
+			}
+		}
+		for _, record := range file.TypeAliases {
+			alias := typetrans.GoTypeFromAlias(record.Alias)
+			if _, ok := p.aliases[record.Ident]; !ok {
+				p.aliases[record.Ident] = alias
+			}
+		}
+	}
+
+	var files []OutputFile
+	var firstErr error
+	addFile := func(pkg string, filename string, comment string, body []byte) {
+		data, err := p.printFile(pkg, comment, body)
+		if err != nil && firstErr == nil {
+			firstErr = errors.New("cannot format " + filename + ": " + err.Error())
+		}
+		files = append(files, OutputFile{
+			Package:    pkg,
+			ImportPath: p.importPath(pkg),
+			Filename:   path.Join(p.packageDir(pkg), filename),
+			Data:       data,
+		})
+	}
+	for _, pkg := range p.packages {
+		p.pkg = pkg
+		var b, calls bytes.Buffer
+		p.printCommon(&b, &calls)
+		addFile(pkg, "common.go", generatedComment+". DO NOT EDIT.", b.Bytes())
+		addFile(pkg, "common_windows.go", generatedComment+". DO NOT EDIT.", calls.Bytes())
+	}
+	filenames := make(map[string]string)
+	layoutTests := make(map[string]*bytes.Buffer)
+	for _, file := range project.Files {
+		p.pkg = config.FilePackage(file.Filename)
+		var b, calls bytes.Buffer
+		p.printDecls(&b, &calls, &file)
+		if config.LayoutTests {
+			if layoutTests[p.pkg] == nil {
+				layoutTests[p.pkg] = &bytes.Buffer{}
+			}
+			p.printLayoutTests(layoutTests[p.pkg], &file)
+		}
+		if b.Len() == 0 && calls.Len() == 0 {
+			continue
+		}
+		header := filepath.Base(file.Filename)
+		name := strings.ToLower(strings.TrimSuffix(header, filepath.Ext(header)))
+		if other, ok := filenames[path.Join(p.pkg, name)]; ok {
+			return nil, errors.New(header + " and " + other + " would both be generated as " + name + ".go")
+		}
+		filenames[path.Join(p.pkg, name)] = header
+		comment := generatedComment + " from " + header + ". DO NOT EDIT."
+		if filepath.Ext(header) == "" {
+			// Declarations from the config
+			comment = generatedComment + ". DO NOT EDIT."
+		}
+		if b.Len() > 0 {
+			addFile(p.pkg, name+".go", comment, b.Bytes())
+		}
+		if calls.Len() > 0 {
+			addFile(p.pkg, name+"_windows.go", comment, calls.Bytes())
+		}
+	}
+	for _, pkg := range p.packages {
+		tests, ok := layoutTests[pkg]
+		if !ok || tests.Len() == 0 {
+			continue
+		}
+		var b bytes.Buffer
+		printLayoutTest(&b, tests.Bytes())
+		addFile(pkg, "layout_test.go", generatedComment+". DO NOT EDIT.", b.Bytes())
+	}
+	return files, firstErr
+}
+
+func (p *printer) addPackage(pkg string) {
+	for _, other := range p.packages {
+		if other == pkg {
+			return
+		}
+	}
+	p.packages = append(p.packages, pkg)
+}
+
+// declare records the package of the identifiers declared by the file,
+// if an identifier is declared more than once, the first is used
+func (p *printer) declare(file *types.File, pkg string) {
+	add := func(ident string) {
+		if _, ok := p.declPackages[ident]; !ok {
+			p.declPackages[ident] = pkg
+		}
+	}
+	for _, record := range file.Macros {
+		if record.Ident != record.Value.String() {
+			add(record.Ident)
+		}
+	}
+	for _, record := range file.Guids {
+		add(record.Ident)
+	}
+	for _, record := range file.Functions {
+		add(record.Ident)
+	}
+	for _, record := range file.Structs {
+		add(record.Ident)
+		if record.VtblStruct != nil {
+			add(record.VtblStruct.Ident)
+		}
+	}
+	for _, record := range file.TypeAliases {
+		// NOTE: Aliases of the same identifier, ie. D3D11_PRIMITIVE
+		// to D3D_PRIMITIVE once stripped, aren't printed
+		if record.Ident != record.Alias {
+			add(record.Ident)
+		}
+	}
+	for _, record := range file.Enums {
+		add(record.Ident)
+		for _, field := range record.Fields {
+			add(field.Ident)
+		}
+	}
+}
+
+// packageDir returns the folder of the package relative to the output folder
+func (p *printer) packageDir(pkg string) string {
+	if pkg == p.config.Package {
+		return ""
+	}
+	return pkg
+}
+
+func (p *printer) importPath(pkg string) string {
+	if p.config.ImportPath == "" {
+		return pkg
+	}
+	return path.Join(p.config.ImportPath, p.packageDir(pkg))
+}
 
-	// Output
+// qualify prefixes the identifiers in the Go type or expression that
+// are declared in another package with the package name,
+// ie. "*Adapter" becomes "*dxgi.Adapter" when printing d3d11
+func (p *printer) qualify(expr string) string {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(expr))
+	s.Init(file, []byte(expr), nil, 0)
+	var b strings.Builder
+	last := 0
+	isSelector := false
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.IDENT && !isSelector {
+			if pkg, ok := p.declPackages[lit]; ok && pkg != p.pkg {
+				offset := file.Offset(pos)
+				b.WriteString(expr[last:offset])
+				b.WriteString(pkg + ".")
+				last = offset
+			}
+		}
+		isSelector = tok == token.PERIOD
+	}
+	if b.Len() == 0 {
+		return expr
+	}
+	b.WriteString(expr[last:])
+	return b.String()
+}
+
+// printFile adds the package clause and imports to the declarations
+// and formats them
+func (p *printer) printFile(pkg string, comment string, body []byte) ([]byte, error) {
 	var b bytes.Buffer
-	b.WriteString("package d3d11\n\n")
-	b.WriteString(fmt.Sprintf(`
-import (
-	"syscall"
-	"strconv"
-	"reflect"
-	"unsafe"
-)
+	b.WriteString(comment + "\n\n")
+	b.WriteString("package " + pkg + "\n\n")
+	src := append(b.Bytes(), body...)
+
+	// Imports are the packages that are used but not declared
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+	if err != nil {
+		return src, err
+	}
+	used := make(map[string]bool)
+	for _, ident := range file.Unresolved {
+		used[ident.Name] = true
+	}
+	var imports []string
+	for _, name := range stdPackages {
+		if used[name] {
+			imports = append(imports, strconv.Quote(name))
+		}
+	}
+	if len(imports) > 0 {
+		imports = append(imports, "")
+	}
+	for _, name := range p.packages {
+		if name != pkg && used[name] {
+			imports = append(imports, strconv.Quote(p.importPath(name)))
+		}
+	}
+	if len(imports) > 0 {
+		b.WriteString("import (\n\t" + strings.Join(imports, "\n\t") + "\n)\n\n")
+	}
+	b.Write(body)
+	r, err := format.Source(b.Bytes())
+	if err != nil {
+		return b.Bytes(), err
+	}
+	return r, nil
+}
 
-// Error is returned by all Direct3D11 functions. It encapsulates the error code
+// printCommon prints the declarations that every package needs
+func (p *printer) printCommon(b *bytes.Buffer, calls *bytes.Buffer) {
+	b.WriteString(`// Error is returned by all Direct3D11 functions. It encapsulates the error code
 // returned by Direct3D. If a function succeeds it will return nil as the Error
 // and if it fails you can retrieve the error code using the Code() function.
 // You can check the result against the predefined error codes (like
@@ -41,18 +335,27 @@ type Error interface {
 
 type ErrorValue int32
 
+// Error returns the name of the error code and its message,
+// ie. "DXGI_ERROR_DEVICE_REMOVED: The video card has been physically removed..."
 func (err ErrorValue) Error() string {
-	switch err {
-	case E_INVALIDARG:
-		return "E_INVALIDARG"
+	name, ok := errorNames[err]
+	if !ok {
+		return "unknown error: " + strconv.Itoa(int(err))
+	}
+	if message, ok := errorMessages[err]; ok {
+		return name + ": " + message
 	}
-	return "unknown error: " + strconv.Itoa(int(err))
+	return name
 }
 
 func (err ErrorValue) Code() int32 {
 	return int32(err)
 }
 
+// errInvalidArg is E_INVALIDARG, it's returned if slices that are
+// passed with the same length have different lengths
+const errInvalidArg ErrorValue = -2147024809
+
 func toErr(result uintptr) Error {
 	res := ErrorValue(result) // cast to signed int
 	if res >= 0 {
@@ -61,226 +364,308 @@ func toErr(result uintptr) Error {
 	return res
 }
 
-var (
-	d3d11 = syscall.NewLazyDLL("d3d11.dll")
-)
+`)
+	p.printErrorNames(b)
+	printEnumCommon(b)
+	if p.config.ReleaseScope {
+		printReleaseCommon(b)
+	}
+	dll := p.config.PackageDLL(p.pkg)
+	calls.WriteString(fmt.Sprintf("var (\n\t%s = syscall.NewLazyDLL(%q)\n)\n", dllIdent(dll), dll))
+}
 
-`))
-	for _, file := range project.Files {
-		if len(file.Macros) > 0 {
-			hasMacro := false
-			for _, record := range file.Macros {
-				ident := record.Ident
-				if _, ok := constantAlreadyDefinedMap[ident]; ok {
-					continue
-				}
-				if strings.HasSuffix(ident, "_H_VERSION__") {
-					continue
-				}
-				value := record.Value.String()
-				if ident == value {
-					// ignore referencing self duplicates
-					continue
-				}
-				if !hasMacro {
-					b.WriteString("// Macros\n")
-					b.WriteString("const (\n")
-					hasMacro = true
-				}
-				b.WriteString("\t")
-				b.WriteString(ident)
-				b.WriteString(" = ")
-				b.WriteString(value)
-				b.WriteString("\n")
-				constantAlreadyDefinedMap[ident] = true
+// macroType returns the type of the macro constant with a leading
+// space, integers are untyped so they can be used with any integer type
+func macroType(record types.Macro) string {
+	if record.Const == nil {
+		return ""
+	}
+	switch record.Const.Kind {
+	case types.ConstFloat32:
+		return " float32"
+	case types.ConstFloat64:
+		return " float64"
+	case types.ConstString:
+		return " string"
+	}
+	return ""
+}
+
+// printDoc prints the documentation from the header as a comment
+func printDoc(b *bytes.Buffer, indent string, doc string) {
+	if doc == "" {
+		return
+	}
+	for _, line := range strings.Split(doc, "\n") {
+		if line == "" {
+			b.WriteString(indent + "//\n")
+			continue
+		}
+		b.WriteString(indent + "// " + line + "\n")
+	}
+}
+
+// printWideStrings prints L"..." macros as null-terminated UTF-16
+// strings, which Go can't declare as constants
+func (p *printer) printWideStrings(b *bytes.Buffer, records []types.Macro) {
+	if len(records) == 0 {
+		return
+	}
+	b.WriteString("// Wide strings\n")
+	b.WriteString("var (\n")
+	for _, record := range records {
+		printDoc(b, "\t", record.Doc)
+		b.WriteString("\t" + record.Ident + " = []uint16{")
+		for _, c := range utf16.Encode([]rune(record.Const.Str)) {
+			if c >= ' ' && c <= '~' {
+				b.WriteString(strconv.QuoteRune(rune(c)))
+			} else {
+				b.WriteString(fmt.Sprintf("0x%04X", c))
 			}
-			if hasMacro {
-				b.WriteString(")\n")
+			b.WriteString(", ")
+		}
+		b.WriteString("0}\n")
+	}
+	b.WriteString(")\n\n")
+}
+
+// printDecls prints the declarations of the file, functions and methods
+// that call into DirectX are printed to calls as they only build on Windows
+func (p *printer) printDecls(b *bytes.Buffer, calls *bytes.Buffer, file *types.File) {
+	if len(file.Macros) > 0 {
+		hasMacro := false
+		var wideStrings []types.Macro
+		for _, record := range file.Macros {
+			ident := record.Ident
+			if _, ok := p.constantAlreadyDefinedMap[ident]; ok {
+				continue
 			}
+			if _, ok := hresultValue(record); ok && record.HRESULT {
+				// Printed as ErrorValue constants by printErrors
+				continue
+			}
+			if strings.HasSuffix(ident, "_H_VERSION__") {
+				continue
+			}
+			value := record.Value.String()
+			if ident == value {
+				// ignore referencing self duplicates
+				continue
+			}
+			if record.Const != nil && record.Const.Kind == types.ConstWideString {
+				// Printed as variables by printWideStrings
+				wideStrings = append(wideStrings, record)
+				p.constantAlreadyDefinedMap[ident] = true
+				continue
+			}
+			if !hasMacro {
+				b.WriteString("// Macros\n")
+				b.WriteString("const (\n")
+				hasMacro = true
+			}
+			printDoc(b, "\t", record.Doc)
+			b.WriteString("\t")
+			b.WriteString(ident)
+			b.WriteString(macroType(record))
+			b.WriteString(" = ")
+			b.WriteString(p.qualify(value))
 			b.WriteString("\n")
+			p.constantAlreadyDefinedMap[ident] = true
 		}
-		for _, record := range file.Functions {
-			ident := record.Ident
-			callIdent := "call" + record.Ident
-			b.WriteString("var " + callIdent + " = d3d11.NewProc(\"" + record.DLLCall + "\")\n\n")
-			b.WriteString("func " + ident)
-			printParametersAndReturns(&b, record.Parameters)
-			b.WriteString(" {\n")
-			printParameterInitVars(&b, record.Parameters)
-			b.WriteString("\tret, _, _ := ")
-			b.WriteString(callIdent)
-			b.WriteString(".Call(\n")
-			for _, param := range record.Parameters {
-				printArgument(&b, param)
+		if hasMacro {
+			b.WriteString(")\n")
+		}
+		b.WriteString("\n")
+		p.printWideStrings(b, wideStrings)
+		p.printErrors(b, file)
+	}
+	if len(file.Guids) > 0 {
+		b.WriteString("var (\n")
+		for _, record := range file.Guids {
+			if p.constantAlreadyDefinedMap[record.Ident] {
+				continue
 			}
-			b.WriteString("\t)\n")
-			b.WriteString("\terr = toErr(ret)\n")
-			b.WriteString("\treturn\n")
-			b.WriteString("}\n\n")
-
+			b.WriteString("\t" + record.Ident + " = ")
+			p.printGUID(b, record.GUID)
+			b.WriteString("\n")
+			p.constantAlreadyDefinedMap[record.Ident] = true
+		}
+		b.WriteString(")\n\n")
+	}
+	dllIdent := dllIdent(p.config.PackageDLL(p.pkg))
+	for _, record := range file.Functions {
+		ident := record.Ident
+		callIdent := "call" + record.Ident
+		calls.WriteString("var " + callIdent + " = " + dllIdent + ".NewProc(\"" + record.DLLCall + "\")\n\n")
+		printDoc(calls, "", record.Doc)
+		calls.WriteString("func " + ident)
+		p.printParametersAndReturns(calls, record.Parameters)
+		calls.WriteString(" {\n")
+		printParameterInitVars(calls, record.Parameters)
+		calls.WriteString("\tret, _, _ := ")
+		calls.WriteString(callIdent)
+		calls.WriteString(".Call(\n")
+		for _, param := range record.Parameters {
+			printArgument(calls, param)
 		}
-		for _, record := range file.Structs {
-			structIdent := record.Ident
+		calls.WriteString("\t)\n")
+		calls.WriteString("\terr = toErr(ret)\n")
+		calls.WriteString("\treturn\n")
+		calls.WriteString("}\n\n")
+
+	}
+	for _, record := range file.Structs {
+		structIdent := record.Ident
+
+		printDoc(b, "", record.Doc)
+		b.WriteString("type " + structIdent + " struct {\n")
+		p.printStructFields(b, &record)
+		b.WriteString("}\n\n")
+		p.printUnionAccessors(b, &record)
 
-			b.WriteString("type " + structIdent + " struct {\n")
-			printStructFields(&b, record.Fields)
+		// Add GUID
+		// ie. "839d1216-bb2e-412b-b7f4-a9dbebe08ed1"
+		if len(record.GUID) > 0 {
+			// func (obj *Device) GUID() GUID {
+			b.WriteString("// GUID returns a string representing a Class identifier (ID) for COM objects\n")
+			b.WriteString("// ")
+			b.WriteString(record.GUID)
+			b.WriteString("\n")
+			b.WriteString("func (obj *" + structIdent + ") GUID() ")
+			b.WriteString(p.qualify(typetrans.GUIDTypeTranslation().GoType))
+			b.WriteString(" {\n")
+			b.WriteString("\treturn ")
+			p.printGUID(b, record.GUID)
+			b.WriteString("\n")
 			b.WriteString("}\n\n")
+		}
 
-			// Add GUID
-			// ie. "839d1216-bb2e-412b-b7f4-a9dbebe08ed1"
-			if len(record.GUID) > 0 {
-				// func (obj *Device) GUID() GUID {
-				b.WriteString("// GUID returns a string representing a Class identifier (ID) for COM objects\n")
-				b.WriteString("// ")
-				b.WriteString(record.GUID)
-				b.WriteString("\n")
-				b.WriteString("func (obj *" + structIdent + ") GUID() ")
-				b.WriteString(typetrans.GUIDTypeTranslation().GoType)
-				b.WriteString(" {\n")
-				b.WriteString("\treturn ")
-				b.WriteString(typetrans.GUIDTypeTranslation().GoType)
-				// Print "Data1" field
-				b.WriteString("{0x")
-				b.WriteString(record.GUID[:8])
-				// Print "Data2" field
-				b.WriteString(", 0x")
-				b.WriteString(record.GUID[9:13])
-				// Print "Data3" field
-				b.WriteString(", 0x")
-				b.WriteString(record.GUID[14:18])
-				// Print "Data4" field
-				b.WriteString(", [8]byte{")
-				b.WriteString("0x")
-				b.WriteString(record.GUID[19:21])
-				b.WriteString(", 0x")
-				b.WriteString(record.GUID[21:23])
-				b.WriteString(", 0x")
-				b.WriteString(record.GUID[24:26])
-				b.WriteString(", 0x")
-				b.WriteString(record.GUID[26:28])
-				b.WriteString(", 0x")
-				b.WriteString(record.GUID[28:30])
-				b.WriteString(", 0x")
-				b.WriteString(record.GUID[30:32])
-				b.WriteString(", 0x")
-				b.WriteString(record.GUID[32:34])
-				b.WriteString(", 0x")
-				b.WriteString(record.GUID[34:36])
-				b.WriteString("}}\n")
-				b.WriteString("}\n\n")
-			}
+		// Generate Vtbl
+		if record := record.VtblStruct; record != nil {
+			// Add vtbl struct and fields
+			printDoc(b, "", record.Doc)
+			b.WriteString("type " + record.Ident + " struct {\n")
+			p.printStructFields(b, record)
+			b.WriteString("}\n\n")
 
-			// Generate Vtbl
-			if record := record.VtblStruct; record != nil {
-				// Add vtbl struct and fields
-				b.WriteString("type " + record.Ident + " struct {\n")
-				printStructFields(&b, record.Fields)
-				b.WriteString("}\n\n")
-
-				for _, field := range record.Fields {
-					typeInfo, ok := field.TypeInfo.Type.(*types.FunctionPointer)
-					if !ok {
-						continue
-					}
-					methodName := field.Name
-					parameters := typeInfo.Parameters
-					if parameters[0].Name != "This" {
-						panic("Expected first parameter of function pointer to be This.")
-					}
-					parameterCount := len(parameters)
-					parameters = parameters[1:]
-					b.WriteString("func (obj *" + structIdent + ") " + methodName)
-					printParametersAndReturns(&b, parameters)
-					b.WriteString(" {\n")
-					printParameterInitVars(&b, parameters)
-					// Write method body
-					b.WriteString("\t")
-					unusedParameterCount := 0
-					switch parameterCount {
-					case 0, 1, 2, 3:
-						b.WriteString("ret, _, _ := syscall.Syscall(\n")
-						unusedParameterCount = 3
-					case 4, 5, 6:
-						b.WriteString("ret, _, _ := syscall.Syscall6(\n")
-						unusedParameterCount = 6
-					case 7, 8, 9:
-						b.WriteString("ret, _, _ := syscall.Syscall9(\n")
-						unusedParameterCount = 9
-					case 10, 11, 12:
-						b.WriteString("ret, _, _ := syscall.Syscall12(\n")
-						unusedParameterCount = 12
-					default:
-						panic("Unhandled case: Parameter count too big: " + strconv.Itoa(parameterCount))
-					}
-					b.WriteString("\t\tobj.lpVtbl." + methodName + ",\n")
-					b.WriteString("\t\t" + strconv.Itoa(parameterCount) + ",\n")
-					b.WriteString("\t\tuintptr(unsafe.Pointer(obj)),\n")
-					for _, param := range parameters {
-						printArgument(&b, param)
-					}
-					for i := len(parameters); i < unusedParameterCount-1; i++ {
-						// Handle unused parameters for Syscall, Syscall6, etc
-						b.WriteString("\t\t0,\n")
-					}
-					b.WriteString("\t)\n")
-					b.WriteString("\terr = toErr(ret)\n")
-					b.WriteString("\treturn\n")
-					b.WriteString("}\n\n")
+			for _, field := range record.Fields {
+				typeInfo, ok := field.TypeInfo.Type.(*types.FunctionPointer)
+				if !ok {
+					continue
 				}
-			}
-		}
-		if len(file.TypeAliases) > 0 {
-			b.WriteString("type (\n")
-			for _, typeAlias := range file.TypeAliases {
-				alias := typeAlias.Alias
-				if builtInTypeTrans, ok := typetrans.BuiltInTypeTranslation(alias); ok {
-					alias = builtInTypeTrans.GoType
+				methodName := field.Name
+				parameters := typeInfo.Parameters
+				if parameters[0].Name != "This" {
+					panic("Expected first parameter of function pointer to be This.")
 				}
-				ident := typeAlias.Ident
-				if ident == alias {
+				parameterCount := len(parameters)
+				parameters = parameters[1:]
+				if isRefCountMethod(methodName, parameters) {
+					printRefCountMethod(calls, structIdent, field)
 					continue
 				}
-				b.WriteString("\t" + ident + " " + alias + "\n")
+				printDoc(calls, "", field.Doc)
+				calls.WriteString("func (obj *" + structIdent + ") " + methodName)
+				p.printParametersAndReturns(calls, parameters)
+				calls.WriteString(" {\n")
+				printParameterInitVars(calls, parameters)
+				// Write method body
+				calls.WriteString("\t")
+				unusedParameterCount := 0
+				switch parameterCount {
+				case 0, 1, 2, 3:
+					calls.WriteString("ret, _, _ := syscall.Syscall(\n")
+					unusedParameterCount = 3
+				case 4, 5, 6:
+					calls.WriteString("ret, _, _ := syscall.Syscall6(\n")
+					unusedParameterCount = 6
+				case 7, 8, 9:
+					calls.WriteString("ret, _, _ := syscall.Syscall9(\n")
+					unusedParameterCount = 9
+				case 10, 11, 12:
+					calls.WriteString("ret, _, _ := syscall.Syscall12(\n")
+					unusedParameterCount = 12
+				default:
+					panic("Unhandled case: Parameter count too big: " + strconv.Itoa(parameterCount))
+				}
+				calls.WriteString("\t\tobj.lpVtbl." + methodName + ",\n")
+				calls.WriteString("\t\t" + strconv.Itoa(parameterCount) + ",\n")
+				calls.WriteString("\t\tuintptr(unsafe.Pointer(obj)),\n")
+				for _, param := range parameters {
+					printArgument(calls, param)
+				}
+				for i := len(parameters); i < unusedParameterCount-1; i++ {
+					// Handle unused parameters for Syscall, Syscall6, etc
+					calls.WriteString("\t\t0,\n")
+				}
+				calls.WriteString("\t)\n")
+				calls.WriteString("\terr = toErr(ret)\n")
+				calls.WriteString("\treturn\n")
+				calls.WriteString("}\n\n")
 			}
-			b.WriteString(")\n\n")
 		}
-		for _, record := range file.Enums {
-			ident := record.Ident
-			goType := enumTypeTranslation.GoType
-			b.WriteString("type " + ident + " " + goType + "\n")
-			b.WriteString("const (\n")
-			for _, field := range record.Fields {
-				fieldIdent := field.Ident
-				value := field.Value.String()
-				if fieldIdent == value {
-					// ignore referencing self duplicates
-					continue
-				}
-				b.WriteRune('\t')
-				b.WriteString(fieldIdent)
-				b.WriteRune(' ')
-				b.WriteString(ident)
-				b.WriteString(" = ")
-				b.WriteString(value)
-				b.WriteRune('\n')
+
+		// Generate conversions to inherited interfaces,
+		// ie. func (obj *Texture2D) AsResource() *Resource
+		for base := record.Base; base != ""; {
+			baseRecord, ok := p.interfaces[base]
+			if !ok {
+				break
 			}
-			b.WriteString(")\n\n")
+			baseType := p.qualify(base)
+			b.WriteString("// As" + base + " returns obj as the " + base + " interface it inherits from\n")
+			b.WriteString("func (obj *" + structIdent + ") As" + base + "() *" + baseType + " {\n")
+			b.WriteString("\treturn (*" + baseType + ")(unsafe.Pointer(obj))\n")
+			b.WriteString("}\n\n")
+			base = baseRecord.Base
 		}
+
+		// Generate typed QueryInterface methods,
+		// ie. func (obj *Device) QueryInterfaceDXGIDevice() (*IDXGIDevice, Error)
+		if record.VtblStruct != nil {
+			p.printQueryMethods(calls, &record)
+		}
+	}
+	if len(file.TypeAliases) > 0 {
+		b.WriteString("type (\n")
+		for _, typeAlias := range file.TypeAliases {
+			alias := typetrans.GoTypeFromAlias(typeAlias.Alias)
+			ident := typeAlias.Ident
+			if ident == alias {
+				continue
+			}
+			b.WriteString("\t" + ident + " " + p.qualify(alias) + "\n")
+		}
+		b.WriteString(")\n\n")
+	}
+	for i := 0; i < len(file.Enums); i++ {
+		p.printEnum(b, &file.Enums[i])
 	}
+}
 
-	r := b.Bytes()
-	return r
+// dllIdent returns the variable name used for the lazy-loaded DLL,
+// ie. "d3d11.dll" becomes "modd3d11"
+func dllIdent(dll string) string {
+	name := strings.ToLower(dll)
+	name = strings.TrimSuffix(name, ".dll")
+	name = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+	return "mod" + name
 }
 
 func printArgument(b *bytes.Buffer, param types.StructField) {
 	name := param.Name
 	if param.IsArray {
-		//b.WriteString("\t\tuintptr(len(" + name + ")),\n")
-		b.WriteString("\t\tuintptr(unsafe.Pointer(&" + name + "[0])),\n")
+		// Set by printParameterInitVars, nil for empty slices
+		b.WriteString("\t\tuintptr(" + name + "Pointer),\n")
 		return
 	}
 	if param.IsArrayLen {
-		b.WriteString("\t\tuintptr(len(" + name + ")),\n")
+		b.WriteString("\t\tuintptr(len(" + param.Arrays[0] + ")),\n")
 		return
 	}
 	if param.IsDeref {
@@ -291,7 +676,7 @@ func printArgument(b *bytes.Buffer, param types.StructField) {
 	}
 	switch param.TypeInfo.Type.(type) {
 	case *types.Pointer:
-		if param.IsOut {
+		if isReturn(param) {
 			b.WriteString("\t\tuintptr(unsafe.Pointer(&" + name + ")),\n")
 			break
 		}
@@ -317,7 +702,18 @@ func printArgument(b *bytes.Buffer, param types.StructField) {
 	}
 }
 
-func printParametersAndReturns(b *bytes.Buffer, parameters []types.StructField) {
+// isReturn returns true if the out parameter is returned rather than
+// passed in. Optional out parameters are passed in so that callers can
+// pass nil to skip them, ie. the ppBuffer of CreateBuffer.
+func isReturn(param types.StructField) bool {
+	return param.Annotation.IsOut() &&
+		!param.IsDeref &&
+		!param.IsArray &&
+		!param.IsArrayLen &&
+		!param.IsOptional
+}
+
+func (p *printer) printParametersAndReturns(b *bytes.Buffer, parameters []types.StructField) {
 	b.WriteString("(")
 	{
 		i := 0
@@ -331,9 +727,9 @@ func printParametersAndReturns(b *bytes.Buffer, parameters []types.StructField)
 			if goType == "" {
 				panic("Expecting TypeInfo.GoType string to have value for Name: " + param.Name)
 			}
-			isDeref := param.IsDeref
-			if param.IsOut &&
-				!isDeref {
+			if isReturn(param) {
+				// Slices and optional parameters are passed in
+				// even if they're written to
 				continue
 			}
 			if i != 0 {
@@ -346,7 +742,7 @@ func printParametersAndReturns(b *bytes.Buffer, parameters []types.StructField)
 			} else {
 				b.WriteString(param.Name)
 				b.WriteRune(' ')
-				b.WriteString(goType)
+				b.WriteString(p.qualify(goType))
 			}
 			i++
 		}
@@ -355,24 +751,7 @@ func printParametersAndReturns(b *bytes.Buffer, parameters []types.StructField)
 	{
 		i := 0
 		for _, param := range parameters {
-			if !param.IsOut {
-				continue
-			}
-			if param.IsDeref {
-				continue
-				/*if ind > 0 {
-					// Skip as we put deref's as input parameters
-					// - REFIID riid
-					// - __RPC__deref_out  void **ppvObject
-					prevParam := parameters[ind-1]
-					if prevParam.TypeInfo.Ident == "REFIID" {
-						continue
-					}
-				}*/
-			}
-			if param.IsArrayLen {
-				// Skip as Go users dont need to pass an array len
-				// they just pass a slice
+			if !isReturn(param) {
 				continue
 			}
 			if i != 0 {
@@ -386,7 +765,7 @@ func printParametersAndReturns(b *bytes.Buffer, parameters []types.StructField)
 			}
 			b.WriteString(param.Name)
 			b.WriteRune(' ')
-			b.WriteString(goType)
+			b.WriteString(p.qualify(goType))
 			i++
 		}
 		if i > 0 {
@@ -415,7 +794,7 @@ func printParametersAndReturns(b *bytes.Buffer, parameters []types.StructField)
 			b.WriteString(interfaceWithGuid)
 			break
 		}
-		if isOut == param.IsOut {
+		if isOut == param.Annotation.IsOut() {
 			if i != 0 {
 				b.WriteString(", ")
 			}
@@ -429,12 +808,61 @@ func printParametersAndReturns(b *bytes.Buffer, parameters []types.StructField)
 }*/
 
 func printParameterInitVars(b *bytes.Buffer, parameters []types.StructField) {
+	optional := make(map[string]bool, len(parameters))
+	for _, param := range parameters {
+		optional[param.Name] = param.IsOptional
+	}
+	// Slices that share a length parameter must have the same length,
+	// optional slices can also be empty and are passed as nil
+	for _, param := range parameters {
+		if !param.IsArrayLen {
+			continue
+		}
+		for _, array := range param.Arrays[1:] {
+			b.WriteString("\tif ")
+			if optional[array] {
+				b.WriteString("len(" + array + ") > 0 && ")
+			}
+			b.WriteString("len(" + array + ") != len(" + param.Arrays[0] + ") {\n")
+			b.WriteString("\t\terr = errInvalidArg\n")
+			b.WriteString("\t\treturn\n")
+			b.WriteString("\t}\n")
+		}
+	}
 	// Write init vars
 	for _, param := range parameters {
+		if param.IsArray {
+			// Empty slices are passed as nil rather than indexed
+			pointerName := param.Name + "Pointer"
+
+			b.WriteString("\tvar " + pointerName + " unsafe.Pointer\n")
+			b.WriteString("\tif len(" + param.Name + ") > 0 {\n")
+			b.WriteString("\t\t" + pointerName + " = unsafe.Pointer(&" + param.Name + "[0])\n")
+			b.WriteString("\t}\n")
+			b.WriteString("\n")
+		}
 		if param.IsDeref {
 			refName := param.Name + "Ref"
 			pointerName := param.Name + "Pointer"
 
+			if param.IsOptional {
+				// ie.
+				// var ppDataPointer uintptr
+				// if ppData != nil {
+				//	...
+				// }
+				b.WriteString("\tvar " + pointerName + " uintptr\n")
+				b.WriteString("\tif " + param.Name + " != nil {\n")
+				b.WriteString("\t\t" + refName + " := reflect.ValueOf(" + param.Name + ")\n")
+				b.WriteString("\t\tif " + refName + ".Kind() != reflect.Ptr {\n")
+				b.WriteString("\t\t\tpanic(\"Expected a pointer\")\n")
+				b.WriteString("\t\t}\n")
+				b.WriteString("\t\t" + pointerName + " = " + refName + ".Pointer()\n")
+				b.WriteString("\t}\n")
+				b.WriteString("\n")
+				continue
+			}
+
 			b.WriteString("\t")
 			b.WriteString(refName)
 			b.WriteString(" := ")
@@ -454,17 +882,153 @@ func printParameterInitVars(b *bytes.Buffer, parameters []types.StructField) {
 	}
 }
 
-func printStructFields(b *bytes.Buffer, fields []types.StructField) {
+// printStructFields prints the fields of the struct, padding fields
+// are added so that the fields are at the same offsets as in C
+func (p *printer) printStructFields(b *bytes.Buffer, record *types.Struct) {
+	fields := record.Fields
 	if len(fields) == 0 {
 		panic("Unexpected error. Found struct with no fields.")
 	}
-	for _, field := range fields {
+	paddings, trailing, hasPadding := p.structPadding(record)
+	for i, field := range fields {
+		if hasPadding {
+			printPadding(b, paddings[i])
+		}
+		printDoc(b, "\t", field.Doc)
+		if union, ok := field.TypeInfo.Type.(*types.Union); ok {
+			printUnionField(b, unionFieldName(fields, i), union)
+			continue
+		}
 		b.WriteRune('\t')
 		if field.Name != "" {
 			b.WriteString(field.Name)
 			b.WriteRune(' ')
 		}
-		b.WriteString(field.TypeInfo.GoType)
+		b.WriteString(p.qualify(field.TypeInfo.GoType))
 		b.WriteRune('\n')
 	}
+	if hasPadding {
+		printPadding(b, trailing)
+	}
+}
+
+// unionFieldName returns the name of the field of the union at index i
+// of the fields, anonymous unions are named by their order, ie. "union0"
+func unionFieldName(fields []types.StructField, i int) string {
+	if fields[i].Name != "" {
+		return fields[i].Name
+	}
+	n := 0
+	for _, field := range fields[:i] {
+		if _, ok := field.TypeInfo.Type.(*types.Union); ok && field.Name == "" {
+			n++
+		}
+	}
+	return "union" + strconv.Itoa(n)
+}
+
+// printUnionField prints the union as a byte array that is the size of
+// its largest field. It's preceded by a zero length array of an integer
+// with the alignment of the union so the struct is aligned as in C.
+func printUnionField(b *bytes.Buffer, name string, union *types.Union) {
+	if union.Layout == nil {
+		b.WriteString("\t// NOTE: " + name + " is missing, the size of the union is unknown\n")
+		return
+	}
+	goType, ok := unionType(union)
+	if !ok {
+		b.WriteString("\t// NOTE: " + name + " is missing, it's " + strconv.Itoa(union.Layout.X86.Size) + " bytes on x86 and " + strconv.Itoa(union.Layout.X64.Size) + " bytes on x64\n")
+		return
+	}
+	switch union.Layout.X64.Align {
+	case 2:
+		b.WriteString("\t_ [0]uint16\n")
+	case 4:
+		b.WriteString("\t_ [0]uint32\n")
+	case 8:
+		b.WriteString("\t_ [0]uint64\n")
+	}
+	b.WriteString("\t" + name + " " + goType + "\n")
+}
+
+// unionType returns the byte array type that the union is printed as,
+// ok is false if the union is missing from the struct, see printUnionField
+func unionType(union *types.Union) (string, bool) {
+	if union.Layout == nil {
+		return "", false
+	}
+	return byteArrayType(union.Layout.X86.Size, union.Layout.X64.Size)
+}
+
+// printUnionAccessors prints methods to get and set each field
+// of the unions in the struct, ie. Texture2D() and SetTexture2D()
+func (p *printer) printUnionAccessors(b *bytes.Buffer, record *types.Struct) {
+	for i, field := range record.Fields {
+		union, ok := field.TypeInfo.Type.(*types.Union)
+		if !ok {
+			continue
+		}
+		if _, ok := unionType(union); !ok {
+			continue
+		}
+		unionField := "obj." + unionFieldName(record.Fields, i)
+		for _, member := range union.Fields {
+			goType := p.qualify(member.TypeInfo.GoType)
+			pointer := "(*" + goType + ")(unsafe.Pointer(&" + unionField + "[0]))"
+			b.WriteString("// " + member.Name + " returns the " + member.Name + " field of the union\n")
+			b.WriteString("func (obj *" + record.Ident + ") " + member.Name + "() " + goType + " {\n")
+			b.WriteString("\treturn *" + pointer + "\n")
+			b.WriteString("}\n\n")
+			b.WriteString("// Set" + member.Name + " sets the " + member.Name + " field of the union\n")
+			b.WriteString("func (obj *" + record.Ident + ") Set" + member.Name + "(value " + goType + ") {\n")
+			b.WriteString("\t*" + pointer + " = value\n")
+			b.WriteString("}\n\n")
+		}
+	}
+}
+
+func printPadding(b *bytes.Buffer, pad padding) {
+	if pad.isZero() {
+		return
+	}
+	goType, ok := pad.goType()
+	if !ok {
+		b.WriteString("\t// NOTE: Padding is missing, it's " + strconv.Itoa(pad.x86) + " bytes on x86 and " + strconv.Itoa(pad.x64) + " bytes on x64\n")
+		return
+	}
+	b.WriteString("\t_ " + goType + "\n")
+}
+
+// printGUID prints a GUID literal,
+// ie. "839d1216-bb2e-412b-b7f4-a9dbebe08ed1"
+func (p *printer) printGUID(b *bytes.Buffer, guid string) {
+	b.WriteString(p.qualify(typetrans.GUIDTypeTranslation().GoType))
+	// Print "Data1" field
+	b.WriteString("{0x")
+	b.WriteString(guid[:8])
+	// Print "Data2" field
+	b.WriteString(", 0x")
+	b.WriteString(guid[9:13])
+	// Print "Data3" field
+	b.WriteString(", 0x")
+	b.WriteString(guid[14:18])
+	// Print "Data4" field
+	b.WriteString(", [8]byte{")
+	b.WriteString("0x")
+	b.WriteString(guid[19:21])
+	b.WriteString(", 0x")
+	b.WriteString(guid[21:23])
+	b.WriteString(", 0x")
+	b.WriteString(guid[24:26])
+	b.WriteString(", 0x")
+	b.WriteString(guid[26:28])
+	b.WriteString(", 0x")
+	b.WriteString(guid[28:30])
+	b.WriteString(", 0x")
+	b.WriteString(guid[30:32])
+	b.WriteString(", 0x")
+	b.WriteString(guid[32:34])
+	b.WriteString(", 0x")
+	b.WriteString(guid[34:36])
+	b.WriteString("}}")
 }
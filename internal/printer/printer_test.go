@@ -0,0 +1,351 @@
+package printer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/silbinarywolf/directx-bind-gen/internal/config"
+	"github.com/silbinarywolf/directx-bind-gen/internal/types"
+)
+
+// basicField returns a field of the Go type as the transformer sets it
+func basicField(name string, goType string) types.StructField {
+	typeInfo := types.NewBasicType(goType, types.BasicType{})
+	typeInfo.GoType = goType
+	return types.StructField{Name: name, TypeInfo: typeInfo}
+}
+
+// enumField returns an enum field with the value
+func enumField(ident string, value uint32) types.EnumField {
+	return types.EnumField{
+		Ident: ident,
+		Value: types.Value{UInt32Value: &value},
+	}
+}
+
+// comInterface returns a COM interface with a vtbl of the methods
+func comInterface(ident string, base string, methods ...string) types.Struct {
+	vtblIdent := ident + "Vtbl"
+	vtbl := &types.Struct{Ident: vtblIdent}
+	for _, method := range methods {
+		vtbl.Fields = append(vtbl.Fields, basicField(method, "uintptr"))
+	}
+	lpVtbl := basicField("lpVtbl", "*"+vtblIdent)
+	return types.Struct{
+		Ident:      ident,
+		Fields:     []types.StructField{lpVtbl},
+		VtblStruct: vtbl,
+		Base:       base,
+	}
+}
+
+// printProject prints the project and fails the test if it can't be printed
+func printProject(t *testing.T, project *types.Project, config *config.Config) []OutputFile {
+	t.Helper()
+	files, err := PrintProject(project, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// outputFile returns the source of the printed file with the filename
+func outputFile(t *testing.T, files []OutputFile, filename string) string {
+	t.Helper()
+	for _, file := range files {
+		if file.Filename == filename {
+			return string(file.Data)
+		}
+	}
+	t.Fatalf("%s was not printed", filename)
+	return ""
+}
+
+func TestPrintBaseConversions(t *testing.T) {
+	project := &types.Project{
+		Files: []types.File{
+			{
+				Filename: "D3D11.h",
+				Structs: []types.Struct{
+					comInterface("Unknown", "", "QueryInterface", "AddRef", "Release"),
+					comInterface("DeviceChild", "Unknown", "QueryInterface", "AddRef", "Release", "GetDevice"),
+					comInterface("Resource", "DeviceChild", "QueryInterface", "AddRef", "Release", "GetDevice", "GetType"),
+					comInterface("Texture2D", "Resource", "QueryInterface", "AddRef", "Release", "GetDevice", "GetType", "GetDesc"),
+				},
+			},
+		},
+	}
+	src := outputFile(t, printProject(t, project, &config.Config{Package: "d3d11"}), "d3d11.go")
+	tests := []struct {
+		decl     string
+		expected bool
+	}{
+		{"func (obj *Texture2D) AsResource() *Resource {\n\treturn (*Resource)(unsafe.Pointer(obj))\n}", true},
+		{"func (obj *Texture2D) AsDeviceChild() *DeviceChild {\n\treturn (*DeviceChild)(unsafe.Pointer(obj))\n}", true},
+		{"func (obj *Texture2D) AsUnknown() *Unknown {\n\treturn (*Unknown)(unsafe.Pointer(obj))\n}", true},
+		{"func (obj *DeviceChild) AsUnknown() *Unknown", true},
+		// Interfaces aren't converted to themselves or the interfaces
+		// that inherit from them
+		{"func (obj *Unknown) As", false},
+		{"func (obj *Resource) AsTexture2D", false},
+	}
+	for _, test := range tests {
+		if found := strings.Contains(src, test.decl); found != test.expected {
+			t.Errorf("%q: expected found to be %v, got %v", test.decl, test.expected, found)
+		}
+	}
+}
+
+func TestQualify(t *testing.T) {
+	p := &printer{
+		config: &config.Config{},
+		pkg:    "d3d11",
+		declPackages: map[string]string{
+			"Adapter":        "dxgi",
+			"FORMAT":         "dxgi",
+			"Texture2D":      "d3d11",
+			"FORMAT_R8_UINT": "dxgi",
+		},
+	}
+	tests := []struct {
+		expr string
+		out  string
+	}{
+		{"*Adapter", "*dxgi.Adapter"},
+		{"**Adapter", "**dxgi.Adapter"},
+		{"[4]FORMAT", "[4]dxgi.FORMAT"},
+		{"*Texture2D", "*Texture2D"},
+		{"uint32", "uint32"},
+		{"FORMAT_R8_UINT + 1", "dxgi.FORMAT_R8_UINT + 1"},
+		// Selectors are already qualified
+		{"unsafe.Pointer", "unsafe.Pointer"},
+		{"dxgi.Adapter", "dxgi.Adapter"},
+	}
+	for _, test := range tests {
+		if out := p.qualify(test.expr); out != test.out {
+			t.Errorf("%q: expected %q, got %q", test.expr, test.out, out)
+		}
+	}
+}
+
+func TestPrintPackages(t *testing.T) {
+	cfg := &config.Config{
+		Package:    "d3d11",
+		ImportPath: "generated",
+		Packages: []config.Package{
+			{Package: "dxgi", Headers: []string{"DXGI.h", "DXGIFormat.h"}},
+		},
+	}
+	project := &types.Project{
+		Files: []types.File{
+			{
+				Filename: "D3D11.h",
+				Structs: []types.Struct{
+					{Ident: "TEXTURE2D_DESC", Fields: []types.StructField{basicField("Width", "uint32"), basicField("Format", "FORMAT")}},
+				},
+			},
+			{
+				Filename: "DXGIFormat.h",
+				Enums: []types.Enum{
+					{Ident: "FORMAT", Fields: []types.EnumField{enumField("FORMAT_UNKNOWN", 0)}},
+				},
+			},
+		},
+	}
+	files := printProject(t, project, cfg)
+	tests := []struct {
+		filename   string
+		importPath string
+	}{
+		{"common.go", "generated"},
+		{"common_windows.go", "generated"},
+		{"dxgi/common.go", "generated/dxgi"},
+		{"dxgi/common_windows.go", "generated/dxgi"},
+		{"d3d11.go", "generated"},
+		{"dxgi/dxgiformat.go", "generated/dxgi"},
+	}
+	if len(files) != len(tests) {
+		t.Fatalf("expected %d files, got %d", len(tests), len(files))
+	}
+	for i, test := range tests {
+		if file := files[i]; file.Filename != test.filename || file.ImportPath != test.importPath {
+			t.Errorf("expected %s in %s, got %s in %s", test.filename, test.importPath, file.Filename, file.ImportPath)
+		}
+	}
+	src := outputFile(t, files, "d3d11.go")
+	for _, expected := range []string{
+		"\"generated/dxgi\"",
+		// Declarations of other packages are qualified
+		"\tFormat dxgi.FORMAT\n",
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected d3d11.go to contain %q:\n%s", expected, src)
+		}
+	}
+}
+
+func TestUnionFieldName(t *testing.T) {
+	union := types.NewUnion(types.Union{})
+	fields := []types.StructField{
+		basicField("Format", "uint32"),
+		{TypeInfo: union},
+		{Name: "Named", TypeInfo: union},
+		{TypeInfo: union},
+	}
+	tests := []struct {
+		i    int
+		name string
+	}{
+		{0, "Format"},
+		{1, "union0"},
+		{2, "Named"},
+		{3, "union1"},
+	}
+	for _, test := range tests {
+		if name := unionFieldName(fields, test.i); name != test.name {
+			t.Errorf("field %d: expected %s, got %s", test.i, test.name, name)
+		}
+	}
+}
+
+func TestPrintUnionField(t *testing.T) {
+	layout := func(x86Size, x86Align, x64Size, x64Align int) *types.Layout {
+		return &types.Layout{
+			X86: types.StructLayout{Size: x86Size, Align: x86Align},
+			X64: types.StructLayout{Size: x64Size, Align: x64Align},
+		}
+	}
+	tests := []struct {
+		layout   *types.Layout
+		expected string
+	}{
+		{layout(8, 4, 8, 4), "\t_ [0]uint32\n\tunion0 [8]byte\n"},
+		{layout(8, 4, 16, 8), "\t_ [0]uint64\n\tunion0 [2*unsafe.Sizeof(uintptr(0))]byte\n"},
+		// Unions that can't be printed are left out of the struct
+		{layout(4, 4, 6, 2), "\t// NOTE: union0 is missing, it's 4 bytes on x86 and 6 bytes on x64\n"},
+		{nil, "\t// NOTE: union0 is missing, the size of the union is unknown\n"},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		printUnionField(&b, "union0", &types.Union{Layout: test.layout})
+		if b.String() != test.expected {
+			t.Errorf("%+v: expected %q, got %q", test.layout, test.expected, b.String())
+		}
+	}
+}
+
+func TestPrintUnionAccessors(t *testing.T) {
+	union := types.NewUnion(types.Union{
+		Fields: []types.StructField{
+			basicField("Buffer", "BUFFER_SRV"),
+			basicField("pResource", "uintptr"),
+		},
+		Layout: &types.Layout{
+			X86: types.StructLayout{Size: 8, Align: 4},
+			X64: types.StructLayout{Size: 8, Align: 8},
+		},
+	})
+	record := &types.Struct{
+		Ident:  "SHADER_RESOURCE_VIEW_DESC",
+		Fields: []types.StructField{basicField("Format", "uint32"), {TypeInfo: union}},
+	}
+	p := &printer{config: &config.Config{}}
+	var b bytes.Buffer
+	p.printUnionAccessors(&b, record)
+	for _, expected := range []string{
+		"func (obj *SHADER_RESOURCE_VIEW_DESC) Buffer() BUFFER_SRV {\n\treturn *(*BUFFER_SRV)(unsafe.Pointer(&obj.union0[0]))\n}",
+		"func (obj *SHADER_RESOURCE_VIEW_DESC) SetBuffer(value BUFFER_SRV) {\n\t*(*BUFFER_SRV)(unsafe.Pointer(&obj.union0[0])) = value\n}",
+		"func (obj *SHADER_RESOURCE_VIEW_DESC) pResource() uintptr {",
+		"func (obj *SHADER_RESOURCE_VIEW_DESC) SetpResource(value uintptr) {",
+	} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("expected accessors to contain %q:\n%s", expected, b.String())
+		}
+	}
+}
+
+func TestPrintParameterInitVars(t *testing.T) {
+	arrayParam := func(name string, goType string, optional bool) types.StructField {
+		param := basicField(name, goType)
+		param.IsArray = true
+		param.IsOptional = optional
+		return param
+	}
+	lenParam := func(name string, arrays ...string) types.StructField {
+		param := basicField(name, "uint32")
+		param.IsArrayLen = true
+		param.Arrays = arrays
+		return param
+	}
+	tests := []struct {
+		name       string
+		parameters []types.StructField
+		expected   []string
+	}{
+		{
+			name: "IASetVertexBuffers",
+			parameters: []types.StructField{
+				lenParam("NumBuffers", "ppVertexBuffers", "pStrides"),
+				arrayParam("ppVertexBuffers", "[]*Buffer", false),
+				arrayParam("pStrides", "[]uint32", false),
+			},
+			expected: []string{
+				"\tif len(pStrides) != len(ppVertexBuffers) {\n\t\terr = errInvalidArg\n\t\treturn\n\t}\n",
+				"\tvar pStridesPointer unsafe.Pointer\n\tif len(pStrides) > 0 {\n\t\tpStridesPointer = unsafe.Pointer(&pStrides[0])\n\t}\n",
+			},
+		},
+		{
+			// Optional slices can be empty rather than the same length
+			name: "OMSetRenderTargetsAndUnorderedAccessViews",
+			parameters: []types.StructField{
+				lenParam("NumUAVs", "ppUnorderedAccessViews", "pUAVInitialCounts"),
+				arrayParam("ppUnorderedAccessViews", "[]*UnorderedAccessView", true),
+				arrayParam("pUAVInitialCounts", "[]uint32", true),
+			},
+			expected: []string{
+				"\tif len(pUAVInitialCounts) > 0 && len(pUAVInitialCounts) != len(ppUnorderedAccessViews) {\n",
+				"\tvar pUAVInitialCountsPointer unsafe.Pointer\n\tif len(pUAVInitialCounts) > 0 {\n",
+			},
+		},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		printParameterInitVars(&b, test.parameters)
+		for _, expected := range test.expected {
+			if !strings.Contains(b.String(), expected) {
+				t.Errorf("%s: expected %q in:\n%s", test.name, expected, b.String())
+			}
+		}
+	}
+}
+
+func TestIsGenerated(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected bool
+	}{
+		{"// Code generated by directx-bind-gen. DO NOT EDIT.\n\npackage d3d11\n", true},
+		{"package d3d11\n", false},
+		{"// Code generated by stringer. DO NOT EDIT.\n\npackage d3d11\n", false},
+	}
+	for _, test := range tests {
+		if generated := IsGenerated([]byte(test.src)); generated != test.expected {
+			t.Errorf("%q: expected %v, got %v", test.src, test.expected, generated)
+		}
+	}
+}
+
+func TestPrintFileFormats(t *testing.T) {
+	p := &printer{config: &config.Config{}}
+	data, err := p.printFile("d3d11", "", []byte("const (\nSDK_VERSION=7\n)\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "const (\n\tSDK_VERSION = 7\n)\n"; !strings.HasSuffix(string(data), expected) {
+		t.Errorf("expected the file to be formatted, got:\n%s", data)
+	}
+	if _, err := p.printFile("d3d11", "", []byte("const (\n")); err == nil {
+		t.Errorf("expected an error for a file that can't be formatted")
+	}
+}
@@ -0,0 +1,155 @@
+package printer
+
+import (
+	"bytes"
+	"sort"
+	"unicode"
+
+	"github.com/silbinarywolf/directx-bind-gen/internal/types"
+)
+
+// printReleaseCommon prints the Scope type that releases COM objects
+// together if ReleaseScope is set in the config. Finalizers can't be
+// used to release them as COM objects aren't allocated by Go.
+func printReleaseCommon(b *bytes.Buffer) {
+	b.WriteString(`// Releaser is implemented by every COM interface, ie. *Device
+type Releaser interface {
+	Release() uint32
+}
+
+// Scope releases the COM objects added to it together, ie.
+//
+//	var scope Scope
+//	defer scope.Release()
+//	if err := device.CreateBuffer(&desc, nil, &buffer); err != nil {
+//		return err
+//	}
+//	scope.Add(buffer)
+type Scope struct {
+	objects []Releaser
+}
+
+// Add adds the COM object to be released by Release, nil objects
+// are skipped when they're released
+func (scope *Scope) Add(obj Releaser) {
+	scope.objects = append(scope.objects, obj)
+}
+
+// Release releases the COM objects in the reverse order that they
+// were added
+func (scope *Scope) Release() {
+	for i := len(scope.objects) - 1; i >= 0; i-- {
+		scope.objects[i].Release()
+	}
+	scope.objects = nil
+}
+
+`)
+}
+
+// isRefCountMethod returns true if the method is AddRef or Release of
+// IUnknown, they return the reference count rather than an HRESULT
+func isRefCountMethod(name string, parameters []types.StructField) bool {
+	return (name == "AddRef" || name == "Release") && len(parameters) == 0
+}
+
+// printRefCountMethod prints the AddRef or Release method of the
+// interface, ie. func (obj *Device) Release() uint32
+func printRefCountMethod(calls *bytes.Buffer, structIdent string, field types.StructField) {
+	methodName := field.Name
+	doc := field.Doc
+	if doc == "" {
+		switch methodName {
+		case "AddRef":
+			doc = "AddRef increments the reference count of obj and returns the new count"
+		case "Release":
+			doc = "Release decrements the reference count of obj and returns the new count,\n" +
+				"obj is freed when it reaches 0. It does nothing if obj is nil."
+		}
+	}
+	printDoc(calls, "", doc)
+	calls.WriteString("func (obj *" + structIdent + ") " + methodName + "() uint32 {\n")
+	if methodName == "Release" {
+		calls.WriteString("\tif obj == nil {\n")
+		calls.WriteString("\t\treturn 0\n")
+		calls.WriteString("\t}\n")
+	}
+	calls.WriteString("\tret, _, _ := syscall.Syscall(\n")
+	calls.WriteString("\t\tobj.lpVtbl." + methodName + ",\n")
+	calls.WriteString("\t\t1,\n")
+	calls.WriteString("\t\tuintptr(unsafe.Pointer(obj)),\n")
+	calls.WriteString("\t\t0,\n")
+	calls.WriteString("\t\t0,\n")
+	calls.WriteString("\t)\n")
+	calls.WriteString("\treturn uint32(ret)\n")
+	calls.WriteString("}\n\n")
+}
+
+// queryTargets returns the interfaces that the interface can be queried
+// for, these are the interfaces that directly inherit from it and its
+// Queries. Interfaces without a GUID can't be queried for.
+func (p *printer) queryTargets(record *types.Struct) []string {
+	var derived []string
+	for ident, other := range p.interfaces {
+		if other.Base == record.Ident {
+			derived = append(derived, ident)
+		}
+	}
+	sort.Strings(derived)
+	var targets []string
+	added := make(map[string]bool)
+	for _, ident := range append(derived, record.Queries...) {
+		target, ok := p.interfaces[ident]
+		if !ok || target.GUID == "" || added[ident] || ident == record.Ident {
+			continue
+		}
+		added[ident] = true
+		targets = append(targets, ident)
+	}
+	return targets
+}
+
+// queryMethodName returns the name of the typed QueryInterface method
+// for the interface, ie. "QueryInterfaceDXGIDevice" for "IDXGIDevice".
+// The "QueryInterface" prefix stops names like "QueryQuery" for "Query".
+func queryMethodName(ident string) string {
+	if len(ident) > 1 && ident[0] == 'I' && unicode.IsUpper(rune(ident[1])) {
+		ident = ident[1:]
+	}
+	return "QueryInterface" + ident
+}
+
+// printQueryMethods prints a QueryInterface method for each interface
+// that the interface can be queried for, ie.
+// func (obj *Device) QueryInterfaceDXGIDevice() (*IDXGIDevice, Error)
+func (p *printer) printQueryMethods(calls *bytes.Buffer, record *types.Struct) {
+	methods := make(map[string]bool, len(record.VtblStruct.Fields))
+	for _, field := range record.VtblStruct.Fields {
+		methods[field.Name] = true
+	}
+	if !methods["QueryInterface"] {
+		return
+	}
+	for _, target := range p.queryTargets(record) {
+		methodName := queryMethodName(target)
+		if methods[methodName] {
+			// Don't replace methods of the interface
+			continue
+		}
+		targetType := p.qualify(target)
+		calls.WriteString("// " + methodName + " returns the " + target + " interface of obj if it implements it,\n")
+		calls.WriteString("// the result must be released with Release\n")
+		calls.WriteString("func (obj *" + record.Ident + ") " + methodName + "() (result *" + targetType + ", err Error) {\n")
+		calls.WriteString("\tguid := result.GUID()\n")
+		calls.WriteString("\tret, _, _ := syscall.Syscall(\n")
+		calls.WriteString("\t\tobj.lpVtbl.QueryInterface,\n")
+		calls.WriteString("\t\t3,\n")
+		calls.WriteString("\t\tuintptr(unsafe.Pointer(obj)),\n")
+		calls.WriteString("\t\tuintptr(unsafe.Pointer(&guid)),\n")
+		calls.WriteString("\t\tuintptr(unsafe.Pointer(&result)),\n")
+		calls.WriteString("\t)\n")
+		calls.WriteString("\terr = toErr(ret)\n")
+		calls.WriteString("\treturn\n")
+		calls.WriteString("}\n\n")
+	}
+}
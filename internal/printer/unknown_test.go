@@ -0,0 +1,59 @@
+package printer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/silbinarywolf/directx-bind-gen/internal/config"
+	"github.com/silbinarywolf/directx-bind-gen/internal/types"
+)
+
+func TestQueryTargets(t *testing.T) {
+	vtbl := &types.Struct{}
+	p := &printer{
+		config: &config.Config{},
+		interfaces: map[string]*types.Struct{
+			"DeviceChild": {Ident: "DeviceChild", GUID: "1841e5c8-16b0-489b-bcc8-44cfb0d5deae", VtblStruct: vtbl},
+			"Resource":    {Ident: "Resource", GUID: "dc8e63f3-d12b-4952-b47b-5e45026a862d", Base: "DeviceChild", VtblStruct: vtbl},
+			"Texture2D":   {Ident: "Texture2D", GUID: "6f15aaf2-d208-4e89-9ab4-489535d34f9c", Base: "Resource", VtblStruct: vtbl},
+			"Query":       {Ident: "Query", GUID: "d6c00747-87b7-425e-b84d-44d108560afd", Base: "DeviceChild", VtblStruct: vtbl},
+			"Device":      {Ident: "Device", GUID: "db6f6ddb-ac77-4e88-8253-819df9bbf140", Queries: []string{"IDXGIDevice", "IDXGIMissing"}, VtblStruct: vtbl},
+			"IDXGIDevice": {Ident: "IDXGIDevice", GUID: "54ec77fa-1377-44e6-8c32-88fd5f44c84c", VtblStruct: vtbl},
+			// Interfaces without a GUID can't be queried for
+			"NoGUID": {Ident: "NoGUID", Base: "DeviceChild", VtblStruct: vtbl},
+		},
+	}
+	tests := []struct {
+		ident   string
+		targets []string
+	}{
+		// Only interfaces that directly inherit from it
+		{"DeviceChild", []string{"Query", "Resource"}},
+		{"Resource", []string{"Texture2D"}},
+		{"Texture2D", nil},
+		{"Device", []string{"IDXGIDevice"}},
+	}
+	for _, test := range tests {
+		targets := p.queryTargets(p.interfaces[test.ident])
+		if !reflect.DeepEqual(targets, test.targets) {
+			t.Errorf("%s: expected %v, got %v", test.ident, test.targets, targets)
+		}
+	}
+}
+
+func TestQueryMethodName(t *testing.T) {
+	tests := []struct {
+		ident      string
+		methodName string
+	}{
+		{"IDXGIDevice", "QueryInterfaceDXGIDevice"},
+		{"Texture2D", "QueryInterfaceTexture2D"},
+		{"Query", "QueryInterfaceQuery"},
+		{"InputLayout", "QueryInterfaceInputLayout"},
+	}
+	for _, test := range tests {
+		if methodName := queryMethodName(test.ident); methodName != test.methodName {
+			t.Errorf("%s: expected %s, got %s", test.ident, test.methodName, methodName)
+		}
+	}
+}
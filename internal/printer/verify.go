@@ -0,0 +1,296 @@
+package printer
+
+import (
+	"bytes"
+	"errors"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	gotypes "go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/silbinarywolf/directx-bind-gen/internal/types"
+)
+
+// verifyArchs are the architectures that bindings are type-checked for
+var verifyArchs = []string{"amd64", "386"}
+
+// VerifyError is a type error in the generated bindings
+type VerifyError struct {
+	Pos token.Position
+	// GOARCH are the architectures that the error occurs on
+	GOARCH []string
+	// Decl is the Go declaration that has the error, ie. "Texture2D.GetDesc"
+	Decl string
+	// CDecl is the C declaration that Decl is generated from,
+	// ie. "ID3D11Texture2D::GetDesc"
+	CDecl string
+	// HeaderPos is the position of CDecl in the header, the line is 0
+	// for declarations from the config
+	HeaderPos token.Position
+	Msg       string
+}
+
+func (err VerifyError) Error() string {
+	r := err.Pos.String() + ": " + err.Msg + " (windows/" + strings.Join(err.GOARCH, ", windows/") + ")"
+	if err.Decl != "" {
+		r += "\n\tin " + err.Decl
+		if err.CDecl != "" {
+			r += " from " + err.CDecl + " (" + err.HeaderPos.String() + ")"
+		}
+	}
+	return r
+}
+
+// Verify type-checks the files printed by PrintProject for Windows.
+//
+// Errors are mapped back to the declarations and headers in the project
+// that they were generated from. The returned error is only non-nil if
+// the files can't be parsed or the standard library can't be built
+// for Windows.
+func Verify(project *types.Project, outDir string, files []OutputFile) ([]VerifyError, error) {
+	fset := token.NewFileSet()
+	packages := make(map[string][]*ast.File)
+	var importPaths []string
+	for _, outputFile := range files {
+		filename := filepath.Join(outDir, filepath.FromSlash(outputFile.Filename))
+		file, err := parser.ParseFile(fset, filename, outputFile.Data, 0)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := packages[outputFile.ImportPath]; !ok {
+			importPaths = append(importPaths, outputFile.ImportPath)
+		}
+		packages[outputFile.ImportPath] = append(packages[outputFile.ImportPath], file)
+	}
+	sources := declSources(project)
+
+	var errs []VerifyError
+	errIndex := make(map[string]int)
+	for _, arch := range verifyArchs {
+		typeErrs, err := typeCheck(fset, packages, importPaths, arch)
+		if err != nil {
+			return nil, err
+		}
+		for _, typeErr := range typeErrs {
+			key := typeErr.Fset.Position(typeErr.Pos).String() + typeErr.Msg
+			if i, ok := errIndex[key]; ok {
+				errs[i].GOARCH = append(errs[i].GOARCH, arch)
+				continue
+			}
+			decl := enclosingDecl(packages, fset, typeErr.Pos)
+			source, ok := sources[decl]
+			cDecl := source.CIdent
+			if i := strings.Index(decl, "."); !ok && i != -1 {
+				// Methods are generated from the same header as their type
+				source, ok = sources[decl[:i]]
+				cDecl = source.CIdent + "::" + decl[i+1:]
+			}
+			verifyErr := VerifyError{
+				Pos:    typeErr.Fset.Position(typeErr.Pos),
+				GOARCH: []string{arch},
+				Decl:   decl,
+				Msg:    typeErr.Msg,
+			}
+			if ok {
+				verifyErr.CDecl = cDecl
+				verifyErr.HeaderPos = token.Position{
+					Filename: source.Header,
+					Line:     source.Line,
+				}
+			}
+			errIndex[key] = len(errs)
+			errs = append(errs, verifyErr)
+		}
+	}
+	return errs, nil
+}
+
+// verifyImporter imports the standard library from its export data
+// and type-checks the generated packages as they're imported
+type verifyImporter struct {
+	fset     *token.FileSet
+	arch     string
+	packages map[string][]*ast.File
+	// checked are the generated packages that have been type-checked,
+	// the package is nil while it's being checked
+	checked map[string]*gotypes.Package
+	std     gotypes.Importer
+	errs    []gotypes.Error
+	// lookupErr is the first error from looking up export data
+	lookupErr error
+}
+
+func (imp *verifyImporter) Import(path string) (*gotypes.Package, error) {
+	if _, ok := imp.packages[path]; !ok {
+		return imp.std.Import(path)
+	}
+	if pkg, ok := imp.checked[path]; ok {
+		if pkg == nil {
+			return nil, errors.New("import cycle through " + path)
+		}
+		return pkg, nil
+	}
+	imp.checked[path] = nil
+	config := gotypes.Config{
+		Importer: imp,
+		Sizes:    gotypes.SizesFor("gc", imp.arch),
+		Error: func(err error) {
+			if typeErr, ok := err.(gotypes.Error); ok && !typeErr.Soft {
+				imp.errs = append(imp.errs, typeErr)
+			}
+		},
+	}
+	files := imp.packages[path]
+	pkg, _ := config.Check(path, imp.fset, files, nil)
+	imp.checked[path] = pkg
+	return pkg, nil
+}
+
+// typeCheck returns the type errors of the packages when built for Windows
+func typeCheck(fset *token.FileSet, packages map[string][]*ast.File, importPaths []string, arch string) ([]gotypes.Error, error) {
+	imp := &verifyImporter{
+		fset:     fset,
+		arch:     arch,
+		packages: packages,
+		checked:  make(map[string]*gotypes.Package),
+	}
+	imp.std = importer.ForCompiler(fset, "gc", func(path string) (io.ReadCloser, error) {
+		r, err := lookupExportData(path, arch)
+		if err != nil && imp.lookupErr == nil {
+			imp.lookupErr = err
+		}
+		return r, err
+	})
+	for _, path := range importPaths {
+		imp.Import(path)
+	}
+	if imp.lookupErr != nil {
+		return nil, imp.lookupErr
+	}
+	return imp.errs, nil
+}
+
+// lookupExportData opens the compiled export data of the package for Windows.
+//
+// The standard library is imported with the go command rather
+// than from source as the source importer can't apply the build tags
+// of another architecture to the runtime's internal packages.
+func lookupExportData(path string, arch string) (io.ReadCloser, error) {
+	cmd := exec.Command("go", "list", "-export", "-f", "{{.Export}}", path)
+	cmd.Env = append(os.Environ(), "GOOS=windows", "GOARCH="+arch, "CGO_ENABLED=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.New("cannot find export data for " + path + ": " + strings.TrimSpace(stderr.String()))
+	}
+	exportFile := strings.TrimSpace(string(out))
+	if exportFile == "" {
+		return nil, errors.New("cannot find export data for " + path)
+	}
+	return os.Open(exportFile)
+}
+
+// enclosingDecl returns the name of the top-level declaration
+// at the position, ie. "Texture2D" or "Texture2D.GetDesc"
+func enclosingDecl(packages map[string][]*ast.File, fset *token.FileSet, pos token.Pos) string {
+	var file *ast.File
+	for _, files := range packages {
+		for _, other := range files {
+			if fset.File(other.Pos()) == fset.File(pos) {
+				file = other
+			}
+		}
+	}
+	if file == nil {
+		return ""
+	}
+	for _, decl := range file.Decls {
+		if pos < decl.Pos() || pos >= decl.End() {
+			continue
+		}
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil || len(decl.Recv.List) == 0 {
+				return decl.Name.Name
+			}
+			recvType := decl.Recv.List[0].Type
+			if star, ok := recvType.(*ast.StarExpr); ok {
+				recvType = star.X
+			}
+			if ident, ok := recvType.(*ast.Ident); ok {
+				return ident.Name + "." + decl.Name.Name
+			}
+			return decl.Name.Name
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				if pos < spec.Pos() || pos >= spec.End() {
+					continue
+				}
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					return spec.Name.Name
+				case *ast.ValueSpec:
+					return spec.Names[0].Name
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// declSource is the header and C declaration that a Go
+// declaration is generated from
+type declSource struct {
+	Header string
+	types.Source
+}
+
+// declSources returns the C declaration that each Go declaration printed
+// by PrintProject is generated from, methods aren't included as they
+// are from the same declaration as their type
+func declSources(project *types.Project) map[string]declSource {
+	r := make(map[string]declSource)
+	for _, file := range project.Files {
+		add := func(ident string, source types.Source) {
+			if _, ok := r[ident]; !ok {
+				r[ident] = declSource{file.Filename, source}
+			}
+		}
+		for _, record := range file.Macros {
+			add(record.Ident, record.Source)
+		}
+		for _, record := range file.Guids {
+			add(record.Ident, record.Source)
+		}
+		for _, record := range file.Functions {
+			add(record.Ident, record.Source)
+			add("call"+record.Ident, record.Source)
+		}
+		for _, record := range file.Structs {
+			add(record.Ident, record.Source)
+			if vtbl := record.VtblStruct; vtbl != nil {
+				add(vtbl.Ident, vtbl.Source)
+			}
+		}
+		for _, record := range file.TypeAliases {
+			add(record.Ident, record.Source)
+		}
+		for _, record := range file.Enums {
+			add(record.Ident, record.Source)
+			add("names"+record.Ident, record.Source)
+			add("Parse"+record.Ident, record.Source)
+			add(record.Ident+"Values", record.Source)
+			for _, field := range record.Fields {
+				add(field.Ident, field.Source)
+			}
+		}
+	}
+	return r
+}
@@ -0,0 +1,152 @@
+package printer
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/silbinarywolf/directx-bind-gen/internal/config"
+	"github.com/silbinarywolf/directx-bind-gen/internal/types"
+)
+
+func TestEnclosingDecl(t *testing.T) {
+	const src = `package d3d11
+
+const SDK_VERSION = 7
+
+type (
+	Texture2D struct {
+		lpVtbl *Texture2DVtbl
+	}
+	Rect struct{ Left, Top int32 }
+)
+
+func (obj *Texture2D) GetDesc(desc *TEXTURE2D_DESC) {
+	desc.Width = 0
+}
+
+func CreateDevice() {}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "d3d11.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packages := map[string][]*ast.File{"d3d11": {file}}
+	tests := []struct {
+		at   string
+		decl string
+	}{
+		{"7", "SDK_VERSION"},
+		{"*Texture2DVtbl", "Texture2D"},
+		{"Left", "Rect"},
+		{"desc.Width", "Texture2D.GetDesc"},
+		{"*TEXTURE2D_DESC", "Texture2D.GetDesc"},
+		{"{}", "CreateDevice"},
+		{"package", ""},
+	}
+	for _, test := range tests {
+		pos := fset.File(file.Pos()).Pos(strings.Index(src, test.at))
+		if decl := enclosingDecl(packages, fset, pos); decl != test.decl {
+			t.Errorf("%q: expected %q, got %q", test.at, test.decl, decl)
+		}
+	}
+}
+
+func TestDeclSources(t *testing.T) {
+	source := func(ident string, line int) types.Source {
+		return types.Source{CIdent: ident, Line: line}
+	}
+	texture := comInterface("Texture2D", "")
+	texture.Source = source("ID3D11Texture2D", 20)
+	texture.VtblStruct.Source = source("ID3D11Texture2DVtbl", 30)
+	project := &types.Project{
+		Files: []types.File{
+			{
+				Filename:  "D3D11.h",
+				Macros:    []types.Macro{{Ident: "SDK_VERSION", Source: source("D3D11_SDK_VERSION", 2)}},
+				Functions: []types.Function{{Ident: "CreateDevice", Source: source("D3D11CreateDevice", 40)}},
+				Structs:   []types.Struct{texture},
+				Enums: []types.Enum{
+					{
+						Ident:  "CULL_MODE",
+						Source: source("D3D11_CULL_MODE", 10),
+						Fields: []types.EnumField{{Ident: "CULL_NONE", Source: source("D3D11_CULL_NONE", 12)}},
+					},
+				},
+			},
+			{
+				Filename: "DXGI.h",
+				// Declarations are from the first header that declares them
+				Macros:      []types.Macro{{Ident: "SDK_VERSION", Source: source("DXGI_SDK_VERSION", 5)}},
+				TypeAliases: []types.TypeAlias{{Ident: "Rect", Source: source("RECT", 8)}},
+			},
+		},
+	}
+	d3d11 := func(ident string, line int) declSource {
+		return declSource{"D3D11.h", source(ident, line)}
+	}
+	expected := map[string]declSource{
+		"SDK_VERSION":      d3d11("D3D11_SDK_VERSION", 2),
+		"CreateDevice":     d3d11("D3D11CreateDevice", 40),
+		"callCreateDevice": d3d11("D3D11CreateDevice", 40),
+		"Texture2D":        d3d11("ID3D11Texture2D", 20),
+		"Texture2DVtbl":    d3d11("ID3D11Texture2DVtbl", 30),
+		"CULL_MODE":        d3d11("D3D11_CULL_MODE", 10),
+		"namesCULL_MODE":   d3d11("D3D11_CULL_MODE", 10),
+		"ParseCULL_MODE":   d3d11("D3D11_CULL_MODE", 10),
+		"CULL_MODEValues":  d3d11("D3D11_CULL_MODE", 10),
+		"CULL_NONE":        d3d11("D3D11_CULL_NONE", 12),
+		"Rect":             {"DXGI.h", source("RECT", 8)},
+	}
+	if sources := declSources(project); !reflect.DeepEqual(sources, expected) {
+		t.Errorf("expected %v, got %v", expected, sources)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping type-check of generated files in short mode")
+	}
+	project := &types.Project{
+		Files: []types.File{
+			{
+				Filename: "D3D11.h",
+				Structs: []types.Struct{
+					{
+						Ident:  "BOX",
+						Source: types.Source{CIdent: "D3D11_BOX", Line: 12},
+						Fields: []types.StructField{
+							basicField("left", "uint32"),
+							basicField("right", "UNKNOWN_TYPE"),
+						},
+					},
+				},
+			},
+		},
+	}
+	files := printProject(t, project, &config.Config{Package: "d3d11"})
+	errs, err := Verify(project, "dist", files)
+	if err != nil {
+		t.Skip("cannot type-check for windows: " + err.Error())
+	}
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %v", errs)
+	}
+	verifyErr := errs[0]
+	if verifyErr.Decl != "BOX" || verifyErr.CDecl != "D3D11_BOX" {
+		t.Errorf("expected error in BOX from D3D11_BOX, got %s from %s", verifyErr.Decl, verifyErr.CDecl)
+	}
+	if expected := "D3D11.h:12"; verifyErr.HeaderPos.String() != expected {
+		t.Errorf("expected the header position %s, got %s", expected, verifyErr.HeaderPos)
+	}
+	if verifyErr.Pos.Filename != "dist/d3d11.go" || !strings.Contains(verifyErr.Msg, "UNKNOWN_TYPE") {
+		t.Errorf("expected undefined UNKNOWN_TYPE in dist/d3d11.go, got %v", verifyErr)
+	}
+	if expected := []string{"amd64", "386"}; !reflect.DeepEqual(verifyErr.GOARCH, expected) {
+		t.Errorf("expected the error on %v, got %v", expected, verifyErr.GOARCH)
+	}
+}
@@ -2,46 +2,76 @@ package transformer
 
 import (
 	"fmt"
+	"go/token"
+	"sort"
 	"strings"
 
+	"github.com/silbinarywolf/directx-bind-gen/internal/config"
 	"github.com/silbinarywolf/directx-bind-gen/internal/types"
 	"github.com/silbinarywolf/directx-bind-gen/internal/typetrans"
 )
 
+type transformer struct {
+	config *config.Config
+}
+
 // Transform applies additional custom rules and transformations
 // to make printing out to modern languages easier
-func Transform(file *types.File) {
+func Transform(file *types.File, config *config.Config) {
+	t := &transformer{
+		config: config,
+	}
+	t.removeIgnored(file)
+
 	usedConstants := make(map[string]bool)
 
 	for i := 0; i < len(file.Functions); i++ {
 		record := &file.Functions[i]
-		record.Ident = transformIdent(record.Ident)
-		record.Parameters = transformParameters(record.Parameters, true)
+		record.Parameters = t.transformParameters(record.Ident, record.Parameters, true)
+		record.Ident = t.transformIdent(record.Ident)
 	}
 	for i := 0; i < len(file.Structs); i++ {
 		record := &file.Structs[i]
-		record.Ident = transformIdent(record.Ident)
-		record.Fields = transformParameters(record.Fields, false)
+		record.Fields = t.transformParameters(record.Ident, record.Fields, false)
+		if record.VtblStruct != nil {
+			for _, query := range t.config.Interface(record.Ident).Queries {
+				record.Queries = append(record.Queries, t.transformIdent(query))
+			}
+		}
+		record.Ident = t.transformIdent(record.Ident)
+		record.Base = t.transformIdent(record.Base)
 		if record := record.VtblStruct; record != nil {
-			record.Ident = transformIdent(record.Ident)
-			record.Fields = transformParameters(record.Fields, false)
+			record.Fields = t.transformParameters(record.Ident, record.Fields, false)
+			record.Ident = t.transformIdent(record.Ident)
 		}
 	}
+	for i := 0; i < len(file.Macros); i++ {
+		record := &file.Macros[i]
+		record.Ident = t.transformIdent(record.Ident)
+		// ie. "#define D3D11_DEFAULT_DEPTH_BIAS_CLAMP (0.0f)" references
+		// other macros in RawValue if it couldn't be evaluated
+		record.RawValue = t.transformIdent(record.RawValue)
+	}
+	for i := 0; i < len(file.Guids); i++ {
+		record := &file.Guids[i]
+		record.Ident = t.transformIdent(record.Ident)
+	}
 	for i := 0; i < len(file.TypeAliases); i++ {
 		record := &file.TypeAliases[i]
-		record.Ident = transformIdent(record.Ident)
-		record.Alias = transformIdent(record.Alias)
+		record.Ident = t.transformIdent(record.Ident)
+		record.Alias = t.transformIdent(record.Alias)
 	}
 	for i := 0; i < len(file.Enums); i++ {
 		record := &file.Enums[i]
-		record.Ident = transformIdent(record.Ident)
+		record.Flags = t.isFlags(record)
+		record.Ident = t.transformIdent(record.Ident)
 		for i := 0; i < len(record.Fields); i++ {
 			field := &record.Fields[i]
-			field.Ident = transformIdent(field.Ident)
+			field.Ident = t.transformIdent(field.Ident)
 			// NOTE(Jae): 2020-02-02
 			// Do this so we can transform the constants
 			// D3D11_COLOR_WRITE_ENABLE_RED
-			field.RawValue = transformIdent(field.RawValue)
+			field.RawValue = t.transformIdent(field.RawValue)
 			if _, ok := usedConstants[field.Ident]; ok {
 				// Remove duplicates
 				record.Fields = append(record.Fields[:i], record.Fields[i+1:]...)
@@ -53,70 +83,156 @@ func Transform(file *types.File) {
 	}
 }
 
-func transformParameters(parameters []types.StructField, isFunction bool) []types.StructField {
-	// Annotate with custom metadata
-	if isFunction {
-		//firstPrevHasECount := false
-		for i := 0; i < len(parameters); i++ {
-			param := &parameters[i]
-			if i+1 < len(parameters) &&
-				(strings.HasPrefix(param.Name, "Num") &&
-					param.Name != "NumElements") ||
-				param.Name == "FeatureLevels" {
-				// Hack to handle this case:
-				// - OMSetRenderTargets(NumViews)
-				// - RSSetViewports(NumViewports)
-				nextParam := &parameters[i+1]
-				if types.IsECountArray(nextParam) {
-					param.Name = nextParam.Name
-					nextParam.IsArray = true
-					param.IsArrayLen = true
-					continue
-				}
+// isFlags returns true if the values of the enum are bit flags. Enums
+// are flags if their name ends with "_FLAG", or if every value is zero,
+// a power of two or an OR of other values, ie. "A | B", and
+// there are at least 3 powers of two so that 0, 1, 2 isn't flags.
+func (t *transformer) isFlags(record *types.Enum) bool {
+	if override := t.config.Enum(record.Ident); override.Flags != nil {
+		return *override.Flags
+	}
+	if strings.HasSuffix(record.Ident, "_FLAG") || strings.HasSuffix(record.Ident, "_FLAGS") {
+		return true
+	}
+	bits := make(map[uint32]bool)
+	for _, field := range record.Fields {
+		value, ok := enumFieldValue(field)
+		if !ok {
+			continue
+		}
+		if value&(value-1) != 0 {
+			if strings.Contains(field.RawValue, "|") {
+				// ie. D3D11_COLOR_WRITE_ENABLE_ALL = RED | GREEN | BLUE | ALPHA
+				continue
 			}
-			if i > 0 {
-				// Convert previous param to array length parameter
-				prevParam := &parameters[i-1]
-				if prevParam.HasECount {
-					// Add metadata for this case so we can just pass in a slice for Golang
-					if prevParam.TypeInfo.Ident == "D3D_FEATURE_LEVEL" {
-						/* lastParam.Name == "NumViews"*/
-						param.Name = prevParam.Name
-						prevParam.IsArray = true
-						param.IsArrayLen = true
-						//firstPrevHasECount = false
-						continue
-					}
-				}
+			return false
+		}
+		if value != 0 {
+			bits[value] = true
+		}
+	}
+	return len(bits) >= 3
+}
+
+// enumFieldValue returns the value of the field if it's known
+func enumFieldValue(field types.EnumField) (uint32, bool) {
+	if field.UInt32Value != nil {
+		return *field.UInt32Value, true
+	}
+	return 0, false
+}
+
+// removeIgnored removes declarations that are ignored in the config
+func (t *transformer) removeIgnored(file *types.File) {
+	if len(t.config.Ignore) == 0 {
+		return
+	}
+	functions := file.Functions[:0]
+	for _, record := range file.Functions {
+		if !t.config.IsIgnored(record.Ident) {
+			functions = append(functions, record)
+		}
+	}
+	file.Functions = functions
+	structs := file.Structs[:0]
+	for _, record := range file.Structs {
+		if !t.config.IsIgnored(record.Ident) {
+			structs = append(structs, record)
+		}
+	}
+	file.Structs = structs
+	typeAliases := file.TypeAliases[:0]
+	for _, record := range file.TypeAliases {
+		if !t.config.IsIgnored(record.Ident) {
+			typeAliases = append(typeAliases, record)
+		}
+	}
+	file.TypeAliases = typeAliases
+	enums := file.Enums[:0]
+	for _, record := range file.Enums {
+		if t.config.IsIgnored(record.Ident) {
+			continue
+		}
+		fields := record.Fields[:0]
+		for _, field := range record.Fields {
+			if !t.config.IsIgnored(field.Ident) {
+				fields = append(fields, field)
 			}
 		}
+		record.Fields = fields
+		enums = append(enums, record)
+	}
+	file.Enums = enums
+	macros := file.Macros[:0]
+	for _, record := range file.Macros {
+		if !t.config.IsIgnored(record.Ident) {
+			macros = append(macros, record)
+		}
+	}
+	file.Macros = macros
+	guids := file.Guids[:0]
+	for _, record := range file.Guids {
+		if !t.config.IsIgnored(record.Ident) {
+			guids = append(guids, record)
+		}
+	}
+	file.Guids = guids
+}
+
+// transformParameters transforms the fields of a struct or the
+// parameters of the function or method named funcIdent
+func (t *transformer) transformParameters(funcIdent string, parameters []types.StructField, isFunction bool) []types.StructField {
+	// Get overrides before parameters are renamed
+	overrides := make([]config.Parameter, len(parameters))
+	for i, param := range parameters {
+		overrides[i] = t.config.Parameter(funcIdent, param)
+	}
+
+	// Annotate with custom metadata
+	if isFunction {
+		annotateArrays(parameters, overrides)
 	}
 
 	// Transform idents / etc
 	for i := 0; i < len(parameters); i++ {
 		param := &parameters[i]
-		param.Name = transformIdent(param.Name)
-		param.TypeInfo.GoType = transformIdent(typetrans.GoTypeFromTypeInfo(param.TypeInfo))
+		name := param.Name
+		param.Name = escapeKeyword(t.transformIdent(param.Name))
+		param.Annotation.CountParam = escapeKeyword(t.transformIdent(param.Annotation.CountParam))
+		for j, array := range param.Arrays {
+			param.Arrays[j] = escapeKeyword(t.transformIdent(array))
+		}
+		param.TypeInfo.GoType = t.transformIdent(typetrans.GoTypeFromTypeInfo(param.TypeInfo))
+		// ie. "__deref_out void **ppvObject"
+		param.IsDeref = param.Annotation.Deref > 0 && !param.IsArray
+		param.IsOptional = param.Annotation.Optional
 		switch typeInfo := param.TypeInfo.Type.(type) {
 		case *types.Pointer:
-			if param.HasECount {
-				if param.IsArray {
-					param.TypeInfo.GoType = "[]" + transformIdent(typetrans.GoTypeFromTypeInfo(typeInfo.TypeInfo))
+			switch {
+			case param.IsArray:
+				// ie. "ID3D11Buffer *const *ppVertexBuffers" is a []*Buffer,
+				// byte counts and void pointers are a []byte
+				goType := param.TypeInfo.GoType
+				if param.Annotation.CountKind == types.CountBytes ||
+					!strings.HasPrefix(goType, "*") {
+					param.TypeInfo.GoType = "[]byte"
 				} else {
-					switch typeInfo.Depth {
-					case 1:
-						param.TypeInfo.GoType = "*" + transformIdent(typetrans.GoTypeFromTypeInfo(typeInfo.TypeInfo))
-					case 2:
-						param.TypeInfo.GoType = "**" + transformIdent(typetrans.GoTypeFromTypeInfo(typeInfo.TypeInfo))
-						// no-op
-						// param.TypeInfo.GoType = transformIdent(typetrans.GoTypeFromTypeInfo(typeInfo.TypeInfo.Ident))
-					case 3:
-						// NOTE(Jae): 2020-02-20
-						// Hack that works for the time-being. Need to figure out why this makes things still work
-						param.TypeInfo.GoType = "**" + transformIdent(typetrans.GoTypeFromTypeInfo(typeInfo.TypeInfo))
-					default:
-						panic(fmt.Sprintf("Unhandled pointer depth: %d for %s", typeInfo.Depth, param.Name))
-					}
+					param.TypeInfo.GoType = "[]" + goType[1:]
+				}
+			case param.Annotation.CountKind == types.CountElements:
+				switch typeInfo.Depth {
+				case 1:
+					param.TypeInfo.GoType = "*" + t.transformIdent(typetrans.GoTypeFromTypeInfo(typeInfo.TypeInfo))
+				case 2:
+					param.TypeInfo.GoType = "**" + t.transformIdent(typetrans.GoTypeFromTypeInfo(typeInfo.TypeInfo))
+					// no-op
+					// param.TypeInfo.GoType = transformIdent(typetrans.GoTypeFromTypeInfo(typeInfo.TypeInfo.Ident))
+				case 3:
+					// NOTE(Jae): 2020-02-20
+					// Hack that works for the time-being. Need to figure out why this makes things still work
+					param.TypeInfo.GoType = "**" + t.transformIdent(typetrans.GoTypeFromTypeInfo(typeInfo.TypeInfo))
+				default:
+					panic(fmt.Sprintf("Unhandled pointer depth: %d for %s", typeInfo.Depth, param.Name))
 				}
 			}
 		}
@@ -127,12 +243,10 @@ func transformParameters(parameters []types.StructField, isFunction bool) []type
 			//	param.IsDeref = true
 			//}
 			switch typeInfo.Depth {
-			case 1:
-				switch param.TypeInfo.Ident {
-				case "ID3D11Resource": // Resource would ideally convert to a custom interface for Golang, but this is lazier/quicker
-					param.IsDeref = true
-				}
 			case 2:
+				if param.IsArray {
+					break
+				}
 				switch param.TypeInfo.Ident {
 				case "void",
 					"IUnknown":
@@ -140,26 +254,177 @@ func transformParameters(parameters []types.StructField, isFunction bool) []type
 				}
 			}
 		case *types.FunctionPointer:
-			typeInfo.Ident = transformIdent(param.Name)
-			typeInfo.Parameters = transformParameters(typeInfo.Parameters, true)
+			typeInfo.Ident = t.transformIdent(param.Name)
+			typeInfo.Parameters = t.transformParameters(name, typeInfo.Parameters, true)
+		case *types.Union:
+			typeInfo.Fields = t.transformParameters(funcIdent, typeInfo.Fields, false)
+		}
+		if override := overrides[i]; override.Deref != nil {
+			// ie. ID3D11Resource would ideally convert to a custom interface for Golang,
+			// but this is lazier/quicker
+			param.IsDeref = *override.Deref
+		}
+		if override := overrides[i]; override.Optional != nil {
+			param.IsOptional = *override.Optional
 		}
 	}
+	if isFunction {
+		sortArrays(parameters)
+	}
 	return parameters
 }
 
-func transformIdent(ident string) string {
-	/*pointerDepth := 0
-	for len(ident) > 0 && ident[0] == '*' {
-		ident = ident[1:]
-		pointerDepth++
-	}*/
-	ident = strings.ReplaceAll(ident, "ID3D11", "")
-	ident = strings.ReplaceAll(ident, "D3D11_", "")
-	ident = strings.ReplaceAll(ident, "D3D11", "")
-	ident = strings.ReplaceAll(ident, "D3D_", "")
-	/*for pointerDepth > 0 {
-		ident = "*" + ident
-		pointerDepth--
-	}*/
-	return ident
+// sortArrays moves the optional slices that share a length parameter
+// after the required ones, the length is taken from the first slice as
+// optional slices can be empty, ie. the pUAVInitialCounts of
+// OMSetRenderTargetsAndUnorderedAccessViews
+func sortArrays(parameters []types.StructField) {
+	optional := make(map[string]bool, len(parameters))
+	for _, param := range parameters {
+		optional[param.Name] = param.IsOptional
+	}
+	for _, param := range parameters {
+		if !param.IsArrayLen {
+			continue
+		}
+		arrays := param.Arrays
+		sort.SliceStable(arrays, func(i, j int) bool {
+			return !optional[arrays[i]] && optional[arrays[j]]
+		})
+	}
+}
+
+// annotateArrays marks the parameters with a SAL count of another
+// parameter, ie. "__in_ecount(NumViews)", as slices and the count
+// parameter as their length. Slices that share a length, ie. the
+// ppVertexBuffers, pStrides and pOffsets of IASetVertexBuffers, must
+// have the same length.
+//
+// Parameters with an "Array: true" override without a SAL count use
+// the parameter with an "ArrayLen: true" override as their length.
+func annotateArrays(parameters []types.StructField, overrides []config.Parameter) {
+	index := make(map[string]int, len(parameters))
+	for i, param := range parameters {
+		index[param.Name] = i
+	}
+	for i := 0; i < len(parameters); i++ {
+		param := &parameters[i]
+		if !isArray(param, overrides[i]) {
+			continue
+		}
+		j, ok := index[param.Annotation.CountParam]
+		if param.Annotation.CountParam == "" && overrides[i].Array != nil {
+			j, ok = arrayLenOverride(overrides)
+		}
+		if !ok || j == i || !isArrayLen(&parameters[j], overrides[j]) {
+			continue
+		}
+		lenParam := &parameters[j]
+		param.IsArray = true
+		lenParam.IsArrayLen = true
+		lenParam.Arrays = append(lenParam.Arrays, param.Name)
+	}
+}
+
+// arrayLenOverride returns the index of the first parameter with an
+// "ArrayLen: true" override
+func arrayLenOverride(overrides []config.Parameter) (int, bool) {
+	for i, override := range overrides {
+		if override.ArrayLen != nil && *override.ArrayLen {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// isArray returns true if the parameter is a buffer with the size of
+// another parameter, ie. "__in_ecount(NumViews)" or "__in_bcount(DataSize)".
+// Buffers with sizes like "*pNumViewports" or "NumViews * 2" aren't slices
+// unless the Array override is true.
+func isArray(param *types.StructField, override config.Parameter) bool {
+	if _, ok := param.TypeInfo.Type.(*types.Pointer); !ok {
+		return false
+	}
+	if override.Array != nil {
+		return *override.Array
+	}
+	switch param.Annotation.CountKind {
+	case types.CountElements, types.CountBytes:
+		return param.Annotation.Count == param.Annotation.CountParam
+	}
+	return false
+}
+
+// isArrayLen returns true if the parameter can be the length of a
+// slice, it must be an integer that is passed in, ie. "__in UINT NumViews"
+func isArrayLen(param *types.StructField, override config.Parameter) bool {
+	if override.ArrayLen != nil {
+		return *override.ArrayLen
+	}
+	if _, ok := param.TypeInfo.Type.(*types.BasicType); !ok {
+		return false
+	}
+	switch param.Annotation.Direction {
+	case "", types.DirectionIn:
+		return true
+	}
+	return false
+}
+
+// transformIdent strips the Naming.Strip substrings from each identifier
+// in s, which can be a type or expression, ie. "*ID3D11Buffer" or
+// "D3D11_COLOR_WRITE_ENABLE_RED | D3D11_COLOR_WRITE_ENABLE_GREEN". If an
+// identifier would start with a digit, ie. "D3D11_16BIT_INDEX_STRIP_CUT_VALUE",
+// it isn't renamed.
+func (t *transformer) transformIdent(s string) string {
+	if len(t.config.Naming.Strip) == 0 {
+		return s
+	}
+	var b strings.Builder
+	start := -1
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) && isIdentChar(s[i]) {
+			if start == -1 {
+				start = i
+			}
+			continue
+		}
+		if start != -1 {
+			b.WriteString(t.stripIdent(s[start:i]))
+			start = -1
+		}
+		if i < len(s) {
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// stripIdent strips the Naming.Strip substrings from the identifier
+func (t *transformer) stripIdent(ident string) string {
+	r := ident
+	for _, strip := range t.config.Naming.Strip {
+		r = strings.ReplaceAll(r, strip, "")
+	}
+	if r == "" || (isDigit(r[0]) && !isDigit(ident[0])) {
+		return ident
+	}
+	return r
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// escapeKeyword appends an underscore to names that are Go keywords,
+// ie. the "type" field of D2D1_RENDER_TARGET_PROPERTIES
+func escapeKeyword(name string) string {
+	if token.Lookup(name).IsKeyword() {
+		return name + "_"
+	}
+	return name
 }
@@ -0,0 +1,428 @@
+package transformer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/silbinarywolf/directx-bind-gen/internal/config"
+	"github.com/silbinarywolf/directx-bind-gen/internal/types"
+)
+
+func pointerParam(name string, ident string, depth int, annotation types.Annotation) types.StructField {
+	return types.StructField{
+		Name:       name,
+		Annotation: annotation,
+		TypeInfo: types.NewPointer(ident, types.Pointer{
+			TypeInfo: types.NewBasicType(ident, types.BasicType{}),
+			Depth:    depth,
+		}),
+	}
+}
+
+func uintParam(name string) types.StructField {
+	return types.StructField{
+		Name:       name,
+		Annotation: types.Annotation{Direction: types.DirectionIn},
+		TypeInfo:   types.NewBasicType("UINT", types.BasicType{}),
+	}
+}
+
+func ecount(countKind types.CountKind, count string) types.Annotation {
+	return types.Annotation{
+		Direction:  types.DirectionIn,
+		CountKind:  countKind,
+		Count:      count,
+		CountParam: count,
+	}
+}
+
+func ecountOpt(countKind types.CountKind, count string) types.Annotation {
+	annotation := ecount(countKind, count)
+	annotation.Optional = true
+	return annotation
+}
+
+func TestTransformArrays(t *testing.T) {
+	file := &types.File{
+		Functions: []types.Function{
+			{
+				Ident: "IASetVertexBuffers",
+				Parameters: []types.StructField{
+					uintParam("StartSlot"),
+					uintParam("NumBuffers"),
+					pointerParam("ppVertexBuffers", "ID3D11Buffer", 2, ecount(types.CountElements, "NumBuffers")),
+					pointerParam("pStrides", "UINT", 1, ecount(types.CountElements, "NumBuffers")),
+					pointerParam("pOffsets", "UINT", 1, ecount(types.CountElements, "NumBuffers")),
+				},
+			},
+			{
+				Ident: "SetPrivateData",
+				Parameters: []types.StructField{
+					uintParam("DataSize"),
+					pointerParam("pData", "void", 1, ecount(types.CountBytes, "DataSize")),
+				},
+			},
+			{
+				Ident: "GetPrivateData",
+				Parameters: []types.StructField{
+					pointerParam("pDataSize", "UINT", 1, types.Annotation{Direction: types.DirectionInOut}),
+					pointerParam("pData", "void", 1, types.Annotation{
+						Direction:  types.DirectionOut,
+						CountKind:  types.CountBytes,
+						Count:      "*pDataSize",
+						CountParam: "pDataSize",
+					}),
+				},
+			},
+			{
+				Ident: "OMSetRenderTargetsAndUnorderedAccessViews",
+				Parameters: []types.StructField{
+					uintParam("NumUAVs"),
+					pointerParam("pUAVInitialCounts", "UINT", 1, ecountOpt(types.CountElements, "NumUAVs")),
+					pointerParam("ppUnorderedAccessViews", "ID3D11UnorderedAccessView", 2, ecount(types.CountElements, "NumUAVs")),
+				},
+			},
+		},
+	}
+	Transform(file, &config.Config{
+		Naming: config.Naming{
+			Strip: []string{"ID3D11"},
+		},
+	})
+	tests := []struct {
+		param      types.StructField
+		goType     string
+		isArray    bool
+		isArrayLen bool
+		arrays     []string
+	}{
+		{file.Functions[0].Parameters[0], "uint32", false, false, nil},
+		{file.Functions[0].Parameters[1], "uint32", false, true, []string{"ppVertexBuffers", "pStrides", "pOffsets"}},
+		{file.Functions[0].Parameters[2], "[]*Buffer", true, false, nil},
+		{file.Functions[0].Parameters[3], "[]uint32", true, false, nil},
+		{file.Functions[0].Parameters[4], "[]uint32", true, false, nil},
+		{file.Functions[1].Parameters[0], "uint32", false, true, []string{"pData"}},
+		{file.Functions[1].Parameters[1], "[]byte", true, false, nil},
+		// Counts that are read through a pointer aren't slices
+		{file.Functions[2].Parameters[0], "*uint32", false, false, nil},
+		{file.Functions[2].Parameters[1], "uintptr", false, false, nil},
+		// Optional slices can be empty so the length is from the required one
+		{file.Functions[3].Parameters[0], "uint32", false, true, []string{"ppUnorderedAccessViews", "pUAVInitialCounts"}},
+	}
+	for _, test := range tests {
+		param := test.param
+		if param.TypeInfo.GoType != test.goType ||
+			param.IsArray != test.isArray ||
+			param.IsArrayLen != test.isArrayLen ||
+			!reflect.DeepEqual(param.Arrays, test.arrays) {
+			t.Errorf("%s: expected %s (IsArray: %v, IsArrayLen: %v, Arrays: %v), got %s (IsArray: %v, IsArrayLen: %v, Arrays: %v)",
+				param.Name, test.goType, test.isArray, test.isArrayLen, test.arrays,
+				param.TypeInfo.GoType, param.IsArray, param.IsArrayLen, param.Arrays)
+		}
+	}
+}
+
+func TestTransformOptional(t *testing.T) {
+	file := &types.File{
+		Functions: []types.Function{
+			{
+				Ident: "CreateBuffer",
+				Parameters: []types.StructField{
+					pointerParam("pDesc", "D3D11_BUFFER_DESC", 1, types.Annotation{Direction: types.DirectionIn}),
+					pointerParam("pInitialData", "D3D11_SUBRESOURCE_DATA", 1, types.Annotation{Direction: types.DirectionIn, Optional: true}),
+					pointerParam("ppBuffer", "ID3D11Buffer", 2, types.Annotation{Direction: types.DirectionOut, Optional: true}),
+				},
+			},
+			{
+				Ident: "CreateDevice",
+				Parameters: []types.StructField{
+					pointerParam("ppDevice", "ID3D11Device", 2, types.Annotation{Direction: types.DirectionOut, Optional: true}),
+				},
+			},
+		},
+	}
+	no := false
+	Transform(file, &config.Config{
+		Parameters: []config.Parameter{
+			{Function: "CreateDevice", Name: "ppDevice", Optional: &no},
+		},
+	})
+	tests := []struct {
+		param      types.StructField
+		isOptional bool
+	}{
+		{file.Functions[0].Parameters[0], false},
+		{file.Functions[0].Parameters[1], true},
+		{file.Functions[0].Parameters[2], true},
+		// Overrides can make optional parameters required
+		{file.Functions[1].Parameters[0], false},
+	}
+	for _, test := range tests {
+		if test.param.IsOptional != test.isOptional {
+			t.Errorf("%s: expected IsOptional: %v, got %v", test.param.Name, test.isOptional, test.param.IsOptional)
+		}
+	}
+}
+
+func TestTransformQueries(t *testing.T) {
+	file := &types.File{
+		Structs: []types.Struct{
+			{
+				Ident:      "ID3D11Device",
+				VtblStruct: &types.Struct{Ident: "ID3D11DeviceVtbl"},
+			},
+		},
+	}
+	Transform(file, &config.Config{
+		Interfaces: []config.Interface{
+			{Ident: "ID3D11Device", Queries: []string{"IDXGIDevice", "ID3D11Device1"}},
+		},
+		Naming: config.Naming{
+			Strip: []string{"ID3D11"},
+		},
+	})
+	expected := []string{"IDXGIDevice", "Device1"}
+	if queries := file.Structs[0].Queries; !reflect.DeepEqual(queries, expected) {
+		t.Errorf("expected queries %v, got %v", expected, queries)
+	}
+}
+
+func TestTransformIdent(t *testing.T) {
+	tr := &transformer{
+		config: &config.Config{
+			Naming: config.Naming{
+				Strip: []string{"ID3D11", "D3D11_", "D3D11", "D3D_"},
+			},
+		},
+	}
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"D3D11_ERROR_FILE_NOT_FOUND", "ERROR_FILE_NOT_FOUND"},
+		{"*ID3D11Buffer", "*Buffer"},
+		{"D3D11_COLOR_WRITE_ENABLE_RED | D3D11_COLOR_WRITE_ENABLE_GREEN", "COLOR_WRITE_ENABLE_RED | COLOR_WRITE_ENABLE_GREEN"},
+		// Identifiers can't start with a digit
+		{"D3D11_16BIT_INDEX_STRIP_CUT_VALUE", "D3D11_16BIT_INDEX_STRIP_CUT_VALUE"},
+		{"( D3D11_16BIT_INDEX_STRIP_CUT_VALUE + 1 )", "( D3D11_16BIT_INDEX_STRIP_CUT_VALUE + 1 )"},
+		{"0xffff", "0xffff"},
+	}
+	for _, test := range tests {
+		if got := tr.transformIdent(test.in); got != test.out {
+			t.Errorf("%q: expected %q, got %q", test.in, test.out, got)
+		}
+	}
+}
+
+func TestTransformMacros(t *testing.T) {
+	file := &types.File{
+		Macros: []types.Macro{
+			{Ident: "D3D11_ERROR_FILE_NOT_FOUND", HRESULT: true},
+			{Ident: "D3D11_SDK_VERSION", Value: types.Value{RawValue: "D3D11_OTHER"}},
+		},
+	}
+	Transform(file, &config.Config{
+		Naming: config.Naming{
+			Strip: []string{"D3D11_"},
+		},
+	})
+	if ident := file.Macros[0].Ident; ident != "ERROR_FILE_NOT_FOUND" {
+		t.Errorf("expected HRESULT macro to be renamed to ERROR_FILE_NOT_FOUND, got %s", ident)
+	}
+	if macro := file.Macros[1]; macro.Ident != "SDK_VERSION" || macro.RawValue != "OTHER" {
+		t.Errorf("expected SDK_VERSION = OTHER, got %s = %s", macro.Ident, macro.RawValue)
+	}
+}
+
+func TestTransformArrayOverrides(t *testing.T) {
+	file := &types.File{
+		Functions: []types.Function{
+			{
+				Ident: "SetData",
+				Parameters: []types.StructField{
+					pointerParam("pData", "void", 1, types.Annotation{Direction: types.DirectionIn}),
+					uintParam("DataSize"),
+				},
+			},
+			{
+				Ident: "SetPairs",
+				Parameters: []types.StructField{
+					uintParam("NumPairs"),
+					pointerParam("pPairs", "UINT", 1, types.Annotation{
+						Direction:  types.DirectionIn,
+						CountKind:  types.CountElements,
+						Count:      "NumPairs*2",
+						CountParam: "NumPairs",
+					}),
+				},
+			},
+			{
+				Ident: "SetViews",
+				Parameters: []types.StructField{
+					uintParam("NumViews"),
+					pointerParam("ppViews", "ID3D11View", 2, ecount(types.CountElements, "NumViews")),
+				},
+			},
+		},
+	}
+	yes, no := true, false
+	Transform(file, &config.Config{
+		Parameters: []config.Parameter{
+			{Function: "SetData", Name: "pData", Array: &yes},
+			{Function: "SetData", Name: "DataSize", ArrayLen: &yes},
+			{Function: "SetPairs", Name: "pPairs", Array: &yes},
+			{Function: "SetViews", Name: "ppViews", Array: &no},
+		},
+	})
+	tests := []struct {
+		param      types.StructField
+		isArray    bool
+		isArrayLen bool
+	}{
+		// Without a SAL count, the ArrayLen override is the length
+		{file.Functions[0].Parameters[0], true, false},
+		{file.Functions[0].Parameters[1], false, true},
+		// Counts that aren't a parameter can be forced to be slices
+		{file.Functions[1].Parameters[0], false, true},
+		{file.Functions[1].Parameters[1], true, false},
+		{file.Functions[2].Parameters[0], false, false},
+		{file.Functions[2].Parameters[1], false, false},
+	}
+	for _, test := range tests {
+		param := test.param
+		if param.IsArray != test.isArray || param.IsArrayLen != test.isArrayLen {
+			t.Errorf("%s: expected IsArray: %v, IsArrayLen: %v, got IsArray: %v, IsArrayLen: %v",
+				param.Name, test.isArray, test.isArrayLen, param.IsArray, param.IsArrayLen)
+		}
+	}
+}
+
+func enumField(ident string, value uint32, rawValue string) types.EnumField {
+	return types.EnumField{
+		Ident: ident,
+		Value: types.Value{UInt32Value: &value, RawValue: rawValue},
+	}
+}
+
+func TestIsFlags(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		name     string
+		record   types.Enum
+		override *bool
+		flags    bool
+	}{
+		{
+			name: "flag suffix",
+			record: types.Enum{
+				Ident:  "D3D11_CPU_ACCESS_FLAG",
+				Fields: []types.EnumField{enumField("D3D11_CPU_ACCESS_WRITE", 0x10000, "0x10000L")},
+			},
+			flags: true,
+		},
+		{
+			name:   "flags suffix",
+			record: types.Enum{Ident: "D3D11_CREATE_DEVICE_FLAGS"},
+			flags:  true,
+		},
+		{
+			name: "powers of two",
+			record: types.Enum{
+				Ident: "D3D11_COLOR_WRITE_ENABLE",
+				Fields: []types.EnumField{
+					enumField("D3D11_COLOR_WRITE_ENABLE_RED", 1, "1"),
+					enumField("D3D11_COLOR_WRITE_ENABLE_GREEN", 2, "2"),
+					enumField("D3D11_COLOR_WRITE_ENABLE_BLUE", 4, "4"),
+					enumField("D3D11_COLOR_WRITE_ENABLE_ALPHA", 8, "8"),
+				},
+			},
+			flags: true,
+		},
+		{
+			name: "OR combination",
+			record: types.Enum{
+				Ident: "D3D11_COLOR_WRITE_ENABLE",
+				Fields: []types.EnumField{
+					enumField("D3D11_COLOR_WRITE_ENABLE_RED", 1, "1"),
+					enumField("D3D11_COLOR_WRITE_ENABLE_GREEN", 2, "2"),
+					enumField("D3D11_COLOR_WRITE_ENABLE_BLUE", 4, "4"),
+					enumField("D3D11_COLOR_WRITE_ENABLE_ALL", 7, "( ( D3D11_COLOR_WRITE_ENABLE_RED | D3D11_COLOR_WRITE_ENABLE_GREEN ) | D3D11_COLOR_WRITE_ENABLE_BLUE )"),
+				},
+			},
+			flags: true,
+		},
+		{
+			name: "combination without OR",
+			record: types.Enum{
+				Ident: "D3D11_FILTER",
+				Fields: []types.EnumField{
+					enumField("D3D11_FILTER_MIN_MAG_MIP_POINT", 0, "0"),
+					enumField("D3D11_FILTER_MIN_MAG_POINT_MIP_LINEAR", 1, "0x1"),
+					enumField("D3D11_FILTER_MIN_POINT_MAG_LINEAR_MIP_POINT", 4, "0x4"),
+					enumField("D3D11_FILTER_MIN_POINT_MAG_MIP_LINEAR", 5, "0x5"),
+					enumField("D3D11_FILTER_MIN_LINEAR_MAG_MIP_POINT", 16, "0x10"),
+				},
+			},
+			flags: false,
+		},
+		{
+			name: "ordinals",
+			record: types.Enum{
+				Ident: "D3D11_CULL_MODE",
+				Fields: []types.EnumField{
+					enumField("D3D11_CULL_NONE", 0, "0"),
+					enumField("D3D11_CULL_FRONT", 1, "1"),
+					enumField("D3D11_CULL_BACK", 2, "2"),
+				},
+			},
+			flags: false,
+		},
+		{
+			name: "override",
+			record: types.Enum{
+				Ident: "D3D11_CULL_MODE",
+				Fields: []types.EnumField{
+					enumField("D3D11_CULL_NONE", 0, "0"),
+					enumField("D3D11_CULL_FRONT", 1, "1"),
+					enumField("D3D11_CULL_BACK", 2, "2"),
+				},
+			},
+			override: &yes,
+			flags:    true,
+		},
+		{
+			name:     "override suffix",
+			record:   types.Enum{Ident: "D3D11_RESOURCE_MISC_FLAG"},
+			override: &no,
+			flags:    false,
+		},
+	}
+	for _, test := range tests {
+		cfg := &config.Config{}
+		if test.override != nil {
+			cfg.Enums = []config.Enum{{Ident: test.record.Ident, Flags: test.override}}
+		}
+		tr := &transformer{config: cfg}
+		if flags := tr.isFlags(&test.record); flags != test.flags {
+			t.Errorf("%s: expected isFlags of %s to be %v, got %v", test.name, test.record.Ident, test.flags, flags)
+		}
+	}
+}
+
+func TestEscapeKeyword(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+	}{
+		{"type", "type_"},
+		{"range", "range_"},
+		{"Type", "Type"},
+		{"pDesc", "pDesc"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if out := escapeKeyword(test.name); out != test.out {
+			t.Errorf("%q: expected %q, got %q", test.name, test.out, out)
+		}
+	}
+}
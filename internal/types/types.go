@@ -13,6 +13,9 @@ type Value struct {
 	UInt32Value *uint32
 	// StringValue is set if the value is a string type
 	StringValue *string
+	// Const is set if the value is a #define constant or enumerator
+	// that was evaluated, it has the value with its C type
+	Const *Const
 	// RawValue is the value as it appears in C-code, this is
 	// used in code generation if we can't compute the value
 	RawValue string
@@ -29,6 +32,47 @@ func (v *Value) String() string {
 	return v.RawValue
 }
 
+// ConstKind is the C type of a constant
+type ConstKind int
+
+const (
+	// ConstInt64 is a signed integer, ie. int, long or __int64
+	ConstInt64 ConstKind = iota
+	// ConstUint64 is an unsigned integer, ie. UINT or 0xFFFFFFFF
+	ConstUint64
+	// ConstFloat32 is a float, ie. 0.0f
+	ConstFloat32
+	// ConstFloat64 is a double, ie. 0.5
+	ConstFloat64
+	// ConstString is a string of char, ie. "d3dcompiler_43.dll"
+	ConstString
+	// ConstWideString is a string of wchar_t, ie. L"d3dcompiler_43.dll"
+	ConstWideString
+)
+
+// Const is a constant with its C type
+type Const struct {
+	Kind ConstKind
+	// Int64 is set for ConstInt64
+	Int64 int64
+	// Uint64 is set for ConstUint64
+	Uint64 uint64
+	// Float64 is set for ConstFloat32 and ConstFloat64
+	Float64 float64
+	// Str is set for ConstString and ConstWideString
+	Str string
+}
+
+// Source is where a declaration is in the header that it's parsed from
+type Source struct {
+	// CIdent is the name of the declaration in the header, it isn't
+	// renamed by the transformer, ie. "ID3D11Texture2D" for "Texture2D"
+	CIdent string
+	// Line is the line of the header that the declaration starts on,
+	// it's 0 for declarations from the config
+	Line int
+}
+
 type File struct {
 	Filename    string
 	Structs     []Struct
@@ -36,26 +80,48 @@ type File struct {
 	TypeAliases []TypeAlias
 	Enums       []Enum
 	Macros      []Macro
+	Guids       []Guid
+}
+
+// Guid is a GUID declared with DEFINE_GUID, DEFINE_IID or DEFINE_CLSID
+type Guid struct {
+	// Ident is the name of the GUID, ie. "IID_ID3D11ShaderReflection"
+	Ident string
+	Source
+	// GUID is in the same format as Struct.GUID,
+	// ie. "0a233719-3960-4578-9d7c-203b8b1d9cc1"
+	GUID string
 }
 
 type Macro struct {
 	Ident string
+	Source
 	Value
+	// HRESULT is true if the macro is an error or status code,
+	// ie. DXGI_ERROR_DEVICE_REMOVED
+	HRESULT bool
+	// Doc is the documentation from the comments in the header
+	Doc string
 }
 
 type Function struct {
-	Ident      string
+	Ident string
+	Source
 	DLLCall    string
 	Parameters []StructField
+	// Doc is the documentation from the comments in the header
+	Doc string
 }
 
 type TypeAlias struct {
 	Ident string
+	Source
 	Alias string
 }
 
 type Struct struct {
-	Ident  string
+	Ident string
+	Source
 	Fields []StructField
 
 	// Vtbl for the struct
@@ -63,36 +129,155 @@ type Struct struct {
 
 	// GUID string for the struct (applies only COM interface types)
 	GUID string
+
+	// Base is the interface that this COM interface inherits
+	// from, ie. "ID3D11Resource" for "ID3D11Texture2D"
+	Base string
+	// Queries are the interfaces that a COM interface can be queried
+	// for besides the ones that inherit from it, ie. "IDXGIDevice"
+	// for "ID3D11Device"
+	Queries []string
+
+	// Layout is the memory layout of the struct when compiled with
+	// MSVC, it's nil if the size of a field is unknown
+	Layout *Layout
+
+	// Doc is the documentation from the comments in the header
+	Doc string
+}
+
+// Layout is the memory layout of a struct on each target
+type Layout struct {
+	X86 StructLayout
+	X64 StructLayout
+}
+
+// StructLayout is the size, alignment and field offsets of a
+// struct in bytes
+type StructLayout struct {
+	Size  int
+	Align int
+	// Offsets are the offsets of each field
+	Offsets []int
 }
 
 type StructField struct {
 	Name string
 
-	// IsOut is true when the field has an __out annotation
-	IsOut bool
-	// HasECount is true when the field has an __in_ecount_opt
-	// field, this normally means the next field is a UINT
-	// representing how many are in an array
-	HasECount bool
+	// Annotation is the SAL annotation of the parameter, ie.
+	// "__in_ecount_opt(NumViews)"
+	Annotation Annotation
 	// IsArray is when the field is most likely a dynamic array
 	IsArray bool
 	// IsArrayLen is true when field(s) are meant to represent
 	// the length of an array of data.
 	IsArrayLen bool
-	// IsDeref is true when a field has a __deref annotation
+	// Arrays are the names of the slice parameters that this is the
+	// length of when IsArrayLen is true, they have the same length
+	Arrays []string
+	// IsDeref is true when the parameter is passed as a pointer
+	// to an interface{}, ie. a __deref_out void** parameter
 	IsDeref bool
+	// IsOptional is true when the parameter can be nil or an empty
+	// slice, ie. "__in_opt". Optional out parameters are passed in
+	// so that callers can skip them.
+	IsOptional bool
 
 	TypeInfo TypeInfo
+
+	// Doc is the documentation from the comments in the header, for
+	// parameters this includes MIDL attributes, ie. "[annotation][out]"
+	Doc string
+}
+
+// Direction is the direction that data is passed through
+// a parameter, it's empty if the parameter isn't annotated
+type Direction string
+
+const (
+	// DirectionIn is read by the function, ie. __in
+	DirectionIn Direction = "in"
+	// DirectionOut is written by the function, ie. __out
+	DirectionOut Direction = "out"
+	// DirectionInOut is read and written by the function, ie. __inout
+	DirectionInOut Direction = "inout"
+)
+
+// CountKind is the unit of the size of a buffer, it's empty
+// if the parameter isn't a buffer
+type CountKind string
+
+const (
+	// CountElements is a number of elements, ie. __in_ecount(NumViews)
+	CountElements CountKind = "elements"
+	// CountBytes is a number of bytes, ie. __out_bcount(DataSize)
+	CountBytes CountKind = "bytes"
+	// CountUnknown is a size that SAL doesn't give the unit of,
+	// ie. __in_xcount_opt(NumPoints * 2)
+	CountUnknown CountKind = "unknown"
+)
+
+// Annotation is the combined SAL annotations of a parameter, ie.
+// "__in_ecount_opt(NumViews)" or "__deref_out_opt"
+type Annotation struct {
+	// SAL are the annotations as they appear in C-code,
+	// ie. "__in_range(0,D3D11_COMMONSHADER_SAMPLER_SLOT_COUNT-1)"
+	SAL []string
+	// Direction is whether data is read or written through the parameter
+	Direction Direction
+	// Optional is true if the parameter can be NULL, ie. __in_opt
+	Optional bool
+	// Reserved is true if the parameter must be 0 or NULL, ie. __reserved
+	Reserved bool
+	// Deref is the number of pointers that are dereferenced before
+	// the annotation applies, ie. 1 for __deref_out
+	Deref int
+	// NullTerminated is true if the buffer ends with a 0, ie. __in_z
+	NullTerminated bool
+
+	// CountKind is whether Count is a number of elements or bytes
+	CountKind CountKind
+	// Count is the expression of the size of the buffer, ie.
+	// "NumViews" for __in_ecount(NumViews) or "*pDataSize" for
+	// __out_bcount_opt(*pDataSize)
+	Count string
+	// CountParam is the parameter that Count uses, ie. "pDataSize",
+	// it's empty if Count only uses constants
+	CountParam string
+	// Length is the expression of the number of elements or bytes
+	// that are initialised, ie. "*pNumElements" for
+	// __out_ecount_part_opt(NumElements, *pNumElements)
+	Length string
+
+	// RangeMin and RangeMax are the inclusive bounds of the value
+	// of the parameter, ie. __in_range(0, D3D11_SO_BUFFER_SLOT_COUNT)
+	RangeMin string
+	RangeMax string
+}
+
+// IsOut returns true if data is only written to the parameter,
+// ie. __out, __inout parameters are read too
+func (a Annotation) IsOut() bool {
+	return a.Direction == DirectionOut
 }
 
 type Enum struct {
-	Ident  string
+	Ident string
+	Source
 	Fields []EnumField
+	// Flags is true if the values are bit flags that can be combined,
+	// ie. D3D11_BIND_FLAG
+	Flags bool
+	// Doc is the documentation from the comments in the header
+	Doc string
 }
 
 type EnumField struct {
 	Ident string
+	Source
 	Value
+	// Doc is the documentation from the comments in the header
+	Doc string
 }
 
 type TypeInfo struct {
@@ -139,6 +324,10 @@ func NewArray(ident string, data Array) TypeInfo {
 
 type Union struct {
 	Fields []StructField
+
+	// Layout is the size and alignment of the union, the
+	// offsets of its fields are always 0
+	Layout *Layout
 }
 
 func (*Union) isType() {}
@@ -178,21 +367,3 @@ func NewPointer(ident string, data Pointer) TypeInfo {
 		Type:  &data,
 	}
 }
-
-func IsECountArray(param *StructField) bool {
-	//fmt.Printf("param: %s\n", param.Name)
-	if param.Name == "ppRenderTargetViews" {
-		return false
-	}
-	typeInfo, ok := param.TypeInfo.Type.(*Pointer)
-	if !ok {
-		return false
-	}
-	switch typeInfo.Depth {
-	case 1:
-		return true
-	case 2:
-		return true
-	}
-	return false
-}
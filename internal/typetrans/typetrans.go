@@ -15,6 +15,7 @@ func GUIDTypeTranslation() TypeTranslationInfo {
 		// Generated in printer.go
 		GoType: "GUID",
 		Size:   "16",
+		Align:  "4",
 	}
 }
 
@@ -50,9 +51,9 @@ func GoTypeFromTypeInfo(typeInfo types.TypeInfo) string {
 		}
 		b.WriteString(typeIdent)
 	case *types.Union:
-		b.WriteString("/*UNION\n{\n")
-		//printStructFields(&b, typeInfo.Fields)
-		b.WriteString("}*/\n")
+		// NOTE: Unions are printed as a byte array with methods
+		// to get and set each field, see printer.go
+		return ""
 	case *types.FunctionPointer:
 		b.WriteString("uintptr")
 	case *types.Pointer:
@@ -68,7 +69,10 @@ func GoTypeFromTypeInfo(typeInfo types.TypeInfo) string {
 	if typeTranslation, ok := builtInTypeTranslation[ident]; ok {
 		ident = typeTranslation.GoType
 	} else {
-		ident = strings.Replace(ident, "CONST_VTBL struct ", "", 1)
+		// ie. "CONST_VTBL struct ID3D11DeviceVtbl", CONST_VTBL is
+		// already expanded to nothing in headers that define it
+		ident = strings.Replace(ident, "CONST_VTBL ", "", 1)
+		ident = strings.Replace(ident, "struct ", "", 1)
 	}
 	return ident
 }
@@ -79,6 +83,9 @@ type TypeTranslationInfo struct {
 	// retrieved manually by printing sizeof() the type in
 	// Visual Studio 2015
 	Size string
+	// Align is the alignment of the type in bytes,
+	// if it's empty, it's the same as Size
+	Align string
 }
 
 // NOTE(Jae): 2020-01-17
@@ -132,6 +139,11 @@ var builtInTypeTranslation = map[string]TypeTranslationInfo{
 		GoType: "uintptr",
 		Size:   "ptr",
 	},
+	"LPCVOID": TypeTranslationInfo{
+		// typedef CONST void *LPCVOID;
+		GoType: "uintptr",
+		Size:   "ptr",
+	},
 	"HANDLE": TypeTranslationInfo{
 		// typedef PVOID HANDLE;
 		GoType: "uintptr",
@@ -162,20 +174,6 @@ var builtInTypeTranslation = map[string]TypeTranslationInfo{
 		GoType: "int64",
 		Size:   "8",
 	},
-	"LUID": TypeTranslationInfo{
-		// todo(Jae): 2020-01-28
-		// Might need to make this generated in printer.go
-		// as its own struct type.
-
-		// Describes a local identifier for an adapter.
-		// https://docs.microsoft.com/en-us/windows/win32/api/winnt/ns-winnt-luid
-		// typedef struct _LUID {
-		//  DWORD LowPart;
-		//  LONG  HighPart;
-		//} LUID, *PLUID;
-		GoType: "int64",
-		Size:   "8",
-	},
 	"IUnknown": TypeTranslationInfo{
 		GoType: "uintptr",
 		Size:   "ptr",
@@ -221,6 +219,19 @@ var builtInTypeTranslation = map[string]TypeTranslationInfo{
 	},
 }
 
+// GoTypeFromAlias returns the Go type of the C type that a typedef
+// aliases, ie. "*float" is "*float32"
+func GoTypeFromAlias(alias string) string {
+	if typeTranslation, ok := builtInTypeTranslation[alias]; ok {
+		return typeTranslation.GoType
+	}
+	elem := strings.TrimLeft(alias, "*")
+	if typeTranslation, ok := builtInTypeTranslation[elem]; ok {
+		return alias[:len(alias)-len(elem)] + typeTranslation.GoType
+	}
+	return alias
+}
+
 func BuiltInTypeTranslation(typeName string) (TypeTranslationInfo, bool) {
 	r, ok := builtInTypeTranslation[typeName]
 	if !ok {
@@ -2,164 +2,318 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/silbinarywolf/directx-bind-gen/internal/config"
+	"github.com/silbinarywolf/directx-bind-gen/internal/layout"
 	"github.com/silbinarywolf/directx-bind-gen/internal/parser"
 	"github.com/silbinarywolf/directx-bind-gen/internal/printer"
 	"github.com/silbinarywolf/directx-bind-gen/internal/transformer"
 	"github.com/silbinarywolf/directx-bind-gen/internal/types"
 )
 
+const usage = `Usage: directx-bind-gen [command] [flags] [headers...]
+
+Commands:
+  gen   parse headers, write JSON data and Go bindings (default)
+  parse parse headers and write JSON data
+  dump  parse headers and print JSON data to stdout
+  verify parse headers and type-check the generated Go bindings
+         for windows/amd64 and windows/386
+
+Headers are resolved relative to the include directory unless they are
+absolute paths. If no headers are given, the headers listed in the
+config file are used.
+
+Flags:
+`
+
+type options struct {
+	DataDir string
+	OutDir  string
+	Verbose bool
+	Config  *config.Config
+}
+
+// errUsage is returned by parseArgs if the arguments are invalid,
+// the usage has already been printed
+var errUsage = errors.New("invalid arguments")
+
 func main() {
-	filename := "DXSDK_Jun10/include/D3D11.h"
-	f, err := os.Open(filename)
+	command, opts, err := parseArgs(os.Args[1:], os.Stderr)
+	switch {
+	case err == flag.ErrHelp:
+		return
+	case err == errUsage:
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	switch command {
+	case "gen":
+		err = gen(opts)
+	case "parse":
+		err = parse(opts)
+	case "dump":
+		err = dump(opts)
+	case "verify":
+		err = verify(opts)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// parseArgs parses the command, flags and headers of the command-line
+// arguments and loads the config, the flags and headers override it.
+// Errors and the usage are printed to output.
+func parseArgs(args []string, output io.Writer) (string, options, error) {
+	command := "gen"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command = args[0]
+		args = args[1:]
+	}
+
+	var (
+		opts        options
+		configPath  string
+		includeDir  string
+		packageName string
+		dll         string
+	)
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.StringVar(&configPath, "config", "config/d3d11.json", "config file describing the headers and how to generate bindings")
+	flags.StringVar(&includeDir, "include", "", "directory that headers are resolved against, overrides the config")
+	flags.StringVar(&opts.DataDir, "data", "data", "directory to write JSON data to")
+	flags.StringVar(&opts.OutDir, "out", "dist", "directory to write Go bindings to")
+	flags.StringVar(&packageName, "package", "", "package name of the generated Go bindings, overrides the config")
+	flags.StringVar(&dll, "dll", "", "DLL that functions are loaded from, ie. dxgi.dll, overrides the config")
+	flags.BoolVar(&opts.Verbose, "v", false, "print parser warnings as well as errors")
+	flags.Usage = func() {
+		fmt.Fprint(output, usage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return "", options{}, err
+		}
+		return "", options{}, errUsage
+	}
+	switch command {
+	case "gen", "parse", "dump", "verify":
+	default:
+		fmt.Fprintf(output, "unknown command: %s\n\n", command)
+		flags.Usage()
+		return "", options{}, errUsage
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return "", options{}, err
+	}
+	if includeDir != "" {
+		cfg.IncludeDir = includeDir
+	}
+	if packageName != "" {
+		cfg.Package = packageName
+	}
+	if dll != "" {
+		cfg.DLL = dll
+	}
+	if headers := flags.Args(); len(headers) > 0 {
+		cfg.Headers = headers
+	}
+	opts.Config = cfg
+	return command, opts, nil
+}
+
+func gen(opts options) error {
+	project, err := loadProject(opts)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(&project, opts.DataDir); err != nil {
+		return err
+	}
+	return writeBindings(&project, opts)
+}
+
+func parse(opts options) error {
+	project, err := loadProject(opts)
+	if err != nil {
+		return err
+	}
+	return writeJSON(&project, opts.DataDir)
+}
+
+func dump(opts options) error {
+	project, err := loadProject(opts)
+	if err != nil {
+		return err
+	}
+	res, err := json.MarshalIndent(project.Files, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(append(res, '\n'))
+	return err
+}
+
+func verify(opts options) error {
+	project, err := loadProject(opts)
+	if err != nil {
+		return err
+	}
+	files, err := printer.PrintProject(&project, opts.Config)
+	if err != nil {
+		return err
+	}
+	errs, err := printer.Verify(&project, opts.OutDir, files)
 	if err != nil {
-		panic(err)
-	}
-	defer f.Close()
-
-	files := []string{
-		"DXSDK_Jun10/include/D3D11.h",
-		"DXSDK_Jun10/include/DXGI.h",
-		"DXSDK_Jun10/include/DXGIType.h",
-		"DXSDK_Jun10/include/D3Dcommon.h",
-		"DXSDK_Jun10/include/DXGIFormat.h",
-		"DXSDK_Jun10/include/D3D11SDKLayers.h",
-		"DXSDK_Jun10/include/D3D11Shader.h",
-	}
-
-	// Get project
-	var project types.Project
-	{
-		file := types.File{}
-		file.Filename = "directx-bind-gen"
-		file.TypeAliases = append(file.TypeAliases, []types.TypeAlias{
-			{
-				Ident: "HWND",
-				Alias: "uintptr",
-			},
-			{
-				Ident: "HMODULE",
-				Alias: "uintptr",
-			},
-			/*{
-				Ident: "BOOL",
-				Alias: "uint32",
-			},
-			{
-				Ident: "FLOAT",
-				Alias: "float32",
-			},*/
-		}...)
-		file.Structs = append(file.Structs, []types.Struct{
-			{
-				// guid describes a structure used to describe an identifier for a MAPI interface.
-				// https://docs.microsoft.com/en-us/office/client-developer/outlook/mapi/iid
-				//
-				// implemented here too: https://github.com/golang/sys/blob/master/windows/types_windows.go#L1216
-				Ident: "GUID",
-				Fields: []types.StructField{
-					{
-						Name:     "Data1",
-						TypeInfo: types.NewBasicType("uint32", types.BasicType{}),
-					},
-					{
-						Name:     "Data2",
-						TypeInfo: types.NewBasicType("uint16", types.BasicType{}),
-					},
-					{
-						Name:     "Data3",
-						TypeInfo: types.NewBasicType("uint16", types.BasicType{}),
-					},
-					{
-						Name: "Data4",
-						TypeInfo: types.NewArray("byte", types.Array{
-							Dimens: []int{8},
-						}),
-					},
-				},
-			},
-			{
-				// Rect structure defines a rectangle by the coordinates of its upper-left and lower-right corners.
-				// https://docs.microsoft.com/en-us/windows/win32/api/windef/ns-windef-rect
-				Ident: "Rect",
-				Fields: []types.StructField{
-					{
-						Name:     "Left",
-						TypeInfo: types.NewBasicType("int32", types.BasicType{}),
-					},
-					{
-						Name:     "Top",
-						TypeInfo: types.NewBasicType("int32", types.BasicType{}),
-					},
-					{
-						Name:     "Right",
-						TypeInfo: types.NewBasicType("int32", types.BasicType{}),
-					},
-					{
-						Name:     "Bottom",
-						TypeInfo: types.NewBasicType("int32", types.BasicType{}),
-					},
-				},
-			},
-		}...)
-		file.Macros = append(file.Macros, []types.Macro{
-			{
-				// E_INVALIDARG indicates that an invalid parameter was passed to the
-				// returning function.
-				Ident: "E_INVALIDARG",
-				Value: types.Value{
-					RawValue: "-2147024809",
-				},
-			},
-		}...)
-		project.Files = append(project.Files, file)
-	}
-	for _, filename := range files {
-		file := parser.ParseFile(filename)
-		project.Files = append(project.Files, file)
+		return err
+	}
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("generated bindings have %d type errors", len(errs))
+	}
+	return nil
+}
+
+// loadProject parses the headers and the headers they include
+// and applies transformations.
+// Parser diagnostics are printed to stderr.
+func loadProject(opts options) (types.Project, error) {
+	var filenames []string
+	for _, header := range opts.Config.Headers {
+		filename := header
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(opts.Config.IncludeDir, filename)
+		}
+		filenames = append(filenames, filename)
+	}
+	project, diagnostics, err := parser.ParseFiles(filenames, opts.Config.ParserConfig())
+	printDiagnostics(diagnostics, opts.Verbose)
+	if err != nil {
+		return types.Project{}, err
+	}
+	project.Files = append([]types.File{opts.Config.File()}, project.Files...)
+
+	// NOTE: Layouts are computed before transforming as they're
+	// resolved by their C identifiers
+	for _, err := range layout.Compute(&project) {
+		if opts.Verbose {
+			fmt.Fprintln(os.Stderr, "warning: cannot compute layout: "+err.Error())
+		}
 	}
 
 	// Perform customised transforms
 	for i := 0; i < len(project.Files); i++ {
 		file := &project.Files[i]
-		transformer.Transform(file)
-	}
-
-	// Output JSON
-	{
-		outputFolderName := "data"
-		for _, file := range project.Files {
-			if file.Filename == "" {
-				panic("Missing Filename.")
-			}
-			res, err := json.MarshalIndent(file, "", "  ")
-			if err != nil {
-				panic(err)
-			}
-			baseName := filepath.Base(file.Filename)
-			baseName = strings.TrimSuffix(baseName, filepath.Ext(baseName))
-			outputPath := outputFolderName + "/" + baseName + ".json"
-			if err := ioutil.WriteFile(outputPath, res, 0644); err != nil {
-				panic(err)
-			}
+		transformer.Transform(file, opts.Config)
+	}
+	return project, nil
+}
+
+func printDiagnostics(diagnostics []parser.Diagnostic, verbose bool) {
+	for _, d := range diagnostics {
+		if d.Severity == parser.SeverityWarning && !verbose {
+			continue
+		}
+		fmt.Fprintln(os.Stderr, d)
+	}
+}
+
+// writeJSON outputs a JSON file per parsed file to the given folder
+func writeJSON(project *types.Project, outputFolderName string) error {
+	if err := os.MkdirAll(outputFolderName, 0777); err != nil {
+		return err
+	}
+	for _, file := range project.Files {
+		if file.Filename == "" {
+			panic("Missing Filename.")
+		}
+		res, err := json.MarshalIndent(file, "", "  ")
+		if err != nil {
+			return err
+		}
+		baseName := filepath.Base(file.Filename)
+		baseName = strings.TrimSuffix(baseName, filepath.Ext(baseName))
+		outputPath := filepath.Join(outputFolderName, baseName+".json")
+		if err := ioutil.WriteFile(outputPath, res, 0644); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	// Create Golang bindings
-	{
-		outputData := printer.PrintProject(&project)
-		if _, err := os.Stat("dist"); err != nil {
-			if err := os.Mkdir("dist", 0777); err != nil {
-				panic(err)
-			}
+// writeBindings creates the Golang bindings
+func writeBindings(project *types.Project, opts options) error {
+	files, printErr := printer.PrintProject(project, opts.Config)
+	if files == nil {
+		return printErr
+	}
+	// Remove the files of the previous run in case headers were
+	// moved to another package or aren't parsed anymore
+	dirs := make(map[string]bool)
+	for _, file := range files {
+		dir := filepath.Dir(filepath.Join(opts.OutDir, filepath.FromSlash(file.Filename)))
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return err
+		}
+		if err := removeGeneratedFiles(dir); err != nil {
+			return err
 		}
-		err = ioutil.WriteFile("dist/d3d11.go", outputData, 0644)
+	}
+	// NOTE: Output is written even if it can't be formatted so
+	// that it can be debugged
+	for _, file := range files {
+		outputPath := filepath.Join(opts.OutDir, filepath.FromSlash(file.Filename))
+		if err := ioutil.WriteFile(outputPath, file.Data, 0644); err != nil {
+			return err
+		}
+	}
+	return printErr
+}
+
+// removeGeneratedFiles removes the Go files in the folder that were
+// generated by printer.PrintProject
+func removeGeneratedFiles(dir string) error {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if info.IsDir() || filepath.Ext(info.Name()) != ".go" {
+			continue
+		}
+		filename := filepath.Join(dir, info.Name())
+		data, err := ioutil.ReadFile(filename)
 		if err != nil {
-			panic(err)
+			return err
+		}
+		if !printer.IsGenerated(data) {
+			continue
+		}
+		if err := os.Remove(filename); err != nil {
+			return err
 		}
 	}
+	return nil
 }
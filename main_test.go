@@ -1,47 +1,149 @@
 package main
 
 import (
-	"strings"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"testing"
-	"text/scanner"
 )
 
-type GoldenRule struct {
-	In string
-	//Out string
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args       []string
+		command    string
+		pkg        string
+		dll        string
+		includeDir string
+		headers    []string
+		dataDir    string
+		outDir     string
+		verbose    bool
+	}{
+		{
+			args:       nil,
+			command:    "gen",
+			pkg:        "d3d11",
+			dll:        "d3d11.dll",
+			includeDir: "DXSDK_Jun10/include",
+			headers:    []string{"D3D11.h", "D3D11Shader.h"},
+			dataDir:    "data",
+			outDir:     "dist",
+		},
+		{
+			args:       []string{"verify", "-v", "-out", "build"},
+			command:    "verify",
+			pkg:        "d3d11",
+			dll:        "d3d11.dll",
+			includeDir: "DXSDK_Jun10/include",
+			headers:    []string{"D3D11.h", "D3D11Shader.h"},
+			dataDir:    "data",
+			outDir:     "build",
+			verbose:    true,
+		},
+		{
+			args:       []string{"gen", "-package", "dxgi", "-dll", "dxgi.dll", "-out", "dist/dxgi", "DXGI.h", "DXGIType.h"},
+			command:    "gen",
+			pkg:        "dxgi",
+			dll:        "dxgi.dll",
+			includeDir: "DXSDK_Jun10/include",
+			headers:    []string{"DXGI.h", "DXGIType.h"},
+			dataDir:    "data",
+			outDir:     "dist/dxgi",
+		},
+		{
+			args:       []string{"-include", "include", "-data", "json", "D3D11.h"},
+			command:    "gen",
+			pkg:        "d3d11",
+			dll:        "d3d11.dll",
+			includeDir: "include",
+			headers:    []string{"D3D11.h"},
+			dataDir:    "json",
+			outDir:     "dist",
+		},
+		{
+			args:       []string{"dump"},
+			command:    "dump",
+			pkg:        "d3d11",
+			dll:        "d3d11.dll",
+			includeDir: "DXSDK_Jun10/include",
+			headers:    []string{"D3D11.h", "D3D11Shader.h"},
+			dataDir:    "data",
+			outDir:     "dist",
+		},
+	}
+	for _, test := range tests {
+		command, opts, err := parseArgs(test.args, ioutil.Discard)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.args, err)
+			continue
+		}
+		if command != test.command {
+			t.Errorf("%v: expected command %q, got %q", test.args, test.command, command)
+		}
+		cfg := opts.Config
+		if cfg.Package != test.pkg || cfg.DLL != test.dll || cfg.IncludeDir != test.includeDir {
+			t.Errorf("%v: expected package %q, dll %q and include %q, got %q, %q and %q", test.args, test.pkg, test.dll, test.includeDir, cfg.Package, cfg.DLL, cfg.IncludeDir)
+		}
+		if !reflect.DeepEqual(cfg.Headers, test.headers) {
+			t.Errorf("%v: expected headers %v, got %v", test.args, test.headers, cfg.Headers)
+		}
+		if opts.DataDir != test.dataDir || opts.OutDir != test.outDir || opts.Verbose != test.verbose {
+			t.Errorf("%v: expected data %q, out %q and verbose %v, got %q, %q and %v", test.args, test.dataDir, test.outDir, test.verbose, opts.DataDir, opts.OutDir, opts.Verbose)
+		}
+	}
 }
 
-var structTestData = []GoldenRule{
-	{
-		// typedef struct D3D11_BOX
-		In: `
-	    UINT left;
-	    UINT top;
-	    UINT front;
-	    UINT right;
-	    UINT bottom;
-	    UINT back;
-	    } 	D3D11_BOX;`,
-	},
-	{
-		// typedef struct ID3D11DeviceChildVtbl
-		In: `
-    	BEGIN_INTERFACE
-        
-        HRESULT ( STDMETHODCALLTYPE *QueryInterface )( 
-            ID3D11DeviceChild * This,
-            /* [in] */ REFIID riid,
-            /* [annotation][iid_is][out] */ 
-            __RPC__deref_out  void **ppvObject);`,
-	},
+func TestParseArgsErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		err  error
+	}{
+		{[]string{"build"}, errUsage},
+		{[]string{"-unknown"}, errUsage},
+		{[]string{"gen", "-h"}, flag.ErrHelp},
+	}
+	for _, test := range tests {
+		if _, _, err := parseArgs(test.args, ioutil.Discard); err != test.err {
+			t.Errorf("%v: expected %v, got %v", test.args, test.err, err)
+		}
+	}
+	if _, _, err := parseArgs([]string{"-config", "config/missing.json"}, ioutil.Discard); err == nil {
+		t.Errorf("expected an error for a missing config")
+	}
 }
 
-func TestParseStruct(t *testing.T) {
-	for _, test := range structTestData {
-		var s scanner.Scanner
-		s.Init(strings.NewReader(test.In))
-		s.Filename = "Test"
-		s.Mode = scanner.GoTokens
-		parseStructFields(&s)
+func TestGenXAudio2(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping generation of XAudio2.h in short mode")
+	}
+	dir, err := ioutil.TempDir("", "directx-bind-gen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	_, opts, err := parseArgs([]string{
+		"gen",
+		"-package", "xaudio2",
+		"-data", filepath.Join(dir, "data"),
+		"-out", filepath.Join(dir, "dist"),
+		"XAudio2.h",
+	}, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gen(opts); err != nil {
+		t.Fatalf("cannot generate XAudio2.h: %v", err)
+	}
+
+	// ie. "typedef const WAVEFORMATEX *PCWAVEFORMATEX;" in audiodefs.h
+	data, err := ioutil.ReadFile(filepath.Join(dir, "dist", "audiodefs.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`PCWAVEFORMATEX\s+\*WAVEFORMATEX\n`).Match(data) {
+		t.Errorf("expected PCWAVEFORMATEX to alias *WAVEFORMATEX in audiodefs.go")
 	}
 }
@@ -56,16 +56,19 @@ func Example() {
 	driverType := d3d11.DRIVER_TYPE_NULL
 	for driverTypeIndex, _ := range driverTypes {
 		driverType = driverTypes[driverTypeIndex]
-		device, featureLevel, immediateContext, err = d3d11.CreateDevice(
+		err = d3d11.CreateDevice(
 			nil,
 			driverType,
 			0,
 			uint32(d3d11.CREATE_DEVICE_DEBUG),
 			featureLevels,
 			d3d11.SDK_VERSION,
+			&device,
+			&featureLevel,
+			&immediateContext,
 		)
 		if err != nil {
-			if err.Code() != d3d11.E_INVALIDARG {
+			if err != d3d11.E_INVALIDARG {
 				panic(err)
 			}
 			//panic(err)
@@ -78,19 +81,21 @@ func Example() {
 	// Obtain DXGI factory from device (since we used 0 for adapter above)
 	var dxgiFactory *d3d11.IDXGIFactory1
 	{
-		var dxgiDevice *d3d11.IDXGIDevice
-		if err := device.QueryInterface(dxgiDevice.GUID(), &dxgiDevice); err != nil {
+		var scope d3d11.Scope
+		dxgiDevice, err := device.QueryInterfaceDXGIDevice()
+		if err != nil {
 			panic(err)
 		}
+		scope.Add(dxgiDevice)
 		adapter, err := dxgiDevice.GetAdapter()
 		if err != nil {
 			panic(err)
 		}
+		scope.Add(adapter)
 		if err := adapter.GetParent(dxgiFactory.GUID(), &dxgiFactory); err != nil {
 			panic(err)
 		}
-		adapter.Release()
-		dxgiDevice.Release()
+		scope.Release()
 		if err != nil {
 			panic(err)
 		}
@@ -138,12 +143,13 @@ func Example() {
 	if err := swapChain.GetBuffer(0, backBuffer.GUID(), &backBuffer); err != nil {
 		panic(err.Error())
 	}
-	renderTargetView, err := device.CreateRenderTargetView(backBuffer, nil)
+	var renderTargetView *d3d11.RenderTargetView
+	err = device.CreateRenderTargetView(backBuffer, nil, &renderTargetView)
 	backBuffer.Release()
 	if err != nil {
 		panic(err.Error())
 	}
-	immediateContext.OMSetRenderTargets(1, &renderTargetView, nil)
+	immediateContext.OMSetRenderTargets([]*d3d11.RenderTargetView{renderTargetView}, nil)
 	viewport := d3d11.VIEWPORT{
 		Width:    windowWidth,
 		Height:   windowHeight,